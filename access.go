@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+	"github.com/reconquest/notify-telegram-bot/internal/transport"
+
+	karma "github.com/reconquest/karma-go"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// authorize is called by the transport before every command handler.
+func (coordinator *Coordinator) authorize(cmd string, message *tb.Message) error {
+	// documents without /import caption are not commands
+	if cmd == tb.OnDocument && !isImportDocument(message) {
+		return nil
+	}
+
+	if message.Sender == nil {
+		var locale i18n.Locale
+		if message.Chat != nil {
+			locale = coordinator.getChatLocale(message.Chat.ID, nil)
+		}
+
+		return transport.AccessDenied(
+			locale.Translate("Anonymous messages are not allowed"),
+		)
+	}
+
+	locale := coordinator.getLocale(message)
+
+	if coordinator.isBotAdmin(message.Sender.ID) {
+		return nil
+	}
+
+	if !coordinator.isAllowed(message.Sender.ID, message.Chat) {
+		return transport.AccessDenied(
+			locale.Translate("You are not allowed to use this bot"),
+		)
+	}
+
+	if coordinator.isManagingCommand(cmd) && message.FromGroup() {
+		admin, err := coordinator.transport.IsChatAdmin(
+			message.Chat,
+			message.Sender,
+		)
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to get member %d of chat %d",
+				message.Sender.ID, message.Chat.ID,
+			)
+		}
+
+		if !admin {
+			return transport.AccessDenied(locale.Translate(
+				"Only chat admins can change subscriptions of this chat",
+			))
+		}
+	}
+
+	return nil
+}
+
+// isManagingCommand tells whether the command changes subscriptions of the
+// chat, documents with /import caption do too.
+func (coordinator *Coordinator) isManagingCommand(cmd string) bool {
+	if cmd == tb.OnDocument {
+		return true
+	}
+
+	if !strings.HasPrefix(cmd, "/") {
+		return false
+	}
+
+	command, ok := coordinator.findCommand(cmd)
+	return ok && command.Managing
+}
+
+func (coordinator *Coordinator) isBotAdmin(userID int) bool {
+	for _, id := range coordinator.config.Access.Admins {
+		if id == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAllowed reports whether the user or the chat is in the allowlists,
+// everyone is allowed if both lists are empty.
+func (coordinator *Coordinator) isAllowed(userID int, chat *tb.Chat) bool {
+	access := coordinator.config.Access
+	if len(access.Users) == 0 && len(access.Chats) == 0 {
+		return true
+	}
+
+	for _, id := range access.Users {
+		if id == userID {
+			return true
+		}
+	}
+
+	if chat != nil {
+		for _, id := range access.Chats {
+			if id == chat.ID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/reconquest/notify-telegram-bot/internal/transport"
+
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func Test_authorize_ChecksAllowlists(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.Access = AccessConfig{
+		Users:  []int{1},
+		Chats:  []int64{-100},
+		Admins: []int{9},
+	}
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	assert.NoError(t, coordinator.authorize("/list", createMessage("", "", "", 1, 1)))
+	assert.NoError(t, coordinator.authorize("/list", createMessage("", "", "", 2, -100)))
+	assert.NoError(t, coordinator.authorize("/list", createMessage("", "", "", 9, 9)))
+
+	err = coordinator.authorize("/subscribe", createMessage("", "", "", 2, 2))
+	assert.Equal(t, transport.AccessDenied("You are not allowed to use this bot"), err)
+
+	document := createMessage("", "", "", 2, 2)
+	document.Document = &tb.Document{}
+	assert.NoError(t, coordinator.authorize(tb.OnDocument, document))
+
+	document.Caption = "/import"
+	assert.Error(t, coordinator.authorize(tb.OnDocument, document))
+}
+
+func Test_authorize_RequiresChatAdminInGroups(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.Access = AccessConfig{Admins: []int{9}}
+
+	telegramBot := NewTestBot()
+	telegramBot.chatAdmins = map[int]bool{1: true}
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	group := func(userID int) *tb.Message {
+		message := createMessage("", "", "", userID, -100)
+		message.Chat.Type = tb.ChatGroup
+		return message
+	}
+
+	assert.NoError(t, coordinator.authorize("/subscribe", group(1)))
+	assert.NoError(t, coordinator.authorize("/subscribe", group(9)))
+	assert.NoError(t, coordinator.authorize("/list", group(2)))
+
+	err = coordinator.authorize("/unsubscribe", group(2))
+	assert.Equal(
+		t,
+		transport.AccessDenied("Only chat admins can change subscriptions of this chat"),
+		err,
+	)
+
+	for _, command := range coordinator.commands() {
+		err := coordinator.authorize("/"+command.Name, group(2))
+		assert.Equal(t, command.Managing, err != nil, command.Name)
+	}
+
+	document := group(2)
+	document.Document = &tb.Document{}
+	document.Caption = "/import"
+	assert.Error(t, coordinator.authorize(tb.OnDocument, document))
+
+	// private chats belong to the sender
+	assert.NoError(t, coordinator.authorize("/subscribe", createMessage("", "", "", 2, 2)))
+}
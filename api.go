@@ -0,0 +1,499 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reconquest/pkg/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type apiSubscription struct {
+	ID             string    `json:"id"`
+	ChatID         int64     `json:"chat_id"`
+	URL            string    `json:"url"`
+	Duration       string    `json:"duration"`
+	Keys           string    `json:"keys,omitempty"`
+	Kind           string    `json:"kind,omitempty"`
+	Paused         bool      `json:"paused"`
+	Disabled       bool      `json:"disabled"`
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+	SendAt         time.Time `json:"send_at"`
+	Managed        bool      `json:"managed"`
+}
+
+type apiEndpoint struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Duration   string    `json:"duration"`
+	RefreshAt  time.Time `json:"refresh_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Response   bool      `json:"response"`
+	Up         bool      `json:"up"`
+	Failures   int       `json:"failures"`
+	LastError  string    `json:"last_error,omitempty"`
+	StatusCode int       `json:"status_code"`
+	Latency    string    `json:"latency"`
+}
+
+// apiSubscriptionRequest is used for both creating and updating, only
+// duration and keys can be changed for an existing subscription.
+type apiSubscriptionRequest struct {
+	ChatID   int64  `json:"chat_id"`
+	URL      string `json:"url"`
+	Duration string `json:"duration"`
+	Keys     string `json:"keys"`
+	Kind     string `json:"kind"`
+}
+
+func (coordinator *Coordinator) newAPISubscription(
+	subscriber Subscriber,
+) apiSubscription {
+	return apiSubscription{
+		ID:             subscriber.ID.Hex(),
+		ChatID:         getSubscriberChatID(subscriber),
+		URL:            coordinator.getSubscriptionURL(subscriber),
+		Duration:       subscriber.Duration.String(),
+		Keys:           strings.Join(subscriber.Keys, ","),
+		Kind:           subscriber.Kind,
+		Paused:         subscriber.Paused,
+		Disabled:       subscriber.Disabled,
+		DisabledReason: subscriber.DisabledReason,
+		SendAt:         subscriber.SendAt,
+		Managed:        subscriber.Managed,
+	}
+}
+
+func newAPIEndpoint(endpoint Endpoint) apiEndpoint {
+	return apiEndpoint{
+		ID:         endpoint.ID.Hex(),
+		URL:        endpoint.URL,
+		Duration:   endpoint.Duration.String(),
+		RefreshAt:  endpoint.RefreshAt,
+		UpdatedAt:  endpoint.UpdatedAt,
+		Response:   endpoint.Response,
+		Up:         endpoint.Up,
+		Failures:   endpoint.Failures,
+		LastError:  endpoint.LastError,
+		StatusCode: endpoint.StatusCode,
+		Latency:    endpoint.Latency.String(),
+	}
+}
+
+func getSubscriberChatID(subscriber Subscriber) int64 {
+	if subscriber.Chat != nil {
+		return subscriber.Chat.ID
+	}
+
+	if subscriber.Sender != nil {
+		return int64(subscriber.Sender.ID)
+	}
+
+	return int64(subscriber.UserID)
+}
+
+func (coordinator *Coordinator) authorizeAPI(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + coordinator.config.API.Token)
+
+	return http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			actual := []byte(request.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(actual, expected) != 1 {
+				writeError(writer, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			next.ServeHTTP(writer, request)
+		},
+	)
+}
+
+// serveAPI routes requests to:
+//
+//	GET    /api/subscriptions[?chat_id=]
+//	POST   /api/subscriptions
+//	GET    /api/subscriptions/<id>
+//	PATCH  /api/subscriptions/<id>
+//	DELETE /api/subscriptions/<id>
+//	POST   /api/subscriptions/<id>/pause
+//	POST   /api/subscriptions/<id>/resume
+//	GET    /api/endpoints
+//	DELETE /api/endpoints/<id>
+//	POST   /api/endpoints/<id>/refresh
+//	POST   /api/refresh
+func (coordinator *Coordinator) serveAPI(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	path := strings.Trim(strings.TrimPrefix(request.URL.Path, "/api/"), "/")
+	parts := strings.Split(path, "/")
+
+	route := request.Method + " " + parts[0]
+	if len(parts) > 1 {
+		route += "/*"
+	}
+
+	if len(parts) > 2 {
+		route += "/" + parts[2]
+	}
+
+	var id primitive.ObjectID
+	if len(parts) > 1 {
+		var err error
+		id, err = primitive.ObjectIDFromHex(parts[1])
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "invalid id")
+			return
+		}
+	}
+
+	switch route {
+	case "GET subscriptions":
+		coordinator.apiListSubscriptions(writer, request)
+	case "POST subscriptions":
+		coordinator.apiCreateSubscription(writer, request)
+	case "GET subscriptions/*":
+		coordinator.apiGetSubscription(writer, id)
+	case "PATCH subscriptions/*":
+		coordinator.apiUpdateSubscription(writer, request, id)
+	case "DELETE subscriptions/*":
+		coordinator.apiDeleteSubscription(writer, id)
+	case "POST subscriptions/*/pause":
+		coordinator.apiPauseSubscription(writer, id, true)
+	case "POST subscriptions/*/resume":
+		coordinator.apiPauseSubscription(writer, id, false)
+	case "GET endpoints":
+		coordinator.apiListEndpoints(writer)
+	case "DELETE endpoints/*":
+		coordinator.apiDeleteEndpoint(writer, id)
+	case "POST endpoints/*/refresh":
+		coordinator.apiRefresh(writer, &id)
+	case "POST refresh":
+		coordinator.apiRefresh(writer, nil)
+	default:
+		writeError(writer, http.StatusNotFound, "not found")
+	}
+}
+
+func (coordinator *Coordinator) findAPISubscription(
+	writer http.ResponseWriter,
+	id primitive.ObjectID,
+) *Subscriber {
+	subscriber, err := coordinator.database.getSubscription(id)
+	if err != nil {
+		log.Errorf(err, "unable to find subscription: %s", id.Hex())
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return nil
+	}
+
+	if subscriber == nil {
+		writeError(writer, http.StatusNotFound, "subscription not found")
+		return nil
+	}
+
+	return subscriber
+}
+
+func (coordinator *Coordinator) apiListSubscriptions(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	var chatID int
+	if value := request.URL.Query().Get("chat_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "invalid chat_id")
+			return
+		}
+
+		chatID = id
+	}
+
+	var subscribers []Subscriber
+	var err error
+	if chatID != 0 {
+		subscribers, err = coordinator.database.findChatSubscriptions(chatID)
+	} else {
+		subscribers, err = coordinator.database.listSubscriptions()
+	}
+	if err != nil {
+		log.Errorf(err, "unable to list subscriptions")
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	result := []apiSubscription{}
+	for _, subscriber := range subscribers {
+		result = append(result, coordinator.newAPISubscription(subscriber))
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (coordinator *Coordinator) apiGetSubscription(
+	writer http.ResponseWriter,
+	id primitive.ObjectID,
+) {
+	subscriber := coordinator.findAPISubscription(writer, id)
+	if subscriber == nil {
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, coordinator.newAPISubscription(*subscriber))
+}
+
+func (coordinator *Coordinator) apiCreateSubscription(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	var payload apiSubscriptionRequest
+	err := json.NewDecoder(request.Body).Decode(&payload)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid json: "+err.Error())
+		return
+	}
+
+	if payload.ChatID == 0 {
+		writeError(writer, http.StatusBadRequest, "chat_id is required")
+		return
+	}
+
+	// webhook urls are always generated by the bot
+	if payload.Kind == SubscriptionWebhook {
+		payload.URL = ""
+	}
+
+	subscriber := Subscriber{
+		URL:    payload.URL,
+		UserID: int(payload.ChatID),
+		Chat:   &tb.Chat{ID: payload.ChatID},
+		Keys:   parseKeys(payload.Keys),
+		Kind:   payload.Kind,
+	}
+
+	coordinator.apiSaveSubscription(writer, subscriber, payload.Duration)
+}
+
+func (coordinator *Coordinator) apiUpdateSubscription(
+	writer http.ResponseWriter,
+	request *http.Request,
+	id primitive.ObjectID,
+) {
+	subscriber := coordinator.findAPISubscription(writer, id)
+	if subscriber == nil {
+		return
+	}
+
+	if subscriber.Managed {
+		writeError(
+			writer,
+			http.StatusConflict,
+			"subscription is managed by config",
+		)
+		return
+	}
+
+	payload := apiSubscriptionRequest{
+		Duration: subscriber.Duration.String(),
+		Keys:     strings.Join(subscriber.Keys, ","),
+	}
+
+	err := json.NewDecoder(request.Body).Decode(&payload)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid json: "+err.Error())
+		return
+	}
+
+	subscriber.Keys = parseKeys(payload.Keys)
+
+	coordinator.apiSaveSubscription(writer, *subscriber, payload.Duration)
+}
+
+func (coordinator *Coordinator) apiSaveSubscription(
+	writer http.ResponseWriter,
+	subscriber Subscriber,
+	duration string,
+) {
+	err := coordinator.prepareSubscription(&subscriber, duration)
+	if err == nil {
+		err = coordinator.checkSubscriptionsQuota([]Subscriber{subscriber})
+	}
+	if err != nil {
+		if _, ok := err.(validationError); ok {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		log.Error(err)
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	err = coordinator.saveSubscription(subscriber)
+	if err != nil {
+		log.Errorf(err, "unable to save subscription: %s", subscriber.URL)
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	saved, err := coordinator.database.findSubscriber(
+		subscriber.UserID,
+		subscriber.URL,
+	)
+	if err != nil || saved == nil {
+		log.Errorf(err, "unable to find saved subscription: %s", subscriber.URL)
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, coordinator.newAPISubscription(*saved))
+}
+
+func (coordinator *Coordinator) apiDeleteSubscription(
+	writer http.ResponseWriter,
+	id primitive.ObjectID,
+) {
+	subscriber := coordinator.findAPISubscription(writer, id)
+	if subscriber == nil {
+		return
+	}
+
+	if subscriber.Managed {
+		writeError(
+			writer,
+			http.StatusConflict,
+			"subscription is managed by config",
+		)
+		return
+	}
+
+	// unused endpoints are removed by routineCleanEndpoints
+	err := coordinator.database.RemoveSubscription(id)
+	if err != nil {
+		log.Errorf(err, "unable to remove subscription: %s", id.Hex())
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (coordinator *Coordinator) apiPauseSubscription(
+	writer http.ResponseWriter,
+	id primitive.ObjectID,
+	paused bool,
+) {
+	subscriber := coordinator.findAPISubscription(writer, id)
+	if subscriber == nil {
+		return
+	}
+
+	err := coordinator.database.setSubscriberPaused(id, paused)
+	if err != nil {
+		log.Errorf(err, "unable to pause subscription: %s", id.Hex())
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	subscriber.Paused = paused
+
+	writeJSON(writer, http.StatusOK, coordinator.newAPISubscription(*subscriber))
+}
+
+func (coordinator *Coordinator) apiListEndpoints(writer http.ResponseWriter) {
+	endpoints, err := coordinator.database.listEndpoints()
+	if err != nil {
+		log.Errorf(err, "unable to list endpoints")
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	result := []apiEndpoint{}
+	for _, endpoint := range endpoints {
+		result = append(result, newAPIEndpoint(endpoint))
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+// apiDeleteEndpoint removes the endpoint along with its subscriptions,
+// otherwise they would be left without data. Endpoints of subscriptions
+// managed by config are kept.
+func (coordinator *Coordinator) apiDeleteEndpoint(
+	writer http.ResponseWriter,
+	id primitive.ObjectID,
+) {
+	endpoint, err := coordinator.database.getEndpoint(id)
+	if err != nil {
+		log.Errorf(err, "unable to find endpoint: %s", id.Hex())
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if endpoint == nil {
+		writeError(writer, http.StatusNotFound, "endpoint not found")
+		return
+	}
+
+	subscribers, err := coordinator.database.listSubscriptions()
+	if err != nil {
+		log.Errorf(err, "unable to list subscriptions")
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	for _, subscriber := range subscribers {
+		if subscriber.Managed &&
+			subscriber.URL == endpoint.URL &&
+			subscriber.Duration == endpoint.Duration {
+			writeError(
+				writer,
+				http.StatusConflict,
+				"endpoint has subscriptions managed by config",
+			)
+			return
+		}
+	}
+
+	err = coordinator.database.removeEndpointSubscriptions(*endpoint)
+	if err != nil {
+		log.Errorf(err, "unable to remove subscriptions of endpoint: %s", id.Hex())
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	err = coordinator.database.RemoveEndpoint(id)
+	if err != nil {
+		log.Errorf(err, "unable to remove endpoint: %s", id.Hex())
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// apiRefresh schedules refresh of the endpoint or all endpoints if id is nil.
+func (coordinator *Coordinator) apiRefresh(
+	writer http.ResponseWriter,
+	id *primitive.ObjectID,
+) {
+	var count int64
+	var err error
+	if id != nil {
+		count, err = coordinator.database.refreshEndpoint(*id, coordinator.clock.Now())
+	} else {
+		count, err = coordinator.database.refreshAllEndpoints(coordinator.clock.Now())
+	}
+	if err != nil {
+		log.Errorf(err, "unable to refresh endpoints")
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, map[string]int64{"endpoints": count})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func Test_API_RejectsRequestsWithoutToken(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.API.Token = "secret"
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	server := httptest.NewServer(coordinator.newHTTPHandler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/api/subscriptions")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	request, err := http.NewRequest("GET", server.URL+"/api/unknown", nil)
+	assert.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer secret")
+
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, err = http.Get(server.URL + "/metrics")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	request, err = http.NewRequest("GET", server.URL+"/metrics", nil)
+	assert.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer secret")
+
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func Test_API_ManagesSubscriptions(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.API.Token = "secret"
+	config.Quota.MaxSubscriptions = 2
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+	coordinator.clock = newFakeClock()
+
+	for _, url := range []string{"http://127.0.0.1:1/a", "http://127.0.0.1:1/m"} {
+		err = coordinator.saveSubscription(Subscriber{
+			URL:      url,
+			UserID:   2,
+			Chat:     &tb.Chat{ID: 2},
+			Keys:     []string{"a"},
+			Duration: time.Minute,
+		})
+		assert.NoError(t, err)
+	}
+
+	subscriber, err := coordinator.database.findSubscriber(2, "http://127.0.0.1:1/a")
+	assert.NoError(t, err)
+
+	managed, err := coordinator.database.findSubscriber(2, "http://127.0.0.1:1/m")
+	assert.NoError(t, err)
+
+	err = coordinator.database.setSubscriberManaged(managed.ID, "")
+	assert.NoError(t, err)
+
+	endpoint, err := coordinator.database.findSubscriberEndpoint(*managed)
+	assert.NoError(t, err)
+
+	own, err := coordinator.database.findSubscriberEndpoint(*subscriber)
+	assert.NoError(t, err)
+
+	id := subscriber.ID.Hex()
+	unknown := primitive.NewObjectID().Hex()
+
+	testcases := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		response string
+	}{
+		{"GET", "/api/subscriptions", "", 200, `"url":"http://127.0.0.1:1/a"`},
+		{"GET", "/api/subscriptions?chat_id=3", "", 200, `[]`},
+		{"GET", "/api/subscriptions?chat_id=x", "", 400, `invalid chat_id`},
+		{"GET", "/api/subscriptions/" + id, "", 200, `"id":"` + id + `"`},
+		{"GET", "/api/subscriptions/x", "", 400, `invalid id`},
+		{"GET", "/api/subscriptions/" + unknown, "", 404, `subscription not found`},
+
+		{"POST", "/api/subscriptions", `{`, 400, `invalid json`},
+		{
+			"POST", "/api/subscriptions",
+			`{"url": "http://127.0.0.1:1/b"}`,
+			400, `chat_id is required`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 3, "url": "b", "keys": "a", "duration": "1m"}`,
+			400, `invalid url`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 3, "url": "http://127.0.0.1:1/b", "duration": "1m"}`,
+			400, `keys are required`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 3, "url": "http://127.0.0.1:1/b", "keys": "a", "duration": "x"}`,
+			400, `invalid duration`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 3, "url": "http://127.0.0.1:1/b", "keys": "a", "duration": "10ms"}`,
+			400, `interval must be at least 1s`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 3, "url": "http://127.0.0.1:1/b", "keys": "a", "duration": "1m", "kind": "x"}`,
+			400, `unknown kind`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 2, "url": "http://127.0.0.1:1/b", "keys": "a", "duration": "1m"}`,
+			400, `a chat can't have more than 2 subscriptions`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 3, "url": "http://127.0.0.1:1/b", "keys": "a,b", "duration": "1m"}`,
+			200, `"keys":"a,b"`,
+		},
+		{
+			"POST", "/api/subscriptions",
+			`{"chat_id": 3, "kind": "webhook", "keys": "a"}`,
+			200, `"kind":"webhook"`,
+		},
+
+		{"PATCH", "/api/subscriptions/" + id, `{"keys": "b"}`, 200, `"keys":"b"`},
+		{
+			"PATCH", "/api/subscriptions/" + id,
+			`{"duration": "x"}`,
+			400, `invalid duration`,
+		},
+		{
+			"PATCH", "/api/subscriptions/" + unknown,
+			`{}`,
+			404, `subscription not found`,
+		},
+		{
+			"PATCH", "/api/subscriptions/" + managed.ID.Hex(),
+			`{"keys": "b"}`,
+			409, `subscription is managed by config`,
+		},
+		{"POST", "/api/subscriptions/" + id + "/pause", "", 200, `"paused":true`},
+		{"POST", "/api/subscriptions/" + id + "/resume", "", 200, `"paused":false`},
+
+		{
+			"DELETE", "/api/subscriptions/" + managed.ID.Hex(),
+			"",
+			409, `subscription is managed by config`,
+		},
+		{"DELETE", "/api/subscriptions/" + id, "", 204, ``},
+		{"DELETE", "/api/subscriptions/" + id, "", 404, `subscription not found`},
+
+		{"GET", "/api/endpoints", "", 200, `"url":"http://127.0.0.1:1/m"`},
+		{
+			"POST", "/api/endpoints/" + endpoint.ID.Hex() + "/refresh",
+			"",
+			200, `{"endpoints":1}`,
+		},
+		{"POST", "/api/refresh", "", 200, `{"endpoints":4}`},
+		{"DELETE", "/api/endpoints/" + unknown, "", 404, `endpoint not found`},
+		{
+			"DELETE", "/api/endpoints/" + endpoint.ID.Hex(),
+			"",
+			409, `endpoint has subscriptions managed by config`,
+		},
+		{
+			"GET", "/api/subscriptions/" + managed.ID.Hex(),
+			"",
+			200, `"keys":"a"`,
+		},
+		{"DELETE", "/api/endpoints/" + own.ID.Hex(), "", 204, ``},
+		{"GET", "/api/endpoints", "", 200, `"url":"http://127.0.0.1:1/m"`},
+		{"PUT", "/api/subscriptions", "", 404, `not found`},
+	}
+
+	handler := coordinator.newHTTPHandler()
+	for _, testcase := range testcases {
+		request := httptest.NewRequest(
+			testcase.method,
+			testcase.path,
+			strings.NewReader(testcase.body),
+		)
+		request.Header.Set("Authorization", "Bearer secret")
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		name := testcase.method + " " + testcase.path + " " + testcase.body
+		assert.Equal(t, testcase.status, recorder.Code, name)
+		assert.Contains(t, recorder.Body.String(), testcase.response, name)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+)
+
+// subscribers are warned once for every threshold, in days before expiry
+var certificateWarnings = []int{30, 14, 7, 1}
+
+func getCertificateWarning(expiresAt time.Time, now time.Time) int {
+	if expiresAt.IsZero() {
+		return 0
+	}
+
+	left := expiresAt.Sub(now)
+
+	warning := 0
+	for _, days := range certificateWarnings {
+		if left <= time.Duration(days)*24*time.Hour {
+			warning = days
+		}
+	}
+
+	return warning
+}
+
+func (coordinator *Coordinator) checkCertificateExpiry(
+	subscriber Subscriber,
+	endpoint Endpoint,
+) error {
+	// expiry is unknown until the url responds over tls
+	if endpoint.CertExpiresAt.IsZero() {
+		return nil
+	}
+
+	now := coordinator.clock.Now()
+	warning := getCertificateWarning(endpoint.CertExpiresAt, now)
+
+	if warning == subscriber.CertWarned {
+		return nil
+	}
+
+	// certificate was renewed and expires later than the one subscribers
+	// were warned about
+	if warning == 0 ||
+		(subscriber.CertWarned != 0 && warning > subscriber.CertWarned) {
+		return coordinator.database.setSubscriberCertWarned(
+			subscriber.ID,
+			warning,
+		)
+	}
+
+	locale := coordinator.getSubscriberLocale(subscriber)
+
+	left := endpoint.CertExpiresAt.Sub(now)
+	message := locale.Sprintf(
+		"TLS certificate expires in %d days, on %s",
+		int(left.Hours()/24),
+		locale.FormatTime(endpoint.CertExpiresAt),
+	)
+	if left <= 0 {
+		message = locale.Translate("TLS certificate has expired!")
+	}
+
+	err := coordinator.enqueueMessage(
+		int64(subscriber.RecipientID),
+		fmt.Sprintf(
+			"\nID - %s\nURL - %s\n\n%s",
+			subscriber.ID.Hex(),
+			subscriber.URL,
+			message,
+		),
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to enqueue message to user: %d",
+			subscriber.RecipientID,
+		)
+	}
+
+	return coordinator.database.setSubscriberCertWarned(subscriber.ID, warning)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func Test_getCertificateWarning_ReturnsSmallestPassedThreshold(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	assert.Equal(t, 0, getCertificateWarning(time.Time{}, now))
+	assert.Equal(t, 0, getCertificateWarning(now.Add(45*day), now))
+	assert.Equal(t, 30, getCertificateWarning(now.Add(20*day), now))
+	assert.Equal(t, 14, getCertificateWarning(now.Add(14*day), now))
+	assert.Equal(t, 7, getCertificateWarning(now.Add(3*day), now))
+	assert.Equal(t, 1, getCertificateWarning(now.Add(time.Hour), now))
+	assert.Equal(t, 1, getCertificateWarning(now.Add(-day), now))
+}
+
+func Test_Coordinator_WarnsAboutCertificateExpiryOnce(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	day := 24 * time.Hour
+
+	err = coordinator.database.writeEndpoint(&Endpoint{
+		URL:           "https://example.com/",
+		Duration:      time.Minute,
+		RefreshAt:     clock.Now().Add(time.Hour),
+		Up:            true,
+		StatusCode:    200,
+		CertExpiresAt: clock.Now().Add(20 * day),
+	})
+	assert.NoError(t, err)
+
+	err = coordinator.database.upsertSubscriber(Subscriber{
+		URL:      "https://example.com/",
+		UserID:   2,
+		Duration: time.Minute,
+		Chat:     &tb.Chat{ID: 2},
+		Kind:     SubscriptionUptime,
+	})
+	assert.NoError(t, err)
+
+	var warnings []string
+	tick := func(duration time.Duration) {
+		clock.Advance(duration)
+		assert.NoError(t, coordinator.routineSendDataToSubscribers())
+		assert.NoError(t, coordinator.routineSendOutbox())
+
+		warnings = nil
+		for _, message := range telegramBot.allSentMessages {
+			if strings.Contains(message, "TLS certificate") {
+				warnings = append(warnings, message)
+			}
+		}
+	}
+
+	tick(time.Second)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "TLS certificate expires in 19 days")
+
+	tick(2 * time.Minute)
+	assert.Len(t, warnings, 1)
+
+	// the url is down for a while, its certificate is still the same
+	endpoint, err := coordinator.database.findEndpoint("https://example.com/")
+	assert.NoError(t, err)
+
+	err = coordinator.updateEndpointFailure(
+		*endpoint,
+		nil,
+		errors.New("connection refused"),
+	)
+	assert.NoError(t, err)
+
+	tick(2 * time.Minute)
+	assert.Len(t, warnings, 1)
+
+	tick(7 * day)
+	assert.Len(t, warnings, 2)
+	assert.Contains(t, warnings[1], "TLS certificate expires in 12 days")
+
+	// renewed certificate resets warnings without a message
+	endpoint, err = coordinator.database.findEndpoint("https://example.com/")
+	assert.NoError(t, err)
+
+	endpoint.CertExpiresAt = clock.Now().Add(90 * day)
+	err = coordinator.database.saveEndpointFetch(*endpoint, endpoint.RefreshAt)
+	assert.NoError(t, err)
+
+	tick(2 * time.Minute)
+	assert.Len(t, warnings, 2)
+
+	subscriber, err := coordinator.database.findSubscriber(2, endpoint.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, subscriber.CertWarned)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+)
+
+// ChatSettings are preferences of a chat set by its commands, chats without
+// settings use defaults.
+type ChatSettings struct {
+	ChatID int64 `bson:"chat_id"`
+
+	// Language is chosen by /language, if it's empty the language of the
+	// user's Telegram client is used
+	Language string `bson:"language"`
+
+	// Timezone is a name from the tz database chosen by /timezone, if it's
+	// empty the timezone from config is used
+	Timezone string `bson:"timezone"`
+}
+
+// migrateChat moves subscriptions and pending messages of a group to the new
+// chat identifier after the group was upgraded to a supergroup.
+func (coordinator *Coordinator) migrateChat(from, to int64) error {
+	log.Infof(nil, "chat %d was migrated to %d", from, to)
+
+	err := coordinator.database.migrateSubscriptions(from, to)
+	if err != nil {
+		return karma.Format(err, "unable to migrate subscriptions")
+	}
+
+	err = coordinator.database.migrateOutboxMessages(from, to)
+	if err != nil {
+		return karma.Format(err, "unable to migrate outbox messages")
+	}
+
+	err = coordinator.database.migrateChatSettings(from, to)
+	if err != nil {
+		return karma.Format(err, "unable to migrate chat settings")
+	}
+
+	return nil
+}
+
+// disableChat stops notifications for a chat which blocked or kicked the
+// bot, subscriptions are enabled again when the chat sends /start.
+func (coordinator *Coordinator) disableChat(chatID int64, reason error) error {
+	log.Infof(nil, "chat %d is unreachable, disabling subscriptions: %s",
+		chatID, reason)
+
+	err := coordinator.database.disableSubscriptions(chatID, reason.Error())
+	if err != nil {
+		return karma.Format(err, "unable to disable subscriptions")
+	}
+
+	err = coordinator.database.buryChatOutboxMessages(chatID, reason)
+	if err != nil {
+		return karma.Format(err, "unable to remove outbox messages")
+	}
+
+	return nil
+}
+
+func (database *Database) ensureChatsIndexes() error {
+	_, err := database.Chats.Indexes().CreateOne(
+		database.context,
+		mongo.IndexModel{
+			Keys: bsonx.Doc{
+				{Key: "chat_id", Value: bsonx.Int32(1)},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (database *Database) getChatSettings(chatID int64) (*ChatSettings, error) {
+	var settings ChatSettings
+	err := database.Chats.FindOne(
+		database.context,
+		bson.M{"chat_id": chatID},
+	).Decode(&settings)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, karma.Format(
+			err,
+			"can't decode data from %s collection, chat_id: %d",
+			database.Chats.Name(),
+			chatID,
+		)
+	}
+
+	return &settings, nil
+}
+
+func (database *Database) setChatLanguage(chatID int64, language string) error {
+	upsert := true
+	_, err := database.Chats.UpdateOne(
+		database.context,
+		bson.M{"chat_id": chatID},
+		bson.M{"$set": bson.M{"language": language}},
+		&options.UpdateOptions{
+			Upsert: &upsert,
+		},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to set language of chat %d",
+			chatID,
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) setChatTimezone(chatID int64, timezone string) error {
+	upsert := true
+	_, err := database.Chats.UpdateOne(
+		database.context,
+		bson.M{"chat_id": chatID},
+		bson.M{"$set": bson.M{"timezone": timezone}},
+		&options.UpdateOptions{
+			Upsert: &upsert,
+		},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to set timezone of chat %d",
+			chatID,
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) migrateChatSettings(from, to int64) error {
+	settings, err := database.getChatSettings(from)
+	if err != nil || settings == nil {
+		return err
+	}
+
+	// settings of the new chat are replaced, chat_id is unique
+	_, err = database.Chats.DeleteOne(
+		database.context,
+		bson.M{"chat_id": to},
+	)
+	if err != nil {
+		return karma.Format(err, "unable to remove settings of chat %d", to)
+	}
+
+	_, err = database.Chats.UpdateOne(
+		database.context,
+		bson.M{"chat_id": from},
+		bson.M{"$set": bson.M{"chat_id": to}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to migrate settings from chat %d to %d",
+			from, to,
+		)
+	}
+
+	return nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	karma "github.com/reconquest/karma-go"
@@ -36,7 +35,7 @@ func (coordinator *Coordinator) routineCleanEndpoints() error {
 
 func (coordinator *Coordinator) getUnusedEndpointsIDs() (
 	[]primitive.ObjectID, error) {
-	subscribers, err := coordinator.database.FindInSubscriptions(bson.M{})
+	subscribers, err := coordinator.database.listSubscriptions()
 	if err != nil {
 		return nil, karma.Format(
 			err,
@@ -44,7 +43,7 @@ func (coordinator *Coordinator) getUnusedEndpointsIDs() (
 		)
 	}
 
-	endpoints, err := coordinator.database.FindInEndpoints(bson.M{})
+	endpoints, err := coordinator.database.listEndpoints()
 	if err != nil {
 		return nil, karma.Format(
 			err,
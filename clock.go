@@ -0,0 +1,20 @@
+package main
+
+import "time"
+
+// Clock tells the current time, tests replace it to move time forward
+// without sleeping. Delays computed from Now are waited out with Sleep.
+type Clock interface {
+	Now() time.Time
+	Sleep(duration time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(duration time.Duration) {
+	time.Sleep(duration)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+	"github.com/reconquest/notify-telegram-bot/internal/transport"
+
+	karma "github.com/reconquest/karma-go"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// Command describes a command of the bot, the registry of commands is used
+// to register handlers, fill the command menu of Telegram and write /help.
+// Args, Description and Details are translated, examples are not.
+type Command struct {
+	Name        string
+	Args        string
+	Description string
+	Details     string
+	Examples    []string
+	Handler     func(*tb.Message) error
+
+	// Managing commands change subscriptions or settings of the chat, in
+	// groups only chat admins can run them
+	Managing bool
+}
+
+// Usage returns the command with its arguments, like /status subscriptionID.
+func (command Command) Usage(locale i18n.Locale) string {
+	usage := "/" + command.Name
+	if command.Args != "" {
+		usage += " " + locale.Translate(command.Args)
+	}
+
+	return usage
+}
+
+// commands returns all commands of the bot in the order they are shown in
+// /help and in the command menu.
+func (coordinator *Coordinator) commands() []Command {
+	return []Command{
+		{
+			Name:        "start",
+			Description: "start bot",
+			Handler:     coordinator.start,
+		},
+		{
+			Name:        "help",
+			Args:        "[command]",
+			Description: "show commands or usage of one command",
+			Examples:    []string{"/help subscribe"},
+			Handler:     coordinator.help,
+		},
+		{
+			Name:        "list",
+			Description: "show list with your subscriptions",
+			Handler:     coordinator.list,
+		},
+		{
+			Name:        "subscribe",
+			Args:        "url duration json-key.nested-key,second-key",
+			Description: "notify about changes of json keys",
+			Details: "The url is requested every duration, like 30s, 5m or 1h. " +
+				"Nested keys are separated by dots, several keys by commas. " +
+				"Keys with spaces are written in quotes. Subscribing to the same " +
+				"url and keys again changes the duration. The command has no " +
+				"name=value options.",
+			Examples: []string{
+				"/subscribe http://time.jsontest.com/ 1h date,time",
+				"/subscribe https://api.example.com/status 5m service.status",
+				"/subscribe https://api.example.com/sales 1h \"total sales,region\"",
+			},
+			Handler:  coordinator.subscribe,
+			Managing: true,
+		},
+		{
+			Name:        "unsubscribe",
+			Args:        "subscriptionID",
+			Description: "unsubscribe from one selected subscription",
+			Details:     "Subscription IDs are shown by /list.",
+			Examples:    []string{"/unsubscribe 5e7891f34940ad7f3746e2dd"},
+			Handler:     coordinator.unsubscribe,
+			Managing:    true,
+		},
+		{
+			Name:        "stop",
+			Description: "unsubscribe from all subscriptions",
+			Details: "Subscriptions declared in the configuration file are " +
+				"kept.",
+			Handler:  coordinator.stop,
+			Managing: true,
+		},
+		{
+			Name:        "uptime",
+			Args:        "url duration",
+			Description: "notify only when url goes up or down",
+			Details: "The response doesn't have to be json, only the " +
+				"availability and the status code are checked.",
+			Examples: []string{"/uptime https://example.com/ 1m"},
+			Handler:  coordinator.uptime,
+			Managing: true,
+		},
+		{
+			Name:        "status",
+			Args:        "subscriptionID",
+			Description: "show url status and uptime",
+			Examples:    []string{"/status 5e7891f34940ad7f3746e2dd"},
+			Handler:     coordinator.status,
+		},
+		{
+			Name:        "get",
+			Args:        "subscriptionID",
+			Description: "show current values of subscription keys",
+			Details: "Values are taken from the latest response of the url, " +
+				"it is not requested again.",
+			Examples: []string{"/get 5e7891f34940ad7f3746e2dd"},
+			Handler:  coordinator.get,
+		},
+		{
+			Name:        "peek",
+			Args:        "url [json-key.nested-key,second-key]",
+			Description: "request url once and show its keys or values",
+			Details: "Without keys the top-level keys of the response are " +
+				"shown, it helps to find keys before subscribing.",
+			Examples: []string{
+				"/peek http://time.jsontest.com/",
+				"/peek http://time.jsontest.com/ date,time",
+			},
+			Handler: coordinator.peek,
+		},
+		{
+			Name:        "keys",
+			Args:        "url|subscriptionID",
+			Description: "browse json keys of url",
+			Details: "Objects are opened by buttons. If the chat is " +
+				"subscribed to the url, the selected key can be added to " +
+				"the subscription.",
+			Examples: []string{
+				"/keys http://time.jsontest.com/",
+				"/keys 5e7891f34940ad7f3746e2dd",
+			},
+			Handler: coordinator.keys,
+		},
+		{
+			Name: "filter",
+			Args: "subscriptionID [clear] [ignore=glob,glob] [round=N|off] " +
+				"[tolerance=X|off] [sort=on|off]",
+			Description: "show or change filters of noisy keys",
+			Details: "Changes of ignored keys are not notified, * matches a " +
+				"single key and globs without dots match keys at any depth. " +
+				"Numbers are rounded to N decimals and differences up to " +
+				"the tolerance from the last notified value are ignored, " +
+				"sorted arrays are equal if they have the same items in any " +
+				"order. clear removes all filters.",
+			Examples: []string{
+				"/filter 5e7891f34940ad7f3746e2dd ignore=*.timestamp,request_id",
+				"/filter 5e7891f34940ad7f3746e2dd round=1 tolerance=0.5 sort=on",
+				"/filter 5e7891f34940ad7f3746e2dd clear",
+			},
+			Handler:  coordinator.filter,
+			Managing: true,
+		},
+		{
+			Name:        "webhook",
+			Args:        "json-key.nested-key,second-key",
+			Description: "get url to push json data to instead of polling",
+			Details: "The first request is used as a baseline, you'll be " +
+				"notified about changes in the next ones.",
+			Examples: []string{"/webhook status,version"},
+			Handler:  coordinator.webhook,
+			Managing: true,
+		},
+		{
+			Name:        "quota",
+			Description: "show limits of subscriptions",
+			Handler:     coordinator.quota,
+		},
+		{
+			Name:        "export",
+			Args:        "[format=json|yaml]",
+			Description: "get your subscriptions as a document",
+			Details: "Send the document back with /import caption to " +
+				"restore the subscriptions.",
+			Examples: []string{"/export", "/export format=yaml"},
+			Handler:  coordinator.export,
+			// the document reveals webhook urls
+			Managing: true,
+		},
+		{
+			Name:        "language",
+			Args:        "[en|ru|auto]",
+			Description: "show or change the language of the bot",
+			Examples:    []string{"/language ru", "/language auto"},
+			Handler:     coordinator.language,
+			Managing:    true,
+		},
+		{
+			Name:        "timezone",
+			Args:        "[Europe/Berlin|default]",
+			Description: "show or change the timezone of dates",
+			Examples:    []string{"/timezone Europe/Berlin", "/timezone default"},
+			Handler:     coordinator.timezone,
+			Managing:    true,
+		},
+	}
+}
+
+func (coordinator *Coordinator) findCommand(name string) (Command, bool) {
+	name = strings.TrimPrefix(strings.ToLower(name), "/")
+
+	for _, command := range coordinator.commands() {
+		if command.Name == name {
+			return command, true
+		}
+	}
+
+	return Command{}, false
+}
+
+// getHelpText returns the list of all commands.
+func (coordinator *Coordinator) getHelpText(locale i18n.Locale) string {
+	paragraphs := []string{
+		locale.Translate(
+			"Hi! I am a telegram bot and I can notify you about all changes " +
+				"in any json data fields by url, if url unavailable I'll let " +
+				"you know. All commands in bot:",
+		),
+	}
+
+	for _, command := range coordinator.commands() {
+		paragraphs = append(
+			paragraphs,
+			command.Usage(locale)+" - "+locale.Translate(command.Description),
+		)
+	}
+
+	paragraphs = append(
+		paragraphs,
+		locale.Translate("Send /help <command> to see its usage and examples"),
+	)
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// getCommandHelpText returns the usage of one command with examples.
+func getCommandHelpText(locale i18n.Locale, command Command) string {
+	paragraphs := []string{
+		command.Usage(locale),
+		locale.Translate(command.Description),
+	}
+
+	if command.Details != "" {
+		paragraphs = append(paragraphs, locale.Translate(command.Details))
+	}
+
+	if len(command.Examples) > 0 {
+		paragraphs = append(
+			paragraphs,
+			locale.Translate("Examples:")+"\n"+
+				strings.Join(command.Examples, "\n"),
+		)
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// help shows all commands or the usage of the command given as payload.
+func (coordinator *Coordinator) help(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+
+	name := arguments.Get(0)
+	if name == "" {
+		return coordinator.sendReply(message, coordinator.getHelpText(locale))
+	}
+
+	command, ok := coordinator.findCommand(name)
+	if !ok {
+		return coordinator.sendReply(
+			message,
+			locale.Sprintf("Unknown command: %s, send /help to see all commands", name),
+		)
+	}
+
+	return coordinator.sendReply(message, getCommandHelpText(locale, command))
+}
+
+// getBotCommands returns the command menu in the given language.
+func (coordinator *Coordinator) getBotCommands(
+	language string,
+) []transport.BotCommand {
+	locale := i18n.NewLocale(language)
+
+	var commands []transport.BotCommand
+	for _, command := range coordinator.commands() {
+		commands = append(commands, transport.BotCommand{
+			Command:     command.Name,
+			Description: locale.Translate(command.Description),
+		})
+	}
+
+	return commands
+}
+
+// registerCommands registers handlers of all commands and fills the command
+// menu for every supported language, English is also the default menu.
+func (coordinator *Coordinator) registerCommands(bot *transport.Telegram) error {
+	for _, command := range coordinator.commands() {
+		bot.Handle("/"+command.Name, command.Handler)
+	}
+
+	languages := append([]string{""}, i18n.Languages...)
+	for _, language := range languages {
+		err := bot.SetCommands(language, coordinator.getBotCommands(language))
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to set command menu for language %q",
+				language,
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_WritesHelpFromCommands(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = ""
+
+	err = coordinator.help(message)
+	assert.NoError(t, err)
+	for _, command := range coordinator.commands() {
+		assert.Contains(t, telegramBot.lastSentMessage, "\n\n/"+command.Name)
+	}
+
+	assert.Contains(
+		t,
+		telegramBot.lastSentMessage,
+		"\n\nSend /help <command> to see its usage and examples",
+	)
+
+	message.Payload = "/subscribe"
+	err = coordinator.help(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"/subscribe url duration json-key.nested-key,second-key\n\n"+
+			"notify about changes of json keys\n\n"+
+			"The url is requested every duration, like 30s, 5m or 1h. "+
+			"Nested keys are separated by dots, several keys by commas. "+
+			"Keys with spaces are written in quotes. Subscribing to the same "+
+			"url and keys again changes the duration. The command has no "+
+			"name=value options.\n\n"+
+			"Examples:\n"+
+			"/subscribe http://time.jsontest.com/ 1h date,time\n"+
+			"/subscribe https://api.example.com/status 5m service.status\n"+
+			"/subscribe https://api.example.com/sales 1h \"total sales,region\"",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = "quota"
+	err = coordinator.help(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"/quota\n\nshow limits of subscriptions",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = "unknown"
+	err = coordinator.help(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Unknown command: unknown, send /help to see all commands",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Sender.LanguageCode = "ru"
+	message.Payload = "status"
+	err = coordinator.help(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"/status ID-подписки\n\nпоказать статус и доступность url\n\n"+
+			"Примеры:\n/status 5e7891f34940ad7f3746e2dd",
+		telegramBot.lastSentMessage,
+	)
+}
+
+func Test_Coordinator_TranslatesCommandMenu(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	name := regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+	english := coordinator.getBotCommands("")
+	assert.Len(t, english, len(coordinator.commands()))
+
+	for _, language := range i18n.Languages {
+		for i, command := range coordinator.getBotCommands(language) {
+			assert.Regexp(t, name, command.Command)
+			assert.True(t, len(command.Description) >= 3)
+			assert.True(t, len(command.Description) <= 256)
+
+			if language != i18n.English {
+				assert.NotEqual(
+					t,
+					english[i].Description,
+					command.Description,
+					"%s is not translated to %s", command.Command, language,
+				)
+			}
+		}
+	}
+}
+
+func Test_Coordinator_ParsesArgumentsOfCommands(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(writer, `{"total sales": 10, "region": "eu"}`)
+		},
+	))
+	defer server.Close()
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = server.URL + "  10s   \"total sales,region\""
+
+	err = coordinator.subscribe(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "You successfully subscribed!")
+
+	subscribers, err := coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+	assert.Equal(t, []string{"total sales", "region"}, subscribers[0].Keys)
+
+	message.Payload = server.URL + " 10s region extra"
+	err = coordinator.subscribe(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Invalid arguments, unexpected argument: extra",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = server.URL + " 10s \"region"
+	err = coordinator.subscribe(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Invalid arguments, unterminated quote: \"region",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = server.URL + " 10s region on=change"
+	err = coordinator.subscribe(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Invalid arguments, unknown option: on=change",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = "format=html"
+	err = coordinator.status(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Invalid arguments, unknown option: format=html",
+		telegramBot.lastSentMessage,
+	)
+}
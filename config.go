@@ -1,13 +1,179 @@
 package main
 
 import (
+	"net/url"
+	"time"
+
 	"github.com/kovetskiy/ko"
+	karma "github.com/reconquest/karma-go"
 )
 
 type Config struct {
 	TelegramBotToken string `toml:"telegrambot_token"`
-	DatabaseURI      string `toml:"uri_db" env:"DATABASE_URI"`
-	DatabaseName     string `toml:"database_name"`
+
+	// storage backend, "mongodb" or "bolt"
+	Storage string `toml:"storage" default:"mongodb"`
+
+	DatabaseURI  string `toml:"uri_db" env:"DATABASE_URI"`
+	DatabaseName string `toml:"database_name"`
+
+	// path to the database file of the bolt storage
+	StoragePath string `toml:"storage_path" default:"notify-telegram-bot.db"`
+
+	// time given to in-flight work and outbox on SIGINT or SIGTERM
+	ShutdownTimeout Duration `toml:"shutdown_timeout" default:"30s"`
+
+	// subscriptions declared in config are created on startup and
+	// reconciled on SIGHUP or when the config or the directory changes
+	Subscriptions []SubscriptionDeclaration `toml:"subscriptions"`
+
+	// directory with more declarations in *.toml, *.yaml and *.yml files
+	SubscriptionsDir string `toml:"subscriptions_dir"`
+
+	Outbox OutboxConfig `toml:"outbox"`
+	Health HealthConfig `toml:"health"`
+	HTTP   HTTPConfig   `toml:"http"`
+	API    APIConfig    `toml:"api"`
+	Access AccessConfig `toml:"access"`
+	Fetch  FetchConfig  `toml:"fetch"`
+	Quota  QuotaConfig  `toml:"quota"`
+	Format FormatConfig `toml:"format"`
+}
+
+type OutboxConfig struct {
+	MaxAttempts int      `toml:"max_attempts" default:"10"`
+	MinBackoff  Duration `toml:"min_backoff" default:"5s"`
+	MaxBackoff  Duration `toml:"max_backoff" default:"30m"`
+
+	// intervals between messages, defaults follow the Telegram Bot API
+	// limits: 30 messages per second, 1 message per second in a private
+	// chat and 20 messages per minute in a group
+	GlobalInterval  Duration `toml:"global_interval" default:"34ms"`
+	PrivateInterval Duration `toml:"private_interval" default:"1s"`
+	GroupInterval   Duration `toml:"group_interval" default:"3s"`
+}
+
+type HealthConfig struct {
+	// number of consecutive failures before subscribers are notified
+	FailureThreshold int `toml:"failure_threshold" default:"3"`
+
+	// treat non-2xx responses as failures
+	AlertOnStatus bool `toml:"alert_on_status"`
+
+	// treat responses slower than the threshold as failures, zero disables
+	// the check
+	SlowThreshold Duration `toml:"slow_threshold"`
+}
+
+type HTTPConfig struct {
+	// address of the embedded http server, empty disables the server
+	Listen string `toml:"listen"`
+
+	// external address of the server, used in webhook urls given to users
+	PublicURL string `toml:"public_url"`
+
+	// max size of a webhook request body in bytes
+	MaxWebhookSize int64 `toml:"max_webhook_size" default:"1048576"`
+
+	// /healthz fails when a background loop or telegram poller didn't
+	// succeed for longer than its interval plus this timeout
+	StallTimeout Duration `toml:"stall_timeout" default:"5m"`
+}
+
+type APIConfig struct {
+	// bearer token required by /api/ endpoints, api is disabled without it
+	Token string `toml:"token" env:"API_TOKEN"`
+}
+
+type AccessConfig struct {
+	// users and chats allowed to use the bot, everyone is allowed if both
+	// lists are empty
+	Users []int   `toml:"users"`
+	Chats []int64 `toml:"chats"`
+
+	// admins can run every command in every chat
+	Admins []int `toml:"admins"`
+}
+
+type FetchConfig struct {
+	// hosts which are never requested, subdomains are matched as well
+	DenyHosts []string `toml:"deny_hosts"`
+
+	// hosts which may resolve to private addresses, e.g. internal services
+	// the bot is meant to watch
+	AllowHosts []string `toml:"allow_hosts"`
+
+	// disables the check of private, loopback and link-local addresses
+	AllowPrivate bool `toml:"allow_private"`
+
+	// time of the whole request including redirects and reading the body
+	Timeout             Duration `toml:"timeout" default:"30s"`
+	DialTimeout         Duration `toml:"dial_timeout" default:"10s"`
+	TLSHandshakeTimeout Duration `toml:"tls_handshake_timeout" default:"10s"`
+
+	MaxRedirects int    `toml:"max_redirects" default:"5"`
+	UserAgent    string `toml:"user_agent" default:"notify-telegram-bot"`
+
+	// proxy for all requests like "http://proxy:3128", HTTP_PROXY and
+	// other environment variables are not used
+	Proxy URL `toml:"proxy"`
+
+	// idle connections kept for reuse
+	MaxIdleConns        int      `toml:"max_idle_conns" default:"100"`
+	MaxIdleConnsPerHost int      `toml:"max_idle_conns_per_host" default:"4"`
+	IdleConnTimeout     Duration `toml:"idle_conn_timeout" default:"90s"`
+
+	// hosts which get their own label in fetch metrics, urls come from
+	// users so requests to further hosts are labelled "other"
+	MetricHosts int `toml:"metric_hosts" default:"50"`
+}
+
+// QuotaConfig limits what a single chat can make the bot do, subscriptions
+// of bot admins and declared in config are not limited.
+type QuotaConfig struct {
+	// max number of subscriptions of a chat, zero means no limit
+	MaxSubscriptions int `toml:"max_subscriptions" default:"100"`
+
+	// allowed subscription intervals, zero max means no limit
+	MinInterval Duration `toml:"min_interval" default:"30s"`
+	MaxInterval Duration `toml:"max_interval"`
+
+	// max size of a response body in bytes, larger responses are treated as
+	// failures
+	MaxResponseSize int64 `toml:"max_response_size" default:"1048576"`
+}
+
+// FormatConfig controls how data is written in notifications.
+type FormatConfig struct {
+	// timezone of chats which didn't choose one with /timezone
+	Timezone string `toml:"timezone" default:"UTC"`
+
+	// write RFC 3339 strings and unix timestamps in json data as dates in
+	// the timezone of the chat
+	DetectDates bool `toml:"detect_dates"`
+}
+
+// Duration is a time.Duration which can be read from config as a string
+// like "5s" or "1h30m".
+type Duration struct {
+	time.Duration
+}
+
+func (duration *Duration) UnmarshalText(text []byte) error {
+	var err error
+	duration.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// URL is a url.URL which can be read from config as a string.
+type URL struct {
+	*url.URL
+}
+
+func (target *URL) UnmarshalText(text []byte) error {
+	var err error
+	target.URL, err = url.Parse(string(text))
+	return err
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -17,5 +183,10 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	_, err = time.LoadLocation(config.Format.Timezone)
+	if err != nil {
+		return nil, karma.Format(err, "invalid timezone in [format]")
+	}
+
 	return config, nil
 }
@@ -1,17 +1,25 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/reconquest/notify-telegram-bot/internal/transport"
+
 	"github.com/reconquest/pkg/log"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
 	"gopkg.in/tucnak/telebot.v2"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
@@ -22,6 +30,7 @@ import (
 // use it, if site will not available
 // every test should run manually, because tests use time.Sleep functions for imitation
 // of real time work of the bot
+// tests which use fakeClock and memory storage don't sleep and run offline
 
 type Recipient struct {
 	recipient string
@@ -37,6 +46,14 @@ type TestTelegram struct {
 	allSentMessages []string
 	recipient       tb.Recipient
 	recipientData   []map[string][]string //key=recipient, []string = messages
+	documentName    string
+	documentData    []byte
+	files           map[string][]byte
+	chatAdmins      map[int]bool
+	lastKeyboard    transport.Keyboard
+
+	// sendErrors are returned by the next calls of SendMessage
+	sendErrors []error
 }
 
 func NewTestBot() *TestTelegram {
@@ -45,6 +62,12 @@ func NewTestBot() *TestTelegram {
 }
 
 func (telegram *TestTelegram) SendMessage(recipient tb.Recipient, message string) error {
+	if len(telegram.sendErrors) > 0 {
+		err := telegram.sendErrors[0]
+		telegram.sendErrors = telegram.sendErrors[1:]
+		return err
+	}
+
 	newItem := make(map[string][]string)
 	var messages []string
 
@@ -81,12 +104,69 @@ func (telegram *TestTelegram) SendMessage(recipient tb.Recipient, message string
 	return nil
 }
 
-func createTestDatabase() *Database {
-	database, err := NewDatabase(
-		os.Getenv("TEST_DATABASE_URI"),
-		"licenses_test_"+fmt.Sprint(time.Now().UnixNano()),
-		context.Background(),
-	)
+func (telegram *TestTelegram) SendDocument(
+	recipient tb.Recipient,
+	name string,
+	data []byte,
+) error {
+	telegram.recipient = recipient
+	telegram.documentName = name
+	telegram.documentData = data
+	return nil
+}
+
+func (telegram *TestTelegram) Download(file *tb.File) (io.ReadCloser, error) {
+	data, ok := telegram.files[file.FileID]
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s", file.FileID)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (telegram *TestTelegram) IsChatAdmin(
+	chat *tb.Chat,
+	user *tb.User,
+) (bool, error) {
+	return telegram.chatAdmins[user.ID], nil
+}
+
+func (telegram *TestTelegram) SendKeyboard(
+	recipient tb.Recipient,
+	text string,
+	keyboard transport.Keyboard,
+) error {
+	telegram.lastKeyboard = keyboard
+	return telegram.SendMessage(recipient, text)
+}
+
+func (telegram *TestTelegram) EditKeyboard(
+	message *tb.Message,
+	text string,
+	keyboard transport.Keyboard,
+) error {
+	telegram.lastKeyboard = keyboard
+	return telegram.SendMessage(message.Chat, text)
+}
+
+// createTestDatabase connects to MongoDB at TEST_DATABASE_URI or uses a
+// temporary bolt database file if it's not set.
+func createTestDatabase() Storage {
+	name := "licenses_test_" + fmt.Sprint(time.Now().UnixNano())
+
+	uri := os.Getenv("TEST_DATABASE_URI")
+	if uri == "" {
+		database, err := NewBoltStorage(
+			filepath.Join(os.TempDir(), name+".db"),
+		)
+		if err != nil {
+			panic(err)
+		}
+
+		return database
+	}
+
+	database, err := NewDatabase(uri, name, context.Background())
 	if err != nil {
 		panic(err)
 	}
@@ -94,6 +174,35 @@ func createTestDatabase() *Database {
 	return database
 }
 
+// fakeClock is moved forward by tests instead of sleeping.
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+// Sleep moves the clock forward right away.
+func (clock *fakeClock) Sleep(duration time.Duration) {
+	clock.Advance(duration)
+}
+
+func (clock *fakeClock) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	clock.now = clock.now.Add(duration)
+}
+
 func createMessage(url,
 	duration,
 	JSONKey string,
@@ -150,13 +259,13 @@ func Test_Coordinator_routineCleanEndpoints_RemoveEdnpointWithoutSubscribers(
 	err = coordinator.subscribe(message)
 	assert.NoError(t, err)
 
-	subscription, err := testDatabase.FindInSubscriptions(bson.M{})
+	subscription, err := testDatabase.listSubscriptions()
 	assert.NoError(t, err)
 	assert.Equal(t, urlServerTime.String(), subscription[0].URL)
 
 	err = coordinator.routineCleanEndpoints()
 	assert.NoError(t, err)
-	endpoints, err := testDatabase.FindInEndpoints(bson.M{})
+	endpoints, err := testDatabase.listEndpoints()
 	assert.NoError(t, err)
 	assert.Equal(t, urlServerTime.String(), endpoints[0].URL)
 
@@ -166,7 +275,7 @@ func Test_Coordinator_routineCleanEndpoints_RemoveEdnpointWithoutSubscribers(
 	err = coordinator.routineCleanEndpoints()
 	assert.NoError(t, err)
 
-	endpointsAfterRemovingSubscriber, err := testDatabase.FindInEndpoints(bson.M{})
+	endpointsAfterRemovingSubscriber, err := testDatabase.listEndpoints()
 	assert.NoError(t, err)
 
 	assert.Empty(t, endpointsAfterRemovingSubscriber)
@@ -198,7 +307,7 @@ func Test_Coordinator_SendMessageToUserAndWriteSubscriberToDatabase(t *testing.T
 	err = coordinator.subscribe(message)
 	assert.NoError(t, err)
 
-	dataFromDatabase, err := testDatabase.FindInSubscriptions(bson.M{})
+	dataFromDatabase, err := testDatabase.listSubscriptions()
 	assert.NoError(t, err)
 
 	assert.NotEmpty(t, dataFromDatabase)
@@ -237,13 +346,14 @@ func Test_Coordinator_StopSendingMessagesAndDeletingSubscriptionInDatabase(t *te
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	subscribeMessageForTime := createMessage(urlServerTime.String(), "5s", "time", 1, 2)
 
 	err = coordinator.subscribe(subscribeMessageForTime)
 	assert.NoError(t, err)
 
-	dataAfterSubscribe, err := testDatabase.FindInSubscriptions(bson.M{})
+	dataAfterSubscribe, err := testDatabase.listSubscriptions()
 	assert.NoError(t, err)
 
 	assert.Contains(t, telegramBot.lastSentMessage, "You successfully subscribed!")
@@ -260,11 +370,11 @@ func Test_Coordinator_StopSendingMessagesAndDeletingSubscriptionInDatabase(t *te
 	err = coordinator.subscribe(subscribeMessageForTransactions)
 	assert.NoError(t, err)
 
-	dataAfterSubscribe, err = testDatabase.FindInSubscriptions(bson.M{})
+	dataAfterSubscribe, err = testDatabase.listSubscriptions()
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(dataAfterSubscribe))
 
-	endpointsData, err := testDatabase.FindInEndpoints(bson.M{})
+	endpointsData, err := testDatabase.listEndpoints()
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(endpointsData))
 
@@ -273,10 +383,10 @@ func Test_Coordinator_StopSendingMessagesAndDeletingSubscriptionInDatabase(t *te
 	stopMessage := createMessage("", "", "", 1, 2)
 
 	err = coordinator.stop(stopMessage)
-	subscriptionDataAfterStopCommand, err := testDatabase.FindInSubscriptions(bson.M{})
+	subscriptionDataAfterStopCommand, err := testDatabase.listSubscriptions()
 	assert.NoError(t, err)
 
-	endpointDataAfterStopCommand, err := testDatabase.FindInEndpoints(bson.M{})
+	endpointDataAfterStopCommand, err := testDatabase.listEndpoints()
 	assert.NoError(t, err)
 
 	assert.Empty(t, subscriptionDataAfterStopCommand, "subscritptions should be empty")
@@ -311,6 +421,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnTestServerData(
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	message := createMessage(url.String(), "10s", "time", 1, 2)
 
@@ -353,6 +464,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnRealData(
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	message := createMessage("http://time.jsontest.com/", "10s", "time", 1, 2)
 
@@ -408,6 +520,7 @@ func Test_Coordinator_SendOnlyOneMessageIfJsonNotUpdatedOnServer(
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	message := createMessage(urlServerTransactions.String(), "5s", "metrics", 1, 2)
 
@@ -454,6 +567,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnRealDataWithMinuteInterval(t *
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	message := createMessage("http://time.jsontest.com/", "1m", "time", 1, 2)
 
@@ -505,6 +619,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnTestServerDataWithMinuteInterv
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	message := createMessage(urlServerTime.String(), "1m", "time", 1, 2)
 
@@ -563,6 +678,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnTestServerDataWithSeveralSubsc
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	//subscriber 1
 	message1 := createMessage(url.String(), "10s", "time", 1, 2)
@@ -631,6 +747,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnRealDataWithSeveralSubscribers
 	url := "http://time.jsontest.com/"
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	// subscriber 1
 	message1 := createMessage(url, "15s", "time", 1, 2)
@@ -704,6 +821,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnRealDataWithSeveralSubscribers
 	url := "http://time.jsontest.com/"
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	// subscriber 1
 	message1 := createMessage(url, "2m", "time", 1, 2)
@@ -784,6 +902,7 @@ func Test_Coordinator_NotContainDuplicateMessageOnRealDataWithSeveralSubscribers
 	urlTime := "http://time.jsontest.com/"
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	//subscriber 1
 	message1 := createMessage(urlTime, "10s", "time", 1, 2)
@@ -867,6 +986,7 @@ func Test_Coordinator_SendMessageAboutFailedConnectionIfConnectionToServerIsLost
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	message := createMessage(url.String(), "3s", "time", 1, 2)
 
@@ -920,6 +1040,7 @@ func Test_Coordinator_NotDeleteEndpointIfThisEndpointHasTwoSubscribers(t *testin
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 
 	subscribeMessageForTimeWithFirstID := createMessage(
 		urlServerTime.String(),
@@ -946,10 +1067,10 @@ func Test_Coordinator_NotDeleteEndpointIfThisEndpointHasTwoSubscribers(t *testin
 	stopMessage := createMessage("", "", "", 1, 2)
 
 	err = coordinator.stop(stopMessage)
-	subscriptionDataAfterStopCommand, err := testDatabase.FindInSubscriptions(bson.M{})
+	subscriptionDataAfterStopCommand, err := testDatabase.listSubscriptions()
 	assert.NoError(t, err)
 
-	endpointDataAfterStopCommand, err := testDatabase.FindInEndpoints(bson.M{})
+	endpointDataAfterStopCommand, err := testDatabase.listEndpoints()
 	assert.NoError(t, err)
 
 	assert.Equal(
@@ -998,6 +1119,7 @@ func Test_Coordinator_IfSubscribeCommandFromChatMessageSendsOnlyToChat(t *testin
 
 	go runRoutineUpdateEndpoints(coordinator)
 	go runRoutineSendDataToSubscribers(coordinator)
+	go runRoutineSendOutbox(coordinator)
 	time.Sleep(time.Second)
 
 	personID := 111
@@ -1077,3 +1199,74 @@ func runRoutineSendDataToSubscribers(coordinator *Coordinator) {
 		time.Sleep(2 * time.Second)
 	}
 }
+
+func runRoutineSendOutbox(coordinator *Coordinator) {
+	for {
+		err := coordinator.routineSendOutbox()
+		if err != nil {
+			log.Error(err)
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func Test_Coordinator_SendsChangedKeyWithFakeClock(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	value := 1
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			fmt.Fprintf(writer, `{"value": %d}`, value)
+		},
+	))
+	defer server.Close()
+
+	setValue := func(newValue int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		value = newValue
+	}
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	tick := func(duration time.Duration) {
+		clock.Advance(duration)
+		assert.NoError(t, coordinator.routineUpdateEndpoints())
+		assert.NoError(t, coordinator.routineSendDataToSubscribers())
+		assert.NoError(t, coordinator.routineSendOutbox())
+	}
+
+	err = coordinator.subscribe(createMessage(server.URL, "10s", "value", 1, 2))
+	assert.NoError(t, err)
+	assert.Len(t, telegramBot.allSentMessages, 1)
+
+	tick(time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 1)
+
+	setValue(2)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 2)
+	assert.Contains(t, telegramBot.lastSentMessage, "\n\n2")
+
+	tick(11 * time.Second)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 2)
+
+	setValue(3)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 3)
+	assert.Contains(t, telegramBot.lastSentMessage, "\n\n3")
+}
@@ -26,6 +26,29 @@ type Endpoint struct {
 	RefreshAt    time.Time              `bson:"refresh_at"`
 	Response     bool                   `bson:"response"`
 	UpdatedAt    time.Time              `bson:"updated_at"`
+
+	// health of the endpoint, Failures is a number of consecutive failed
+	// refreshes and FailingSince is the time of the first one
+	Failures     int           `bson:"failures"`
+	LastError    string        `bson:"last_error"`
+	StatusCode   int           `bson:"status_code"`
+	Latency      time.Duration `bson:"latency"`
+	FailingSince time.Time     `bson:"failing_since"`
+	LastDowntime time.Duration `bson:"last_downtime"`
+
+	// Up is set when the url responded with a non-error status, it doesn't
+	// depend on the response body
+	Up            bool      `bson:"up"`
+	BodySize      int       `bson:"body_size"`
+	CertExpiresAt time.Time `bson:"cert_expires_at"`
+	CertError     string    `bson:"cert_error"`
+
+	// Webhook endpoints are never polled, their data is pushed to the bot
+	Webhook bool `bson:"webhook"`
+
+	// Trusted endpoints are requested without the address check, they are
+	// created by subscriptions of bot admins
+	Trusted bool `bson:"trusted"`
 }
 
 type Database struct {
@@ -34,6 +57,10 @@ type Database struct {
 
 	Endpoints     *mongo.Collection
 	Subscriptions *mongo.Collection
+	Outbox        *mongo.Collection
+	Checks        *mongo.Collection
+	Chats         *mongo.Collection
+	Migrations    *mongo.Collection
 
 	client *mongo.Client
 
@@ -47,17 +74,62 @@ type Subscriber struct {
 	Sender      *tb.User               `bson:"sender"`
 	Chat        *tb.Chat               `bson:"chat"`
 	UserID      int                    `bson:"userid"`
-	Keys        string                 `bson:"keys"`
+	Keys        []string               `bson:"keys"`
 	UpdatedAt   time.Time              `bson:"updated_at"`
 	SendAt      time.Time              `bson:"send_at"`
 	Data        map[string]interface{} `bson:"data"`
-	Recipient   tb.Recipient
-	RecipientID int
+	Recipient   tb.Recipient           `bson:"-"`
+	RecipientID int                    `bson:"-"`
+
+	// Disabled is set when the chat can't receive messages anymore, such
+	// subscriptions are skipped until the chat talks to the bot again.
+	Disabled       bool   `bson:"disabled"`
+	DisabledReason string `bson:"disabled_reason"`
+
+	// Alerted is set when the subscriber was told that the endpoint is down
+	// and is waiting for the recovery notice.
+	Alerted bool `bson:"alerted"`
+
+	// Kind is empty for subscriptions on json keys and SubscriptionUptime
+	// for subscriptions on availability of the url.
+	Kind string `bson:"kind"`
+
+	// last state of the url reported to uptime subscriber
+	LastState      string `bson:"last_state"`
+	LastStatusCode int    `bson:"last_status_code"`
+
+	// Paused subscriptions are kept but not sent until resumed via api.
+	Paused bool `bson:"paused"`
+
+	// CertWarned is the smallest number of days before certificate expiry
+	// the subscriber was already warned about
+	CertWarned int `bson:"cert_warned"`
+
+	// Managed subscriptions are declared in config, they are reconciled on
+	// reload and can't be removed by chat commands.
+	Managed bool `bson:"managed"`
+
+	// Template is a text/template used instead of the default change
+	// notification, only config can set it.
+	Template string `bson:"template"`
+
+	// Trusted subscriptions are created by bot admins or declared in config,
+	// their urls may point to internal addresses.
+	Trusted bool `bson:"trusted"`
+
+	// Filters decide which changes of keys are noise, set by /filter.
+	Filters Filters `bson:"filters"`
+
+	// Notified are values of filtered keys the subscriber has seen, changes
+	// are compared against them instead of the previous refresh.
+	Notified []NotifiedValue `bson:"notified"`
 }
 
 func (database *Database) connect() error {
 	var err error
-	opts := options.Client().ApplyURI(database.URI)
+	opts := options.Client().
+		ApplyURI(database.URI).
+		SetMonitor(newDatabaseMonitor())
 
 	database.client, err = mongo.Connect(database.context, opts)
 	if err != nil {
@@ -75,6 +147,27 @@ func (database *Database) connect() error {
 		database.name,
 	).Collection("endpoints")
 
+	database.Outbox = database.client.Database(
+		database.name,
+	).Collection("outbox")
+
+	database.Checks = database.client.Database(
+		database.name,
+	).Collection("checks")
+
+	database.Chats = database.client.Database(
+		database.name,
+	).Collection("chats")
+
+	database.Migrations = database.client.Database(
+		database.name,
+	).Collection("migrations")
+
+	err = database.migrate()
+	if err != nil {
+		return karma.Format(err, "unable to migrate database")
+	}
+
 	err = database.ensureEndpointsIndexes()
 	if err != nil {
 		return karma.Format(
@@ -91,6 +184,30 @@ func (database *Database) connect() error {
 			database.Subscriptions.Name())
 	}
 
+	err = database.ensureOutboxIndexes()
+	if err != nil {
+		return karma.Format(
+			err,
+			"can't create index for %s collection",
+			database.Outbox.Name())
+	}
+
+	err = database.ensureChecksIndexes()
+	if err != nil {
+		return karma.Format(
+			err,
+			"can't create index for %s collection",
+			database.Checks.Name())
+	}
+
+	err = database.ensureChatsIndexes()
+	if err != nil {
+		return karma.Format(
+			err,
+			"can't create index for %s collection",
+			database.Chats.Name())
+	}
+
 	return nil
 }
 
@@ -144,11 +261,27 @@ func (database *Database) ensureCollections() {
 	database.Subscriptions = database.client.Database(
 		database.name,
 	).Collection("subscriptions")
+
+	database.Outbox = database.client.Database(
+		database.name,
+	).Collection("outbox")
+
+	database.Checks = database.client.Database(
+		database.name,
+	).Collection("checks")
+
+	database.Chats = database.client.Database(
+		database.name,
+	).Collection("chats")
+
+	database.Migrations = database.client.Database(
+		database.name,
+	).Collection("migrations")
 }
 
 func (database *Database) RemoveEndpoint(id primitive.ObjectID) error {
 	_, err := database.Endpoints.DeleteOne(
-		context.Background(),
+		database.context,
 		bson.M{"_id": id},
 	)
 	if err != nil {
@@ -163,7 +296,7 @@ func (database *Database) RemoveEndpoint(id primitive.ObjectID) error {
 
 func (database *Database) RemoveSubscription(id primitive.ObjectID) error {
 	_, err := database.Subscriptions.DeleteOne(
-		context.Background(),
+		database.context,
 		bson.M{"_id": id},
 	)
 	if err != nil {
@@ -176,9 +309,49 @@ func (database *Database) RemoveSubscription(id primitive.ObjectID) error {
 	return nil
 }
 
+func (database *Database) removeEndpointSubscriptions(endpoint Endpoint) error {
+	_, err := database.Subscriptions.DeleteMany(
+		database.context,
+		bson.M{
+			"url":      endpoint.URL,
+			"duration": endpoint.Duration,
+		},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to remove records in subscriptions collection",
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) findEndpoint(url string) (*Endpoint, error) {
+	var endpoint Endpoint
+	err := database.Endpoints.FindOne(
+		database.context,
+		bson.M{"url": url},
+	).Decode(&endpoint)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, karma.Format(
+			err,
+			"can't decode data from %s collection, url: %s",
+			database.Endpoints.Name(),
+			url,
+		)
+	}
+
+	return &endpoint, nil
+}
+
 func (database *Database) deleteEndpointAndSubscription(url string) error {
 	filter := bson.M{"url": url}
-	_, err := database.Endpoints.DeleteOne(context.Background(), filter)
+	_, err := database.Endpoints.DeleteOne(database.context, filter)
 	if err != nil {
 		return karma.Format(
 			err,
@@ -187,7 +360,7 @@ func (database *Database) deleteEndpointAndSubscription(url string) error {
 		)
 	}
 
-	_, err = database.Subscriptions.DeleteOne(context.Background(), filter)
+	_, err = database.Subscriptions.DeleteOne(database.context, filter)
 	if err != nil {
 		return karma.Format(
 			err,
@@ -220,8 +393,13 @@ func NewDatabase(uri string, name string, context context.Context) (
 	return database, nil
 }
 
+// Disconnect closes connections to the database, it doesn't use database
+// context because it's called when the context is already canceled.
 func (database *Database) Disconnect() error {
-	err := database.client.Disconnect(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := database.client.Disconnect(ctx)
 	if err != nil {
 		return karma.Format(
 			err, "unable to disconnect from database %s",
@@ -231,6 +409,18 @@ func (database *Database) Disconnect() error {
 	return nil
 }
 
+func (database *Database) Ping(ctx context.Context) error {
+	err := database.client.Ping(ctx, nil)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to ping database %s",
+			database.name)
+	}
+
+	return nil
+}
+
 func (database *Database) Drop() error {
 	err := database.client.Database(database.name).Drop(context.Background())
 	if err != nil {
@@ -271,16 +461,16 @@ func (database *Database) updateSubscriberStatus(
 }
 
 func (database *Database) updateSubscriber(
-	subscriber Subscriber,
+	id primitive.ObjectID,
+	sendAt time.Time,
 ) error {
-	duration := subscriber.Duration
 	filter := bson.M{
 		"_id": bson.M{
-			"$eq": subscriber.ID,
+			"$eq": id,
 		},
 	}
 	update := bson.M{"$set": bson.M{
-		"send_at": time.Now().Add(duration),
+		"send_at": sendAt,
 	}}
 	_, err := database.Subscriptions.UpdateOne(
 		database.context,
@@ -294,9 +484,181 @@ func (database *Database) updateSubscriber(
 	return nil
 }
 
+func (database *Database) setSubscriberAlerted(
+	id primitive.ObjectID,
+	alerted bool,
+) error {
+	_, err := database.Subscriptions.UpdateOne(
+		database.context,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"alerted": alerted,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update subscriber alert status in database",
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) setSubscriberPaused(
+	id primitive.ObjectID,
+	paused bool,
+) error {
+	_, err := database.Subscriptions.UpdateOne(
+		database.context,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"paused": paused,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update subscriber pause status in database",
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) setSubscriberManaged(
+	id primitive.ObjectID,
+	template string,
+) error {
+	_, err := database.Subscriptions.UpdateOne(
+		database.context,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"managed":  true,
+			"template": template,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update subscriber managed status in database",
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) setSubscriberFilters(
+	id primitive.ObjectID,
+	filters Filters,
+) error {
+	_, err := database.Subscriptions.UpdateOne(
+		database.context,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"filters": filters,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update subscriber filters in database",
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) setSubscriberNotified(
+	id primitive.ObjectID,
+	values []NotifiedValue,
+) error {
+	_, err := database.Subscriptions.UpdateOne(
+		database.context,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"notified": values,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update subscriber notified values in database",
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) refreshEndpoints(
+	filter interface{},
+	now time.Time,
+) (int64, error) {
+	result, err := database.Endpoints.UpdateMany(
+		database.context,
+		filter,
+		bson.M{"$set": bson.M{
+			"refresh_at": now,
+		}},
+	)
+	if err != nil {
+		return 0, karma.Format(
+			err,
+			"unable to update records in %s collection",
+			database.Endpoints.Name(),
+		)
+	}
+
+	return result.MatchedCount, nil
+}
+
+func (database *Database) setSubscriberState(
+	id primitive.ObjectID,
+	state string,
+	statusCode int,
+) error {
+	_, err := database.Subscriptions.UpdateOne(
+		database.context,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"last_state":       state,
+			"last_status_code": statusCode,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update subscriber state in database",
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) setSubscriberCertWarned(
+	id primitive.ObjectID,
+	days int,
+) error {
+	_, err := database.Subscriptions.UpdateOne(
+		database.context,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"cert_warned": days,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update subscriber certificate warning in database",
+		)
+	}
+
+	return nil
+}
+
 func (database *Database) writeEndpoint(endpoint *Endpoint) error {
 	_, err := database.Endpoints.InsertOne(
-		context.Background(), endpoint,
+		database.context, endpoint,
 	)
 	if err != nil {
 		if database.IsDup(err) {
@@ -317,17 +679,21 @@ func (database *Database) writeEndpoint(endpoint *Endpoint) error {
 func (database *Database) upsertSubscriber(subscriber Subscriber) error {
 	upsert := true
 	_, err := database.Subscriptions.UpdateOne(
-		context.Background(),
+		database.context,
 		bson.M{
 			"url":    subscriber.URL,
 			"userid": subscriber.UserID,
 		},
 		bson.M{"$set": bson.M{
-			"duration": subscriber.Duration,
-			"sender":   subscriber.Sender,
-			"chat":     subscriber.Chat,
-			"keys":     subscriber.Keys,
-			"send_at":  time.Now().Add(subscriber.Duration),
+			"duration":        subscriber.Duration,
+			"sender":          subscriber.Sender,
+			"chat":            subscriber.Chat,
+			"keys":            subscriber.Keys,
+			"kind":            subscriber.Kind,
+			"send_at":         subscriber.SendAt,
+			"disabled":        false,
+			"disabled_reason": "",
+			"trusted":         subscriber.Trusted,
 		}},
 		&options.UpdateOptions{
 			Upsert: &upsert,
@@ -341,13 +707,79 @@ func (database *Database) upsertSubscriber(subscriber Subscriber) error {
 	return nil
 }
 
+func (database *Database) disableSubscriptions(
+	chatID int64,
+	reason string,
+) error {
+	_, err := database.Subscriptions.UpdateMany(
+		database.context,
+		bson.M{"userid": int(chatID)},
+		bson.M{"$set": bson.M{
+			"disabled":        true,
+			"disabled_reason": reason,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to disable subscriptions, chat_id: %d",
+			chatID,
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) enableSubscriptions(chatID int64) error {
+	_, err := database.Subscriptions.UpdateMany(
+		database.context,
+		bson.M{
+			"userid":   int(chatID),
+			"disabled": true,
+		},
+		bson.M{"$set": bson.M{
+			"disabled":        false,
+			"disabled_reason": "",
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to enable subscriptions, chat_id: %d",
+			chatID,
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) migrateSubscriptions(from, to int64) error {
+	_, err := database.Subscriptions.UpdateMany(
+		database.context,
+		bson.M{"userid": int(from)},
+		bson.M{"$set": bson.M{
+			"userid":  int(to),
+			"chat.id": to,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to migrate subscriptions from chat %d to %d",
+			from, to,
+		)
+	}
+
+	return nil
+}
+
 func (database *Database) findSubscriber(
 	subscriberID int,
 	url string,
 ) (*Subscriber, error) {
 	var subscriber Subscriber
 	cursor := database.Subscriptions.FindOne(
-		context.Background(),
+		database.context,
 		bson.M{
 			"url":    url,
 			"userid": subscriberID,
@@ -371,12 +803,13 @@ func (database *Database) findSubscriber(
 	return &subscriber, nil
 }
 
-func (database *Database) FindInSubscriptions(filter primitive.M) (
+// findSubscriptions returns subscriptions matching the mongodb filter.
+func (database *Database) findSubscriptions(filter interface{}) (
 	[]Subscriber,
 	error,
 ) {
 	var data []Subscriber
-	cursor, err := database.Subscriptions.Find(context.Background(),
+	cursor, err := database.Subscriptions.Find(database.context,
 		filter)
 	if err != nil {
 		return nil, karma.Format(
@@ -385,7 +818,7 @@ func (database *Database) FindInSubscriptions(filter primitive.M) (
 			database.Subscriptions.Name())
 	}
 
-	err = cursor.All(context.Background(), &data)
+	err = cursor.All(database.context, &data)
 	if err != nil {
 		return nil, karma.Format(
 			err,
@@ -396,12 +829,13 @@ func (database *Database) FindInSubscriptions(filter primitive.M) (
 	return data, nil
 }
 
-func (database *Database) FindInEndpoints(filter primitive.M) (
+// findEndpoints returns endpoints matching the mongodb filter.
+func (database *Database) findEndpoints(filter interface{}) (
 	[]Endpoint,
 	error,
 ) {
 	var data []Endpoint
-	cursor, err := database.Endpoints.Find(context.Background(),
+	cursor, err := database.Endpoints.Find(database.context,
 		filter)
 	if err != nil {
 		return nil, karma.Format(
@@ -410,7 +844,7 @@ func (database *Database) FindInEndpoints(filter primitive.M) (
 			database.Endpoints.Name())
 	}
 
-	err = cursor.All(context.Background(), &data)
+	err = cursor.All(database.context, &data)
 	if err != nil {
 		return nil, karma.Format(
 			err,
@@ -420,3 +854,236 @@ func (database *Database) FindInEndpoints(filter primitive.M) (
 
 	return data, nil
 }
+
+func (database *Database) listSubscriptions() ([]Subscriber, error) {
+	return database.findSubscriptions(bson.M{})
+}
+
+func (database *Database) findChatSubscriptions(userID int) (
+	[]Subscriber,
+	error,
+) {
+	return database.findSubscriptions(bson.M{"userid": userID})
+}
+
+func (database *Database) findDueSubscriptions(now time.Time) (
+	[]Subscriber,
+	error,
+) {
+	return database.findSubscriptions(bson.M{
+		"send_at":  bson.M{"$lt": now},
+		"disabled": bson.M{"$ne": true},
+		"paused":   bson.M{"$ne": true},
+	})
+}
+
+func (database *Database) findActiveURLSubscriptions(url string) (
+	[]Subscriber,
+	error,
+) {
+	return database.findSubscriptions(bson.M{
+		"url":      url,
+		"disabled": bson.M{"$ne": true},
+		"paused":   bson.M{"$ne": true},
+	})
+}
+
+func (database *Database) getSubscription(id primitive.ObjectID) (
+	*Subscriber,
+	error,
+) {
+	subscribers, err := database.findSubscriptions(bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscribers) == 0 {
+		return nil, nil
+	}
+
+	return &subscribers[0], nil
+}
+
+// hasOtherChatsSubscriptions reports whether any chat except the given one
+// has at least one subscription.
+func (database *Database) hasOtherChatsSubscriptions(userID int) (bool, error) {
+	count, err := database.Subscriptions.CountDocuments(
+		database.context,
+		bson.M{
+			"url":    bson.M{"$exists": true, "$ne": nil},
+			"userid": bson.M{"$ne": userID},
+		},
+	)
+	if err != nil {
+		return false, karma.Format(
+			err,
+			"unable to count records in %s collection",
+			database.Subscriptions.Name(),
+		)
+	}
+
+	return count > 0, nil
+}
+
+func (database *Database) removeChatSubscriptions(userID int) error {
+	_, err := database.Subscriptions.DeleteMany(
+		database.context,
+		bson.M{"userid": userID, "managed": bson.M{"$ne": true}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to remove records in %s collection",
+			database.Subscriptions.Name(),
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) listEndpoints() ([]Endpoint, error) {
+	return database.findEndpoints(bson.M{})
+}
+
+func (database *Database) getEndpoint(id primitive.ObjectID) (
+	*Endpoint,
+	error,
+) {
+	endpoints, err := database.findEndpoints(bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+
+	return &endpoints[0], nil
+}
+
+func (database *Database) findSubscriberEndpoint(subscriber Subscriber) (
+	*Endpoint,
+	error,
+) {
+	endpoints, err := database.findEndpoints(bson.M{
+		"url":      subscriber.URL,
+		"duration": subscriber.Duration,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+
+	return &endpoints[0], nil
+}
+
+// findDueEndpoints returns polled endpoints which should be refreshed,
+// webhook endpoints are never due.
+func (database *Database) findDueEndpoints(now time.Time) ([]Endpoint, error) {
+	return database.findEndpoints(bson.M{
+		"refresh_at": bson.M{"$lt": now},
+		"webhook":    bson.M{"$ne": true},
+	})
+}
+
+// saveEndpointFetch stores fields of the endpoint which are written by
+// fetches, other fields like trusted can be changed while the url is
+// requested. refresh_at is set only if it's still refreshAt, otherwise the
+// endpoint was refreshed meanwhile and should be requested again.
+func (database *Database) saveEndpointFetch(
+	endpoint Endpoint,
+	refreshAt time.Time,
+) error {
+	_, err := database.Endpoints.UpdateOne(
+		database.context,
+		bson.M{"_id": endpoint.ID},
+		bson.M{"$set": bson.M{
+			"data":            endpoint.Data,
+			"previous_data":   endpoint.PreviousData,
+			"response":        endpoint.Response,
+			"updated_at":      endpoint.UpdatedAt,
+			"failures":        endpoint.Failures,
+			"last_error":      endpoint.LastError,
+			"status_code":     endpoint.StatusCode,
+			"latency":         endpoint.Latency,
+			"failing_since":   endpoint.FailingSince,
+			"last_downtime":   endpoint.LastDowntime,
+			"up":              endpoint.Up,
+			"body_size":       endpoint.BodySize,
+			"cert_expires_at": endpoint.CertExpiresAt,
+			"cert_error":      endpoint.CertError,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update record in %s collection",
+			database.Endpoints.Name(),
+		)
+	}
+
+	_, err = database.Endpoints.UpdateOne(
+		database.context,
+		bson.M{"_id": endpoint.ID, "refresh_at": refreshAt},
+		bson.M{"$set": bson.M{"refresh_at": endpoint.RefreshAt}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update record in %s collection",
+			database.Endpoints.Name(),
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) trustEndpoint(
+	url string,
+	duration time.Duration,
+) error {
+	_, err := database.Endpoints.UpdateOne(
+		database.context,
+		bson.M{"url": url, "duration": duration},
+		bson.M{"$set": bson.M{"trusted": true}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update record in %s collection",
+			database.Endpoints.Name(),
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) removeEndpointsByURL(url string) error {
+	_, err := database.Endpoints.DeleteMany(
+		database.context,
+		bson.M{"url": url},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to remove records in %s collection",
+			database.Endpoints.Name(),
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) refreshEndpoint(
+	id primitive.ObjectID,
+	now time.Time,
+) (int64, error) {
+	return database.refreshEndpoints(bson.M{"_id": id}, now)
+}
+
+func (database *Database) refreshAllEndpoints(now time.Time) (int64, error) {
+	return database.refreshEndpoints(bson.M{}, now)
+}
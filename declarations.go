@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/go-yaml/yaml"
+	"github.com/kovetskiy/ko"
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// SubscriptionDeclaration describes a subscription managed by config.
+type SubscriptionDeclaration struct {
+	ChatID   int64    `toml:"chat_id" yaml:"chat_id"`
+	URL      string   `toml:"url" yaml:"url"`
+	Keys     []string `toml:"keys" yaml:"keys"`
+	Interval string   `toml:"interval" yaml:"interval"`
+	Kind     string   `toml:"kind" yaml:"kind"`
+	Template string   `toml:"template" yaml:"template"`
+}
+
+// declarationsFile is a file in subscriptions_dir.
+type declarationsFile struct {
+	Subscriptions []SubscriptionDeclaration `toml:"subscriptions" yaml:"subscriptions"`
+}
+
+type subscriptionKey struct {
+	userID int
+	url    string
+}
+
+// templateData is given to templates of managed subscriptions.
+type templateData struct {
+	ID      string
+	URL     string
+	Changes map[string]interface{}
+	Data    map[string]interface{}
+}
+
+func getSubscriptionKey(subscriber Subscriber) subscriptionKey {
+	return subscriptionKey{userID: subscriber.UserID, url: subscriber.URL}
+}
+
+// getDeclarationFiles returns files of subscriptions_dir in order of names.
+func getDeclarationFiles(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, karma.Format(err, "unable to read directory: %s", dir)
+	}
+
+	var paths []string
+	for _, info := range infos {
+		switch filepath.Ext(info.Name()) {
+		case ".toml", ".yaml", ".yml":
+			if !info.IsDir() {
+				paths = append(paths, filepath.Join(dir, info.Name()))
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// loadSubscriptionDeclarations collects declarations of the config and of
+// files in subscriptions_dir.
+func loadSubscriptionDeclarations(config *Config) (
+	[]SubscriptionDeclaration,
+	error,
+) {
+	declarations := append([]SubscriptionDeclaration{}, config.Subscriptions...)
+
+	paths, err := getDeclarationFiles(config.SubscriptionsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		var file declarationsFile
+		if filepath.Ext(path) == ".toml" {
+			err = ko.Load(path, &file)
+		} else {
+			err = ko.Load(path, &file, yaml.Unmarshal)
+		}
+		if err != nil {
+			return nil, karma.Format(err, "unable to load file: %s", path)
+		}
+
+		declarations = append(declarations, file.Subscriptions...)
+	}
+
+	return declarations, nil
+}
+
+// reconcileSubscriptions makes managed subscriptions in the database match
+// the declarations: missing ones are created, changed ones are updated and
+// ones which are not declared anymore are removed. Nothing is changed if
+// any declaration is invalid or collides with a subscription created by the
+// chat, otherwise it would be removed along with the declaration.
+func (coordinator *Coordinator) reconcileSubscriptions(
+	declarations []SubscriptionDeclaration,
+) error {
+	existing, err := coordinator.database.listSubscriptions()
+	if err != nil {
+		return karma.Format(err, "unable to list subscriptions")
+	}
+
+	current := map[subscriptionKey]Subscriber{}
+	for _, subscriber := range existing {
+		current[getSubscriptionKey(subscriber)] = subscriber
+	}
+
+	declared := map[subscriptionKey]Subscriber{}
+	var subscribers []Subscriber
+	for i, declaration := range declarations {
+		subscriber, err := coordinator.prepareDeclaration(declaration)
+		if err != nil {
+			return karma.Format(err, "subscription #%d", i+1)
+		}
+
+		key := getSubscriptionKey(subscriber)
+		if _, ok := declared[key]; ok {
+			return karma.Format(
+				newValidationError("subscription is declared twice"),
+				"subscription #%d", i+1,
+			)
+		}
+
+		if found, ok := current[key]; ok && !found.Managed {
+			return karma.Format(
+				newValidationError(
+					"chat already has own subscription to this url: %s",
+					found.ID.Hex(),
+				),
+				"subscription #%d", i+1,
+			)
+		}
+
+		declared[key] = subscriber
+		subscribers = append(subscribers, subscriber)
+	}
+
+	var created, removed int
+	for _, subscriber := range subscribers {
+		found, ok := current[getSubscriptionKey(subscriber)]
+		if ok && isSameDeclaration(found, subscriber) {
+			continue
+		}
+
+		err := coordinator.saveSubscription(subscriber)
+		if err != nil {
+			return err
+		}
+
+		saved, err := coordinator.database.findSubscriber(
+			subscriber.UserID,
+			subscriber.URL,
+		)
+		if err != nil {
+			return karma.Format(err, "unable to find saved subscription")
+		}
+
+		if saved == nil {
+			return fmt.Errorf("subscription disappeared: %s", subscriber.URL)
+		}
+
+		err = coordinator.database.setSubscriberManaged(
+			saved.ID,
+			subscriber.Template,
+		)
+		if err != nil {
+			return err
+		}
+
+		created++
+	}
+
+	// unused endpoints are removed by routineCleanEndpoints
+	for _, subscriber := range existing {
+		if _, ok := declared[getSubscriptionKey(subscriber)]; ok {
+			continue
+		}
+
+		if !subscriber.Managed {
+			continue
+		}
+
+		err := coordinator.database.RemoveSubscription(subscriber.ID)
+		if err != nil {
+			return karma.Format(err, "unable to remove subscription")
+		}
+
+		removed++
+	}
+
+	log.Infof(
+		nil,
+		"reconciled %d declared subscriptions: %d saved, %d removed",
+		len(subscribers), created, removed,
+	)
+
+	return nil
+}
+
+func (coordinator *Coordinator) prepareDeclaration(
+	declaration SubscriptionDeclaration,
+) (Subscriber, error) {
+	subscriber := Subscriber{
+		URL:      declaration.URL,
+		UserID:   int(declaration.ChatID),
+		Chat:     &tb.Chat{ID: declaration.ChatID},
+		Keys:     declaration.Keys,
+		Kind:     declaration.Kind,
+		Template: declaration.Template,
+		Managed:  true,
+		Trusted:  true,
+	}
+
+	if declaration.ChatID == 0 {
+		return subscriber, newValidationError("chat_id is required")
+	}
+
+	if declaration.URL == "" {
+		return subscriber, newValidationError("url is required")
+	}
+
+	// webhook urls are random, they can't be declared
+	if declaration.Kind == SubscriptionWebhook {
+		return subscriber, newValidationError("webhooks can't be declared")
+	}
+
+	if declaration.Template != "" {
+		_, err := template.New("").Parse(declaration.Template)
+		if err != nil {
+			return subscriber, newValidationError("invalid template: %s", err)
+		}
+	}
+
+	err := coordinator.prepareSubscription(&subscriber, declaration.Interval)
+	if err != nil {
+		return subscriber, err
+	}
+
+	return subscriber, nil
+}
+
+// isSameDeclaration reports whether the stored subscription already
+// matches the declaration, such subscriptions are not saved again to
+// keep their schedule.
+func isSameDeclaration(stored, declared Subscriber) bool {
+	return stored.Managed &&
+		stored.Duration == declared.Duration &&
+		stored.Kind == declared.Kind &&
+		stored.Template == declared.Template &&
+		stored.Trusted == declared.Trusted &&
+		reflect.DeepEqual(stored.Keys, declared.Keys)
+}
+
+// renderTemplate formats changes with the template of the subscriber.
+func renderTemplate(
+	subscriber Subscriber,
+	endpoint Endpoint,
+	changes map[string]interface{},
+) (string, error) {
+	parsed, err := template.New("").Parse(subscriber.Template)
+	if err != nil {
+		return "", karma.Format(err, "unable to parse template")
+	}
+
+	var buffer strings.Builder
+	err = parsed.Execute(&buffer, templateData{
+		ID:      subscriber.ID.Hex(),
+		URL:     subscriber.URL,
+		Changes: changes,
+		Data:    endpoint.Data,
+	})
+	if err != nil {
+		return "", karma.Format(err, "unable to execute template")
+	}
+
+	return buffer.String(), nil
+}
+
+// reloadSubscriptions reads declarations from the config file again and
+// reconciles them, other settings need restart.
+func (coordinator *Coordinator) reloadSubscriptions() error {
+	coordinator.reloading.Lock()
+	defer coordinator.reloading.Unlock()
+
+	config, err := LoadConfig(coordinator.configPath)
+	if err != nil {
+		return karma.Format(err, "unable to load config")
+	}
+
+	coordinator.subscriptionsDir = config.SubscriptionsDir
+
+	declarations, err := loadSubscriptionDeclarations(config)
+	if err != nil {
+		return err
+	}
+
+	return coordinator.reconcileSubscriptions(declarations)
+}
+
+// getDeclarationsStamp describes modification times of the config file,
+// subscriptions_dir and files in it, it changes whenever any of them is
+// changed, added or removed.
+func getDeclarationsStamp(configPath string, dir string) string {
+	paths := []string{configPath}
+	if dir != "" {
+		// errors are reported by reloadSubscriptions
+		files, _ := getDeclarationFiles(dir)
+
+		paths = append(paths, dir)
+		paths = append(paths, files...)
+	}
+
+	var stamp []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			stamp = append(stamp, path+":missing")
+			continue
+		}
+
+		stamp = append(
+			stamp,
+			fmt.Sprintf("%s:%d:%d", path, info.ModTime().UnixNano(), info.Size()),
+		)
+	}
+
+	return strings.Join(stamp, "\n")
+}
+
+// getSubscriptionsDir returns subscriptions_dir of the last loaded config.
+func (coordinator *Coordinator) getSubscriptionsDir() string {
+	coordinator.reloading.Lock()
+	defer coordinator.reloading.Unlock()
+
+	return coordinator.subscriptionsDir
+}
+
+// routineWatchDeclarations reloads declarations when the config file or
+// subscriptions_dir is changed. Invalid changes are logged and skipped
+// until the next change, so a typo doesn't affect liveness.
+func (coordinator *Coordinator) routineWatchDeclarations() error {
+	stamp := getDeclarationsStamp(
+		coordinator.configPath,
+		coordinator.getSubscriptionsDir(),
+	)
+	if stamp == coordinator.declarationsStamp {
+		return nil
+	}
+
+	if coordinator.declarationsStamp != "" {
+		log.Infof(nil, "config changed, reloading declared subscriptions")
+
+		err := coordinator.reloadSubscriptions()
+		if err != nil {
+			log.Errorf(err, "unable to reload declared subscriptions")
+		}
+
+		// subscriptions_dir could be changed by the reload
+		stamp = getDeclarationsStamp(
+			coordinator.configPath,
+			coordinator.getSubscriptionsDir(),
+		)
+	}
+
+	coordinator.declarationsStamp = stamp
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_reconcileSubscriptions_ManagesDeclaredSubscriptions(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	err = coordinator.subscribe(createMessage("http://example.com/own", "1m", "a", 1, 2))
+	assert.NoError(t, err)
+
+	declarations := []SubscriptionDeclaration{
+		{ChatID: 2, URL: "http://example.com/a", Keys: []string{"a"}, Interval: "1m"},
+		{ChatID: 2, URL: "http://example.com/b", Interval: "5m", Kind: SubscriptionUptime},
+	}
+
+	err = coordinator.reconcileSubscriptions(declarations)
+	assert.NoError(t, err)
+
+	subscribers, err := coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 3)
+
+	managed, err := coordinator.database.findSubscriber(2, "http://example.com/a")
+	assert.NoError(t, err)
+	assert.True(t, managed.Managed)
+
+	// subscribing over a declaration doesn't change it
+	err = coordinator.subscribe(createMessage("http://example.com/a", "5m", "b", 1, 2))
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "managed by the configuration file")
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = "http://example.com/a 5m"
+	err = coordinator.uptime(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "managed by the configuration file")
+
+	managed, err = coordinator.database.findSubscriber(2, "http://example.com/a")
+	assert.NoError(t, err)
+	assert.True(t, managed.Managed)
+	assert.Equal(t, time.Minute, managed.Duration)
+	assert.Equal(t, []string{"a"}, managed.Keys)
+	assert.Empty(t, managed.Kind)
+
+	unsubscribe := createMessage("", "", "", 1, 2)
+	unsubscribe.Payload = managed.ID.Hex()
+	err = coordinator.unsubscribe(unsubscribe)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "managed by the configuration file")
+
+	err = coordinator.stop(createMessage("", "", "", 1, 2))
+	assert.NoError(t, err)
+
+	subscribers, err = coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 2)
+
+	err = coordinator.reconcileSubscriptions(declarations[1:])
+	assert.NoError(t, err)
+
+	subscribers, err = coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+	assert.Equal(t, "http://example.com/b", subscribers[0].URL)
+}
+
+func Test_reconcileSubscriptions_RejectsInvalidDeclarations(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	err = coordinator.reconcileSubscriptions([]SubscriptionDeclaration{
+		{ChatID: 2, URL: "http://example.com/a", Keys: []string{"a"}, Interval: "1m"},
+		{ChatID: 2, URL: "http://example.com/b", Keys: []string{"a"}, Interval: "1m",
+			Template: "{{.Changes"},
+	})
+	assert.Error(t, err)
+
+	subscribers, err := coordinator.database.listSubscriptions()
+	assert.NoError(t, err)
+	assert.Empty(t, subscribers)
+}
+
+func Test_reconcileSubscriptions_RejectsOwnSubscriptionsOfChats(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	err = coordinator.subscribe(createMessage("http://example.com/a", "1m", "a", 1, 2))
+	assert.NoError(t, err)
+
+	err = coordinator.reconcileSubscriptions([]SubscriptionDeclaration{
+		{ChatID: 2, URL: "http://example.com/a", Keys: []string{"b"}, Interval: "5m"},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "chat already has own subscription")
+
+	// removing the declaration keeps the subscription of the chat
+	err = coordinator.reconcileSubscriptions(nil)
+	assert.NoError(t, err)
+
+	subscriber, err := coordinator.database.findSubscriber(2, "http://example.com/a")
+	assert.NoError(t, err)
+	assert.False(t, subscriber.Managed)
+	assert.Equal(t, []string{"a"}, subscriber.Keys)
+	assert.Equal(t, time.Minute, subscriber.Duration)
+}
+
+func Test_routineWatchDeclarations_FollowsSubscriptionsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify-telegram-bot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.toml")
+	writeConfig := func(subscriptionsDir string, modifiedAt time.Time) {
+		err := ioutil.WriteFile(configPath, []byte(`
+subscriptions_dir = "`+subscriptionsDir+`"
+
+[fetch]
+allow_private = true
+`), 0644)
+		assert.NoError(t, err)
+
+		err = os.Chtimes(configPath, modifiedAt, modifiedAt)
+		assert.NoError(t, err)
+	}
+
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	assert.NoError(t, os.Mkdir(first, 0755))
+	assert.NoError(t, os.Mkdir(second, 0755))
+
+	modifiedAt := time.Now().Add(-time.Hour)
+	writeConfig(first, modifiedAt)
+
+	config, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+	coordinator.configPath = configPath
+
+	assert.NoError(t, coordinator.routineWatchDeclarations())
+
+	writeConfig(second, modifiedAt.Add(time.Minute))
+	assert.NoError(t, coordinator.routineWatchDeclarations())
+
+	err = ioutil.WriteFile(filepath.Join(second, "a.yaml"), []byte(`
+subscriptions:
+  - chat_id: 2
+    url: http://example.com/b
+    kind: uptime
+    interval: 5m
+`), 0644)
+	assert.NoError(t, err)
+
+	assert.NoError(t, coordinator.routineWatchDeclarations())
+
+	subscribers, err := coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+}
+
+func Test_loadSubscriptionDeclarations_ReadsDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify-telegram-bot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "a.toml"), []byte(`
+[[subscriptions]]
+chat_id = 1
+url = "http://example.com/a"
+keys = ["a", "b.c"]
+interval = "1m"
+`), 0644)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "b.yaml"), []byte(`
+subscriptions:
+  - chat_id: 2
+    url: http://example.com/b
+    kind: uptime
+    interval: 5m
+`), 0644)
+	assert.NoError(t, err)
+
+	declarations, err := loadSubscriptionDeclarations(&Config{
+		Subscriptions: []SubscriptionDeclaration{
+			{ChatID: 3, URL: "http://example.com/c"},
+		},
+		SubscriptionsDir: dir,
+	})
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]SubscriptionDeclaration{
+			{ChatID: 3, URL: "http://example.com/c"},
+			{
+				ChatID:   1,
+				URL:      "http://example.com/a",
+				Keys:     []string{"a", "b.c"},
+				Interval: "1m",
+			},
+			{
+				ChatID:   2,
+				URL:      "http://example.com/b",
+				Kind:     SubscriptionUptime,
+				Interval: "5m",
+			},
+		},
+		declarations,
+	)
+}
+
+func Test_prepareMessageForSubscriber_UsesTemplate(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	endpoint := Endpoint{
+		Data:         map[string]interface{}{"price": 2, "name": "btc"},
+		PreviousData: map[string]interface{}{"price": 1, "name": "btc"},
+		UpdatedAt:    time.Now(),
+	}
+
+	message := coordinator.prepareMessageForSubscriber(
+		[]string{"price", "name"},
+		endpoint,
+		Subscriber{
+			Template: `{{.Data.name}} is {{index .Changes "price"}} now`,
+		},
+	)
+	assert.Equal(t, []string{"btc is 2 now"}, message)
+}
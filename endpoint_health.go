@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+)
+
+func isSuccessStatus(result *FetchResult) bool {
+	return result.StatusCode >= 200 && result.StatusCode < 300
+}
+
+func (coordinator *Coordinator) checkEndpointLatency(result *FetchResult) error {
+	threshold := coordinator.config.Health.SlowThreshold.Duration
+	if threshold == 0 || result.Latency <= threshold {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"slow response: %s, threshold: %s",
+		result.Latency.Round(time.Millisecond),
+		threshold,
+	)
+}
+
+// isEndpointDown reports whether subscribers should be told that the endpoint
+// is unavailable, single failures are not reported.
+func (coordinator *Coordinator) isEndpointDown(endpoint Endpoint) bool {
+	return endpoint.Failures > 0 &&
+		endpoint.Failures >= coordinator.config.Health.FailureThreshold
+}
+
+func (coordinator *Coordinator) sendMessageAboutRecoveredURL(
+	subscriber Subscriber,
+	endpoint Endpoint,
+) error {
+	locale := coordinator.getSubscriberLocale(subscriber)
+
+	var text []string
+	message := locale.Translate("URL is available again")
+	if endpoint.LastDowntime > 0 {
+		message = locale.Sprintf(
+			"URL is available again, recovered after %s",
+			endpoint.LastDowntime.Round(time.Second),
+		)
+	}
+
+	text = append(text, fmt.Sprintf(
+		"\nID - %s\nURL - %s\n\n%s",
+		subscriber.ID.Hex(),
+		subscriber.URL,
+		message,
+	))
+
+	err := coordinator.enqueueMessage(
+		int64(subscriber.RecipientID),
+		strings.Join(
+			text, "\n\n"),
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to enqueue message to user: %d",
+			subscriber.RecipientID,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_AlertsAfterFailureThresholdWithFakeClock(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.Health.FailureThreshold = 3
+
+	var mutex sync.Mutex
+	broken := false
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if broken {
+				fmt.Fprint(writer, `<html>maintenance</html>`)
+				return
+			}
+
+			fmt.Fprint(writer, `{"value": 1}`)
+		},
+	))
+	defer server.Close()
+
+	setBroken := func(value bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		broken = value
+	}
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	tick := func() {
+		clock.Advance(11 * time.Second)
+		assert.NoError(t, coordinator.routineUpdateEndpoints())
+		assert.NoError(t, coordinator.routineSendDataToSubscribers())
+		assert.NoError(t, coordinator.routineSendOutbox())
+	}
+
+	err = coordinator.subscribe(createMessage(server.URL, "10s", "value", 1, 2))
+	assert.NoError(t, err)
+	assert.Len(t, telegramBot.allSentMessages, 1)
+
+	subscriber, err := coordinator.database.findSubscriber(2, server.URL)
+	assert.NoError(t, err)
+
+	id := subscriber.ID.Hex()
+
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 1)
+
+	// responses which can't be decoded are failures too
+	setBroken(true)
+	tick()
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 1)
+
+	endpoint, err := coordinator.database.findEndpoint(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, endpoint.Failures)
+	assert.False(t, endpoint.Response)
+
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 2)
+	assert.Contains(
+		t,
+		telegramBot.lastSentMessage,
+		"\nID - "+id+"\nURL - "+server.URL+"\n\nURL is unavailable!\n\nReason: ",
+	)
+
+	tick()
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 2)
+
+	setBroken(false)
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 3)
+	assert.Equal(
+		t,
+		"\nID - "+id+"\nURL - "+server.URL+"\n\n"+
+			"URL is available again, recovered after 55s",
+		telegramBot.lastSentMessage,
+	)
+
+	endpoint, err = coordinator.database.findEndpoint(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, endpoint.Failures)
+	assert.Equal(t, 55*time.Second, endpoint.LastDowntime)
+	assert.True(t, endpoint.FailingSince.IsZero())
+
+	// the value didn't change during the outage
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 3)
+}
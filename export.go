@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	exportJSON = "json"
+	exportYAML = "yaml"
+
+	// max size of a document sent to /import
+	maxImportSize = 1 << 20
+)
+
+// subscriptionsDocument is the format of export and import, it contains
+// only fields which are required to recreate subscriptions.
+type subscriptionsDocument struct {
+	Subscriptions []exportedSubscription `json:"subscriptions" yaml:"subscriptions"`
+}
+
+type exportedSubscription struct {
+	ChatID   int64    `json:"chat_id" yaml:"chat_id"`
+	URL      string   `json:"url" yaml:"url"`
+	Duration string   `json:"duration" yaml:"duration"`
+	Keys     []string `json:"keys,omitempty" yaml:"keys,omitempty"`
+	Kind     string   `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Paused   bool     `json:"paused,omitempty" yaml:"paused,omitempty"`
+}
+
+func encodeSubscriptions(subscribers []Subscriber, format string) ([]byte, error) {
+	document := subscriptionsDocument{
+		Subscriptions: []exportedSubscription{},
+	}
+
+	for _, subscriber := range subscribers {
+		document.Subscriptions = append(
+			document.Subscriptions,
+			exportedSubscription{
+				ChatID:   getSubscriberChatID(subscriber),
+				URL:      subscriber.URL,
+				Duration: subscriber.Duration.String(),
+				Keys:     subscriber.Keys,
+				Kind:     subscriber.Kind,
+				Paused:   subscriber.Paused,
+			},
+		)
+	}
+
+	switch format {
+	case exportJSON:
+		return json.MarshalIndent(document, "", "  ")
+	case exportYAML:
+		return yaml.Marshal(document)
+	default:
+		return nil, fmt.Errorf("unknown export format: %q", format)
+	}
+}
+
+// decodeSubscriptions reads a document in either format.
+func decodeSubscriptions(data []byte) ([]exportedSubscription, error) {
+	var document subscriptionsDocument
+
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &document)
+	} else {
+		err = yaml.Unmarshal(data, &document)
+	}
+	if err != nil {
+		return nil, karma.Format(err, "unable to decode subscriptions")
+	}
+
+	return document.Subscriptions, nil
+}
+
+// importSubscriptions validates every subscription before saving any of
+// them, so a broken document isn't imported partially. If chat is given,
+// subscriptions are imported into it regardless of their chat_id. Trusted
+// subscriptions skip the address check of the fetcher.
+func (coordinator *Coordinator) importSubscriptions(
+	items []exportedSubscription,
+	chat *tb.Chat,
+	trusted bool,
+) (int, error) {
+	var subscribers []Subscriber
+	for i, item := range items {
+		if chat == nil && item.ChatID == 0 {
+			return 0, karma.Format(
+				newValidationError("chat_id is required"),
+				"subscription #%d", i+1,
+			)
+		}
+
+		subscriber := Subscriber{
+			URL:     item.URL,
+			UserID:  int(item.ChatID),
+			Chat:    &tb.Chat{ID: item.ChatID},
+			Keys:    item.Keys,
+			Kind:    item.Kind,
+			Paused:  item.Paused,
+			Trusted: trusted,
+		}
+
+		if chat != nil {
+			subscriber.UserID = int(chat.ID)
+			subscriber.Chat = chat
+		}
+
+		err := coordinator.prepareSubscription(&subscriber, item.Duration)
+		if err != nil {
+			return 0, karma.Format(err, "subscription #%d", i+1)
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	err := coordinator.checkSubscriptionsQuota(subscribers)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, subscriber := range subscribers {
+		err := coordinator.saveSubscription(subscriber)
+		if err != nil {
+			return 0, err
+		}
+
+		saved, err := coordinator.database.findSubscriber(
+			subscriber.UserID,
+			subscriber.URL,
+		)
+		if err != nil {
+			return 0, karma.Format(err, "unable to find saved subscription")
+		}
+
+		if saved != nil && saved.Paused != subscriber.Paused {
+			err := coordinator.database.setSubscriberPaused(
+				saved.ID,
+				subscriber.Paused,
+			)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(subscribers), nil
+}
+
+// export sends subscriptions of the chat as a document which can be sent
+// back with /import caption.
+func (coordinator *Coordinator) export(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1, "format")
+	if arguments == nil {
+		return err
+	}
+
+	// /export yaml is kept as a short form of /export format=yaml
+	format := exportJSON
+	if arguments.Option("format", arguments.Get(0)) == exportYAML {
+		format = exportYAML
+	}
+
+	subscribers, err := coordinator.database.findChatSubscriptions(
+		getRecipientID(message),
+	)
+	if err != nil {
+		return karma.Format(err, "unable to find subscriptions")
+	}
+
+	if len(subscribers) == 0 {
+		return coordinator.sendReply(
+			message,
+			coordinator.getLocale(message).Translate(
+				"You don't have any subscriptions",
+			),
+		)
+	}
+
+	data, err := encodeSubscriptions(subscribers, format)
+	if err != nil {
+		return err
+	}
+
+	var recipient tb.Recipient = message.Sender
+	if message.Chat != nil {
+		recipient = message.Chat
+	}
+
+	return coordinator.transport.SendDocument(
+		recipient,
+		"subscriptions."+format,
+		data,
+	)
+}
+
+// importDocument handles documents sent with /import caption, created
+// subscriptions belong to the chat the document was sent to.
+func (coordinator *Coordinator) importDocument(message *tb.Message) error {
+	if !isImportDocument(message) {
+		return nil
+	}
+
+	locale := coordinator.getLocale(message)
+
+	if message.Document.FileSize > maxImportSize {
+		return coordinator.sendReply(
+			message,
+			locale.Translate("The document is too large"),
+		)
+	}
+
+	reader, err := coordinator.transport.Download(&message.Document.File)
+	if err != nil {
+		return karma.Format(err, "unable to download document")
+	}
+
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxImportSize))
+	if err != nil {
+		return karma.Format(err, "unable to read document")
+	}
+
+	items, err := decodeSubscriptions(data)
+	if err != nil {
+		return coordinator.sendReply(
+			message,
+			locale.Sprintf("Unable to read the document: %s", err),
+		)
+	}
+
+	chat := message.Chat
+	if chat == nil {
+		chat = &tb.Chat{ID: int64(message.Sender.ID)}
+	}
+
+	count, err := coordinator.importSubscriptions(
+		items,
+		chat,
+		coordinator.isBotAdmin(message.Sender.ID),
+	)
+	if err != nil {
+		if karma.Find(err, validationError{}) {
+			return coordinator.sendReply(
+				message,
+				locale.Sprintf("Unable to import: %s", err),
+			)
+		}
+
+		return err
+	}
+
+	return coordinator.sendReply(
+		message,
+		locale.Sprintf("Imported %d subscriptions", count),
+	)
+}
+
+func isImportDocument(message *tb.Message) bool {
+	return message.Document != nil &&
+		strings.HasPrefix(strings.TrimSpace(message.Caption), "/import")
+}
+
+// runExport writes all subscriptions to output, it's used by export
+// subcommand.
+func runExport(config *Config, format string, output io.Writer) error {
+	database, err := OpenStorage(config, context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer database.Disconnect()
+
+	subscribers, err := database.listSubscriptions()
+	if err != nil {
+		return karma.Format(err, "unable to list subscriptions")
+	}
+
+	data, err := encodeSubscriptions(subscribers, format)
+	if err != nil {
+		return err
+	}
+
+	_, err = output.Write(data)
+	return err
+}
+
+// runImport creates subscriptions from the document, it's used by import
+// subcommand.
+func runImport(config *Config, input io.Reader) error {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return karma.Format(err, "unable to read subscriptions")
+	}
+
+	items, err := decodeSubscriptions(data)
+	if err != nil {
+		return err
+	}
+
+	database, err := OpenStorage(config, context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer database.Disconnect()
+
+	coordinator := NewCoordinator(nil, database, config)
+
+	count, err := coordinator.importSubscriptions(items, nil, true)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(nil, "imported %d subscriptions", count)
+
+	return nil
+}
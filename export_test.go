@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func Test_Coordinator_ExportsAndImportsSubscriptions(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(writer, `{"value": 1}`)
+		},
+	))
+	defer server.Close()
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	err = coordinator.subscribe(createMessage(server.URL, "10s", "value,other", 1, 2))
+	assert.NoError(t, err)
+
+	export := createMessage("", "", "", 1, 2)
+	export.Payload = "yaml"
+
+	err = coordinator.export(export)
+	assert.NoError(t, err)
+	assert.Equal(t, "subscriptions.yaml", telegramBot.documentName)
+
+	items, err := decodeSubscriptions(telegramBot.documentData)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]exportedSubscription{{
+			ChatID:   2,
+			URL:      server.URL,
+			Duration: "10s",
+			Keys:     []string{"value", "other"},
+		}},
+		items,
+	)
+
+	telegramBot.files = map[string][]byte{"document": telegramBot.documentData}
+
+	document := createMessage("", "", "", 1, 3)
+	document.Caption = "/import"
+	document.Document = &tb.Document{File: tb.File{FileID: "document"}}
+
+	err = coordinator.importDocument(document)
+	assert.NoError(t, err)
+	assert.Equal(t, "Imported 1 subscriptions", telegramBot.lastSentMessage)
+
+	subscribers, err := coordinator.database.findChatSubscriptions(3)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+	assert.Equal(t, server.URL, subscribers[0].URL)
+	assert.Equal(t, []string{"value", "other"}, subscribers[0].Keys)
+}
+
+func Test_importSubscriptions_ValidatesBeforeSaving(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	_, err = coordinator.importSubscriptions(
+		[]exportedSubscription{
+			{ChatID: 2, URL: "http://example.com/", Duration: "1m", Keys: []string{"a"}},
+			{ChatID: 2, URL: "http://example.com/b", Duration: "never"},
+		},
+		nil,
+		false,
+	)
+	assert.Error(t, err)
+
+	subscribers, err := coordinator.database.listSubscriptions()
+	assert.NoError(t, err)
+	assert.Empty(t, subscribers)
+}
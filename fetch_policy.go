@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	karma "github.com/reconquest/karma-go"
+)
+
+// forbiddenNetworks can't be reached by urls given by users: loopback,
+// private, link-local (including cloud metadata services), carrier-grade
+// nat and other special purpose ranges.
+var forbiddenNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// ForbiddenURLError is returned when the url points to a denied host or
+// resolves to a forbidden address.
+type ForbiddenURLError struct {
+	Host string
+	IP   net.IP
+}
+
+func (err *ForbiddenURLError) Error() string {
+	if err.IP == nil {
+		return fmt.Sprintf("host %s is not allowed", err.Host)
+	}
+
+	return fmt.Sprintf("address %s of host %s is not allowed", err.IP, err.Host)
+}
+
+// checkHost rejects hosts listed in deny_hosts.
+func (fetcher *Fetcher) checkHost(host string) error {
+	if matchHost(fetcher.config.DenyHosts, host) {
+		return &ForbiddenURLError{Host: host}
+	}
+
+	return nil
+}
+
+// isAllowedHost reports whether the address check is skipped for the host.
+func (fetcher *Fetcher) isAllowedHost(host string) bool {
+	return fetcher.config.AllowPrivate ||
+		matchHost(fetcher.config.AllowHosts, host)
+}
+
+func (fetcher *Fetcher) checkIP(host string, ip net.IP) error {
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return &ForbiddenURLError{Host: host, IP: ip}
+		}
+	}
+
+	return nil
+}
+
+// resolve returns addresses of the host, it fails if any of them is
+// forbidden.
+func (fetcher *Fetcher) resolve(ctx context.Context, host string) (
+	[]net.IP,
+	error,
+) {
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, address := range addresses {
+		err := fetcher.checkIP(host, address.IP)
+		if err != nil {
+			return nil, err
+		}
+
+		ips = append(ips, address.IP)
+	}
+
+	return ips, nil
+}
+
+// dialRestricted connects to the checked address instead of the host name,
+// so the name can't resolve to another address between check and connect.
+func (fetcher *Fetcher) dialRestricted(
+	ctx context.Context,
+	network string,
+	address string,
+) (net.Conn, error) {
+	dialer := fetcher.newDialer()
+
+	// the proxy is configured by the operator, targets of proxied requests
+	// are checked by checkProxiedURL
+	if fetcher.proxyAddress != "" && address == fetcher.proxyAddress {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fetcher.checkHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if fetcher.isAllowedHost(host) {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	ips, err := fetcher.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = dialer.DialContext(
+			ctx,
+			network,
+			net.JoinHostPort(ip.String(), port),
+		)
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+// checkURL is done before a subscription is created, it rejects urls which
+// the fetcher won't request, so users can't share endpoints of trusted
+// subscriptions. Resolution failures are not reported here, the url may
+// become resolvable later.
+func (fetcher *Fetcher) checkURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return karma.Format(err, "unable to parse url")
+	}
+
+	host := parsed.Hostname()
+
+	err = fetcher.checkHost(host)
+	if err != nil {
+		return err
+	}
+
+	if fetcher.isAllowedHost(host) {
+		return nil
+	}
+
+	_, err = fetcher.resolve(ctx, host)
+	if _, ok := err.(*ForbiddenURLError); ok {
+		return err
+	}
+
+	return nil
+}
+
+// checkProxiedURL is done before every restricted request which goes
+// through the proxy, such connections are made by the proxy and can't be
+// checked on dial.
+func (fetcher *Fetcher) checkProxiedURL(
+	ctx context.Context,
+	rawURL string,
+	trusted bool,
+) error {
+	if fetcher.proxy == nil || trusted {
+		return nil
+	}
+
+	return fetcher.checkURL(ctx, rawURL)
+}
+
+// matchHost reports whether the host equals to one of patterns or is a
+// subdomain of it.
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if host == pattern || strings.HasSuffix(host, "."+pattern) {
+			return true
+		}
+	}
+
+	return false
+}
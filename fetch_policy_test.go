@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Fetcher_RejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Write([]byte(`{"secret": true}`))
+		},
+	))
+	defer server.Close()
+
+	fetcher := NewFetcher(FetchConfig{}, 1024)
+
+	_, err := fetcher.client(false).Get(server.URL)
+	var forbidden *ForbiddenURLError
+	assert.True(t, errors.As(err, &forbidden))
+
+	response, err := fetcher.client(true).Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+
+	fetcher = NewFetcher(FetchConfig{AllowHosts: []string{"127.0.0.1"}}, 1024)
+
+	response, err = fetcher.client(false).Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+}
+
+func Test_Fetcher_ChecksRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			http.Redirect(writer, request, "http://metadata.internal/", http.StatusFound)
+		},
+	))
+	defer server.Close()
+
+	fetcher := NewFetcher(FetchConfig{
+		AllowPrivate: true,
+		DenyHosts:    []string{"internal"},
+		MaxRedirects: 5,
+	}, 1024)
+
+	_, err := fetcher.client(true).Get(server.URL)
+	var forbidden *ForbiddenURLError
+	assert.True(t, errors.As(err, &forbidden))
+	assert.Equal(t, "metadata.internal", forbidden.Host)
+}
+
+func Test_Fetcher_checkURL(t *testing.T) {
+	fetcher := NewFetcher(FetchConfig{DenyHosts: []string{"example.com"}}, 1024)
+
+	assert.Error(t, fetcher.checkURL(context.Background(), "http://169.254.169.254/latest/"))
+	assert.Error(t, fetcher.checkURL(context.Background(), "http://[::1]:27017/"))
+	assert.Error(t, fetcher.checkURL(context.Background(), "https://api.EXAMPLE.com/"))
+	assert.NoError(t, fetcher.checkURL(context.Background(), "http://8.8.8.8/"))
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Fetcher makes requests to urls given by users. Both clients share the
+// settings of [fetch] config and keep their own connection pools.
+// Addresses are checked after DNS resolution when connecting, so redirects
+// and DNS rebinding can't reach internal services either. Trusted
+// requests, made for subscriptions of bot admins, skip the address check.
+type Fetcher struct {
+	config FetchConfig
+
+	// larger responses are not decoded
+	maxResponseSize int64
+
+	// proxy is used for all requests if set, proxyAddress is its host and
+	// port as they are given to the dialer
+	proxy        *url.URL
+	proxyAddress string
+
+	restricted *http.Client
+	trusted    *http.Client
+
+	metricHosts *metricHosts
+}
+
+func NewFetcher(config FetchConfig, maxResponseSize int64) *Fetcher {
+	fetcher := &Fetcher{
+		config:          config,
+		maxResponseSize: maxResponseSize,
+		proxy:           config.Proxy.URL,
+		metricHosts:     newMetricHosts(config.MetricHosts),
+	}
+
+	if fetcher.proxy != nil {
+		fetcher.proxyAddress = getURLAddress(fetcher.proxy)
+	}
+
+	fetcher.restricted = fetcher.newClient(fetcher.dialRestricted, false)
+	fetcher.trusted = fetcher.newClient(fetcher.newDialer().DialContext, true)
+
+	return fetcher
+}
+
+func (fetcher *Fetcher) newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   fetcher.config.DialTimeout.Duration,
+		KeepAlive: 30 * time.Second,
+	}
+}
+
+func (fetcher *Fetcher) newClient(
+	dial func(ctx context.Context, network, address string) (net.Conn, error),
+	trusted bool,
+) *http.Client {
+	transport := &http.Transport{
+		DialContext:           dial,
+		TLSHandshakeTimeout:   fetcher.config.TLSHandshakeTimeout.Duration,
+		ResponseHeaderTimeout: fetcher.config.Timeout.Duration,
+		MaxIdleConns:          fetcher.config.MaxIdleConns,
+		MaxIdleConnsPerHost:   fetcher.config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       fetcher.config.IdleConnTimeout.Duration,
+		ForceAttemptHTTP2:     true,
+	}
+
+	// environment variables are ignored to keep requests predictable
+	if fetcher.proxy != nil {
+		transport.Proxy = http.ProxyURL(fetcher.proxy)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   fetcher.config.Timeout.Duration,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return fetcher.checkRedirect(request, via, trusted)
+		},
+	}
+}
+
+func (fetcher *Fetcher) client(trusted bool) *http.Client {
+	if trusted {
+		return fetcher.trusted
+	}
+
+	return fetcher.restricted
+}
+
+func (fetcher *Fetcher) checkRedirect(
+	request *http.Request,
+	via []*http.Request,
+	trusted bool,
+) error {
+	if len(via) > fetcher.config.MaxRedirects {
+		return &RedirectError{Limit: fetcher.config.MaxRedirects}
+	}
+
+	err := fetcher.checkHost(request.URL.Hostname())
+	if err != nil {
+		return err
+	}
+
+	return fetcher.checkProxiedURL(
+		request.Context(),
+		request.URL.String(),
+		trusted,
+	)
+}
+
+// getURLAddress returns host and port of the url, the port is guessed by
+// scheme if it's omitted.
+func getURLAddress(target *url.URL) string {
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(target.Hostname(), port)
+}
+
+// TimeoutError is returned when the url didn't respond in time.
+type TimeoutError struct {
+	err error
+}
+
+func (err *TimeoutError) Error() string {
+	return "request timed out: " + err.err.Error()
+}
+
+// DNSError is returned when the host of the url can't be resolved.
+type DNSError struct {
+	Host string
+	err  error
+}
+
+func (err *DNSError) Error() string {
+	return fmt.Sprintf("unable to resolve host %s: %s", err.Host, err.err)
+}
+
+// CertificateError is returned when the endpoint certificate can't be
+// verified: it is self-signed, expired or issued for another host.
+type CertificateError struct {
+	err error
+}
+
+func (err *CertificateError) Error() string {
+	return "tls certificate verification failed: " + err.err.Error()
+}
+
+// ConnectionError is returned for other failures of the request: refused
+// or reset connections, broken tls handshakes and so on.
+type ConnectionError struct {
+	err error
+}
+
+func (err *ConnectionError) Error() string {
+	return "unable to connect: " + err.err.Error()
+}
+
+// RedirectError is returned when the url redirects too many times.
+type RedirectError struct {
+	Limit int
+}
+
+func (err *RedirectError) Error() string {
+	return fmt.Sprintf("stopped after %d redirects", err.Limit)
+}
+
+// StatusError is returned when the url responds with a non-2xx status and
+// such responses are treated as failures.
+type StatusError struct {
+	StatusCode int
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", err.StatusCode)
+}
+
+// DecodeError is returned when the response is not a json object.
+type DecodeError struct {
+	err error
+}
+
+func (err *DecodeError) Error() string {
+	return "unable to decode response: " + err.err.Error()
+}
+
+// ResponseTooLargeError is returned when the response is larger than
+// max_response_size.
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (err *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response is larger than %d bytes", err.Limit)
+}
+
+// classifyRequestError turns an error of http.Client into one of fetch
+// errors, so the reason shown to subscribers doesn't depend on how deep
+// in the stack the request failed.
+func classifyRequestError(err error) error {
+	var (
+		forbidden *ForbiddenURLError
+		redirect  *RedirectError
+		dns       *net.DNSError
+		network   net.Error
+	)
+
+	switch {
+	case errors.As(err, &forbidden):
+		return forbidden
+	case errors.As(err, &redirect):
+		return redirect
+	case isCertificateError(err):
+		return &CertificateError{err: err}
+	case errors.As(err, &dns):
+		return &DNSError{Host: dns.Name, err: errors.New(dns.Err)}
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &network) && network.Timeout():
+		return &TimeoutError{err: err}
+	default:
+		return &ConnectionError{err: err}
+	}
+}
+
+func isCertificateError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+	)
+
+	return errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFetchConfig() FetchConfig {
+	return FetchConfig{
+		AllowPrivate: true,
+		Timeout:      Duration{time.Second},
+		MaxRedirects: 2,
+		UserAgent:    "test-agent",
+	}
+}
+
+func Test_Fetcher_ReturnsTypedErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(2 * time.Second)
+	})
+	mux.HandleFunc("/text", func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprint(writer, "not json")
+	})
+	mux.HandleFunc("/loop", func(writer http.ResponseWriter, request *http.Request) {
+		http.Redirect(writer, request, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/agent", func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintf(writer, `{"agent": %q}`, request.UserAgent())
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := NewFetcher(newTestFetchConfig(), 1024)
+	ctx := context.Background()
+
+	_, err := fetcher.fetchJSON(ctx, server.URL+"/slow", false)
+	assert.IsType(t, &TimeoutError{}, err)
+
+	_, err = fetcher.fetchJSON(ctx, server.URL+"/text", false)
+	assert.IsType(t, &DecodeError{}, err)
+
+	_, err = fetcher.fetchJSON(ctx, server.URL+"/loop", false)
+	assert.Equal(t, &RedirectError{Limit: 2}, err)
+
+	_, err = fetcher.fetchJSON(ctx, "http://host.invalid/", false)
+	assert.IsType(t, &DNSError{}, err)
+
+	result, err := fetcher.fetchJSON(ctx, server.URL+"/agent", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-agent", result.Data["agent"])
+}
+
+func Test_Fetcher_UsesProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprintf(writer, `{"url": %q}`, request.URL.String())
+		},
+	))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	assert.NoError(t, err)
+
+	config := newTestFetchConfig()
+	config.AllowPrivate = false
+	config.Proxy = URL{proxyURL}
+
+	fetcher := NewFetcher(config, 1024)
+
+	// the proxy itself is on a private address, only targets are checked
+	result, err := fetcher.fetchJSON(
+		context.Background(),
+		"http://8.8.8.8/data",
+		false,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://8.8.8.8/data", result.Data["url"])
+
+	_, err = fetcher.fetchJSON(
+		context.Background(),
+		"http://127.0.0.1/data",
+		false,
+	)
+	assert.IsType(t, &ForbiddenURLError{}, err)
+}
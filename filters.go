@@ -0,0 +1,514 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/reconquest/notify-telegram-bot/internal/args"
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+
+	karma "github.com/reconquest/karma-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	filterOn  = "on"
+	filterOff = "off"
+
+	maxFilterPrecision = 10
+)
+
+// Filters hide changes which are noise: keys which change on every request,
+// small fluctuations of numbers and arrays which come in a different order.
+// They are applied only to decide whether values changed, notifications
+// still contain the original values.
+type Filters struct {
+	// Ignore are globs of key paths which are not compared, * matches a
+	// single key. Globs without dots match keys at any depth.
+	Ignore []string `bson:"ignore"`
+
+	// Precision is the number of decimals numbers are rounded to, nil
+	// doesn't round them.
+	Precision *int `bson:"precision"`
+
+	// Tolerance is the largest difference of numbers treated as equal.
+	Tolerance float64 `bson:"tolerance"`
+
+	// SortArrays makes arrays with the same items in any order equal.
+	SortArrays bool `bson:"sort_arrays"`
+}
+
+// NotifiedValue is a value of a key the subscriber was notified about.
+type NotifiedValue struct {
+	Key   string      `bson:"key"`
+	Value interface{} `bson:"value"`
+}
+
+// IsEmpty reports whether no filter is set.
+func (filters Filters) IsEmpty() bool {
+	return len(filters.Ignore) == 0 &&
+		filters.Precision == nil &&
+		filters.Tolerance == 0 &&
+		!filters.SortArrays
+}
+
+// IsIgnored reports whether the key path matches any ignored glob.
+func (filters Filters) IsIgnored(key string) bool {
+	name := key
+	if index := strings.LastIndex(key, "."); index >= 0 {
+		name = key[index+1:]
+	}
+
+	for _, glob := range filters.Ignore {
+		subject := key
+		if !strings.Contains(glob, ".") {
+			subject = name
+		}
+
+		// path.Match doesn't let * match the separator, so keys are
+		// matched as paths to keep * within a single key
+		matched, err := path.Match(
+			strings.Replace(glob, ".", "/", -1),
+			strings.Replace(subject, ".", "/", -1),
+		)
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Equal reports whether values of the key are the same after filters are
+// applied.
+func (filters Filters) Equal(key string, value, previous interface{}) bool {
+	return filters.equal(
+		filters.normalize(key, value),
+		filters.normalize(key, previous),
+	)
+}
+
+// getBaseline returns the value changes of the key are compared against.
+// Filtered keys are compared against the value the subscriber has seen, so
+// a value drifting by less than the tolerance on every refresh is reported
+// once the drift adds up.
+func (subscriber Subscriber) getBaseline(
+	key string,
+	previous interface{},
+) interface{} {
+	if subscriber.Filters.IsEmpty() {
+		return previous
+	}
+
+	for _, notified := range subscriber.Notified {
+		if notified.Key == key {
+			return notified.Value
+		}
+	}
+
+	return previous
+}
+
+// rememberNotifiedValues stores values of filtered keys the subscriber has
+// seen after the endpoint data was compared, they are baselines of the next
+// comparison.
+func (coordinator *Coordinator) rememberNotifiedValues(
+	subscriber Subscriber,
+	endpoint Endpoint,
+) error {
+	if subscriber.Filters.IsEmpty() {
+		return nil
+	}
+
+	var values []NotifiedValue
+	for _, key := range subscriber.Keys {
+		nestedKey := strings.Split(key, ".")
+
+		updatedData, _ := getValueByKey(endpoint.Data, nestedKey)
+		previousData, _ := getValueByKey(endpoint.PreviousData, nestedKey)
+
+		value := subscriber.getBaseline(key, previousData)
+		if updatedData != nil && !subscriber.Filters.IsIgnored(key) &&
+			!subscriber.Filters.Equal(key, updatedData, value) {
+			value = updatedData
+		}
+
+		if value != nil {
+			values = append(values, NotifiedValue{Key: key, Value: value})
+		}
+	}
+
+	if isSameNotified(values, subscriber.Notified) {
+		return nil
+	}
+
+	err := coordinator.database.setSubscriberNotified(subscriber.ID, values)
+	if err != nil {
+		return karma.Format(err, "unable to save notified values of subscriber")
+	}
+
+	return nil
+}
+
+func isSameNotified(values, notified []NotifiedValue) bool {
+	if len(values) != len(notified) {
+		return false
+	}
+
+	for i := range values {
+		if values[i].Key != notified[i].Key ||
+			!(Filters{}).Equal("", values[i].Value, notified[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalize brings values decoded by json and bson to the same types, drops
+// ignored keys, rounds numbers and sorts arrays.
+func (filters Filters) normalize(key string, value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		object := map[string]interface{}{}
+		for name, item := range typed {
+			object[name] = item
+		}
+
+		return filters.normalizeObject(key, object)
+
+	case primitive.M:
+		return filters.normalize(key, map[string]interface{}(typed))
+
+	case primitive.D:
+		return filters.normalize(key, typed.Map())
+
+	case primitive.A:
+		return filters.normalize(key, []interface{}(typed))
+
+	case []interface{}:
+		var items []interface{}
+		for _, item := range typed {
+			items = append(items, filters.normalize(key, item))
+		}
+
+		if filters.SortArrays {
+			sortItems(items)
+		}
+
+		return items
+	}
+
+	if number, ok := getNumber(value); ok {
+		if filters.Precision != nil {
+			scale := math.Pow(10, float64(*filters.Precision))
+			number = math.Round(number*scale) / scale
+		}
+
+		return number
+	}
+
+	return value
+}
+
+func (filters Filters) normalizeObject(
+	key string,
+	object map[string]interface{},
+) interface{} {
+	for name, item := range object {
+		child := name
+		if key != "" {
+			child = key + "." + name
+		}
+
+		if filters.IsIgnored(child) {
+			delete(object, name)
+			continue
+		}
+
+		object[name] = filters.normalize(child, item)
+	}
+
+	return object
+}
+
+func (filters Filters) equal(value, previous interface{}) bool {
+	switch typed := value.(type) {
+	case float64:
+		number, ok := previous.(float64)
+		return ok && math.Abs(typed-number) <= filters.Tolerance
+
+	case map[string]interface{}:
+		object, ok := previous.(map[string]interface{})
+		if !ok || len(object) != len(typed) {
+			return false
+		}
+
+		for name, item := range typed {
+			other, ok := object[name]
+			if !ok || !filters.equal(item, other) {
+				return false
+			}
+		}
+
+		return true
+
+	case []interface{}:
+		items, ok := previous.([]interface{})
+		if !ok || len(items) != len(typed) {
+			return false
+		}
+
+		for i := range typed {
+			if !filters.equal(typed[i], items[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(value, previous)
+}
+
+func getNumber(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case float64:
+		return typed, true
+	case float32:
+		return float64(typed), true
+	case int:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	}
+
+	return 0, false
+}
+
+// sortItems orders normalized items by their json encoding, so the order
+// doesn't depend on the order they came in.
+func sortItems(items []interface{}) {
+	encoded := make([]string, len(items))
+	for i, item := range items {
+		data, _ := json.Marshal(item)
+		encoded[i] = string(data)
+	}
+
+	sort.Sort(encodedItems{items: items, encoded: encoded})
+}
+
+type encodedItems struct {
+	items   []interface{}
+	encoded []string
+}
+
+func (items encodedItems) Len() int {
+	return len(items.items)
+}
+
+func (items encodedItems) Less(i, j int) bool {
+	return items.encoded[i] < items.encoded[j]
+}
+
+func (items encodedItems) Swap(i, j int) {
+	items.items[i], items.items[j] = items.items[j], items.items[i]
+	items.encoded[i], items.encoded[j] = items.encoded[j], items.encoded[i]
+}
+
+// filter shows or changes filters of the subscription.
+func (coordinator *Coordinator) filter(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(
+		message, 2, "ignore", "round", "tolerance", "sort",
+	)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+
+	subscriptionID, err := primitive.ObjectIDFromHex(arguments.Get(0))
+	if err != nil {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"Subscription ID required!\nIn format:  /filter subscriptionID "+
+					"[ignore=*.timestamp,request_id] [round=2] [tolerance=0.5] "+
+					"[sort=on]",
+			),
+		)
+	}
+
+	subscriber, err := coordinator.database.getSubscription(subscriptionID)
+	if err != nil {
+		return karma.Format(err, "unable to find subscription")
+	}
+
+	if subscriber == nil || subscriber.UserID != getRecipientID(message) {
+		return coordinator.sendReply(
+			message,
+			locale.Translate("You don't have subscription with this id"),
+		)
+	}
+
+	if subscriber.Kind == SubscriptionUptime {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"This subscription doesn't have json keys, use /status to "+
+					"see the state of its url",
+			),
+		)
+	}
+
+	clear := false
+	switch arguments.Get(1) {
+	case "":
+	case "clear":
+		clear = true
+	default:
+		return coordinator.replyArgsError(message, &args.Error{
+			Reason: args.UnexpectedArgument,
+			Token:  arguments.Get(1),
+		})
+	}
+
+	if !clear && len(arguments.Options) == 0 {
+		return coordinator.sendReply(
+			message,
+			formatFilters(locale, subscriber),
+		)
+	}
+
+	if subscriber.Managed {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"This subscription is managed by the configuration file and "+
+					"can't be changed",
+			),
+		)
+	}
+
+	filters := subscriber.Filters
+	if clear {
+		filters = Filters{}
+	}
+
+	err = applyFilterOptions(&filters, *arguments)
+	if invalid, ok := err.(*args.Error); ok {
+		return coordinator.replyArgsError(message, invalid)
+	} else if err != nil {
+		return err
+	}
+
+	err = coordinator.database.setSubscriberFilters(subscriber.ID, filters)
+	if err != nil {
+		return karma.Format(err, "unable to set filters of subscription")
+	}
+
+	subscriber.Filters = filters
+
+	return coordinator.sendReply(message, formatFilters(locale, subscriber))
+}
+
+// applyFilterOptions changes filters given as options of /filter.
+func applyFilterOptions(filters *Filters, arguments args.Args) error {
+	invalid := func(name string) error {
+		return &args.Error{
+			Reason: args.InvalidValue,
+			Token:  name + "=" + arguments.Options[name],
+		}
+	}
+
+	if value, ok := arguments.Options["ignore"]; ok {
+		filters.Ignore = parseKeys(value)
+		for _, glob := range filters.Ignore {
+			_, err := path.Match(glob, "")
+			if err != nil {
+				return invalid("ignore")
+			}
+		}
+	}
+
+	if value, ok := arguments.Options["round"]; ok {
+		if value == filterOff {
+			filters.Precision = nil
+		} else {
+			precision, err := strconv.Atoi(value)
+			if err != nil || precision < 0 || precision > maxFilterPrecision {
+				return invalid("round")
+			}
+
+			filters.Precision = &precision
+		}
+	}
+
+	if value, ok := arguments.Options["tolerance"]; ok {
+		if value == filterOff {
+			filters.Tolerance = 0
+		} else {
+			tolerance, err := strconv.ParseFloat(value, 64)
+			if err != nil || tolerance < 0 ||
+				math.IsInf(tolerance, 0) || math.IsNaN(tolerance) {
+				return invalid("tolerance")
+			}
+
+			filters.Tolerance = tolerance
+		}
+	}
+
+	if value, ok := arguments.Options["sort"]; ok {
+		switch value {
+		case filterOn:
+			filters.SortArrays = true
+		case filterOff:
+			filters.SortArrays = false
+		default:
+			return invalid("sort")
+		}
+	}
+
+	return nil
+}
+
+func formatFilters(locale i18n.Locale, subscriber *Subscriber) string {
+	filters := subscriber.Filters
+
+	ignore := locale.Translate("none")
+	if len(filters.Ignore) > 0 {
+		ignore = strings.Join(filters.Ignore, ", ")
+	}
+
+	round := filterOff
+	if filters.Precision != nil {
+		round = strconv.Itoa(*filters.Precision)
+	}
+
+	tolerance := filterOff
+	if filters.Tolerance != 0 {
+		tolerance = locale.FormatNumber(filters.Tolerance)
+	}
+
+	sortArrays := filterOff
+	if filters.SortArrays {
+		sortArrays = filterOn
+	}
+
+	return locale.Sprintf(
+		"ID - %s\n\nIGNORE - %s\nROUND - %s\nTOLERANCE - %s\nSORT - %s",
+		subscriber.ID.Hex(),
+		ignore,
+		round,
+		tolerance,
+		sortArrays,
+	)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_Filters_Equal(t *testing.T) {
+	precision := 1
+
+	testcases := []struct {
+		name     string
+		filters  Filters
+		value    interface{}
+		previous interface{}
+		equal    bool
+	}{
+		{
+			name:     "no filters",
+			value:    map[string]interface{}{"a": 1.0, "b": "x"},
+			previous: map[string]interface{}{"a": 1.0, "b": "y"},
+			equal:    false,
+		},
+		{
+			name:     "bson and json types",
+			value:    map[string]interface{}{"a": []interface{}{1.0}},
+			previous: primitive.D{{Key: "a", Value: primitive.A{int32(1)}}},
+			equal:    true,
+		},
+		{
+			name:     "ignored key at any depth",
+			filters:  Filters{Ignore: []string{"updated_at"}},
+			value:    map[string]interface{}{"cpu": map[string]interface{}{"updated_at": 2.0}},
+			previous: map[string]interface{}{"cpu": map[string]interface{}{"updated_at": 1.0}},
+			equal:    true,
+		},
+		{
+			name:     "ignored glob",
+			filters:  Filters{Ignore: []string{"metrics.*.id"}},
+			value:    map[string]interface{}{"cpu": map[string]interface{}{"id": "b", "load": 1.0}},
+			previous: map[string]interface{}{"cpu": map[string]interface{}{"id": "a", "load": 1.0}},
+			equal:    true,
+		},
+		{
+			name:     "glob doesn't match other depth",
+			filters:  Filters{Ignore: []string{"metrics.*.id"}},
+			value:    map[string]interface{}{"id": "b"},
+			previous: map[string]interface{}{"id": "a"},
+			equal:    false,
+		},
+		{
+			name:     "rounded",
+			filters:  Filters{Precision: &precision},
+			value:    1.04,
+			previous: 1.01,
+			equal:    true,
+		},
+		{
+			name:     "within tolerance",
+			filters:  Filters{Tolerance: 0.5},
+			value:    10.4,
+			previous: 10.0,
+			equal:    true,
+		},
+		{
+			name:     "out of tolerance",
+			filters:  Filters{Tolerance: 0.5},
+			value:    10.6,
+			previous: 10.0,
+			equal:    false,
+		},
+		{
+			name:     "sorted arrays",
+			filters:  Filters{SortArrays: true},
+			value:    []interface{}{"b", "a", 1.0},
+			previous: primitive.A{"a", int64(1), "b"},
+			equal:    true,
+		},
+		{
+			name:     "unsorted arrays",
+			value:    []interface{}{"b", "a"},
+			previous: []interface{}{"a", "b"},
+			equal:    false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		assert.Equal(
+			t,
+			testcase.equal,
+			testcase.filters.Equal("metrics", testcase.value, testcase.previous),
+			testcase.name,
+		)
+	}
+}
+
+func Test_Coordinator_FiltersNoisyChanges(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	subscriber := Subscriber{
+		URL:      "http://example.com/",
+		UserID:   2,
+		Duration: time.Minute,
+		Keys:     []string{"metrics"},
+	}
+
+	err = coordinator.database.upsertSubscriber(subscriber)
+	assert.NoError(t, err)
+
+	stored, err := coordinator.database.findSubscriber(2, subscriber.URL)
+	assert.NoError(t, err)
+
+	id := stored.ID.Hex()
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = id + " ignore=*.requested_at round=x"
+	err = coordinator.filter(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Invalid arguments, invalid value: round=x",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = id + " ignore=*.requested_at tolerance=0.5"
+	err = coordinator.filter(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"ID - "+id+"\n\nIGNORE - *.requested_at\nROUND - off\n"+
+			"TOLERANCE - 0.5\nSORT - off",
+		telegramBot.lastSentMessage,
+	)
+
+	stored, err = coordinator.database.findSubscriber(2, subscriber.URL)
+	assert.NoError(t, err)
+
+	endpoint := Endpoint{
+		Data: map[string]interface{}{"metrics": map[string]interface{}{
+			"load":         1.2,
+			"requested_at": "2020-01-01T00:00:01Z",
+		}},
+		PreviousData: map[string]interface{}{"metrics": map[string]interface{}{
+			"load":         1.0,
+			"requested_at": "2020-01-01T00:00:00Z",
+		}},
+		UpdatedAt: time.Now(),
+	}
+
+	notifications := coordinator.prepareMessageForSubscriber(
+		stored.Keys,
+		endpoint,
+		*stored,
+	)
+	assert.Empty(t, notifications)
+
+	endpoint.Data["metrics"].(map[string]interface{})["load"] = 2.0
+
+	notifications = coordinator.prepareMessageForSubscriber(
+		stored.Keys,
+		endpoint,
+		*stored,
+	)
+	assert.Len(t, notifications, 1)
+
+	message.Payload = id + " clear"
+	err = coordinator.filter(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"ID - "+id+"\n\nIGNORE - none\nROUND - off\nTOLERANCE - off\nSORT - off",
+		telegramBot.lastSentMessage,
+	)
+}
+
+func Test_Storage_KeepsSubscriberFilters(t *testing.T) {
+	database := createTestDatabase()
+	defer database.Drop()
+
+	err := database.upsertSubscriber(Subscriber{
+		URL:    "http://example.com/",
+		UserID: 2,
+		Keys:   []string{"a"},
+	})
+	assert.NoError(t, err)
+
+	subscriber, err := database.findSubscriber(2, "http://example.com/")
+	assert.NoError(t, err)
+
+	precision := 2
+	filters := Filters{
+		Ignore:     []string{"*.id"},
+		Precision:  &precision,
+		Tolerance:  0.5,
+		SortArrays: true,
+	}
+
+	err = database.setSubscriberFilters(subscriber.ID, filters)
+	assert.NoError(t, err)
+
+	// subscribing again keeps filters
+	err = database.upsertSubscriber(Subscriber{
+		URL:    "http://example.com/",
+		UserID: 2,
+		Keys:   []string{"a", "b"},
+	})
+	assert.NoError(t, err)
+
+	subscriber, err = database.getSubscription(subscriber.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, filters, subscriber.Filters)
+}
+
+func Test_Coordinator_FiltersReportDriftSinceLastNotification(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	var mutex sync.Mutex
+	load := 1.0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			fmt.Fprintf(writer, `{"load": %v}`, load)
+		},
+	))
+	defer server.Close()
+
+	setLoad := func(value float64) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		load = value
+	}
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	tick := func(duration time.Duration) {
+		clock.Advance(duration)
+		assert.NoError(t, coordinator.routineUpdateEndpoints())
+		assert.NoError(t, coordinator.routineSendDataToSubscribers())
+		assert.NoError(t, coordinator.routineSendOutbox())
+	}
+
+	err = coordinator.subscribe(createMessage(server.URL, "10s", "load", 1, 2))
+	assert.NoError(t, err)
+
+	subscriber, err := coordinator.database.findSubscriber(2, server.URL)
+	assert.NoError(t, err)
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = subscriber.ID.Hex() + " tolerance=0.5"
+	err = coordinator.filter(message)
+	assert.NoError(t, err)
+
+	tick(time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 2)
+
+	// every refresh is within tolerance of the previous one
+	setLoad(1.4)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 2)
+
+	setLoad(1.8)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 3)
+	assert.Contains(t, telegramBot.lastSentMessage, "\n\n1.8")
+
+	setLoad(2.2)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 3)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type healthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// serveHealthz reports whether the process should be restarted: a background
+// loop or the telegram poller didn't succeed for too long.
+func (coordinator *Coordinator) serveHealthz(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	timeout := coordinator.config.HTTP.StallTimeout.Duration
+	now := time.Now()
+
+	var checks []healthCheck
+	for _, routine := range coordinator.routines {
+		check := healthCheck{Name: routine.name, OK: true}
+
+		lastSuccess, lastErr := routine.LastSuccess()
+		// the loop may not have finished its first iteration yet
+		if lastSuccess.IsZero() {
+			lastSuccess = coordinator.startedAt
+		}
+
+		if now.Sub(lastSuccess) > routine.interval+timeout {
+			check.OK = false
+			check.Error = "no successful iteration since " +
+				lastSuccess.Format(time.RFC3339)
+			if lastErr != nil {
+				check.Error += ": " + lastErr.Error()
+			}
+		}
+
+		checks = append(checks, check)
+	}
+
+	if coordinator.poller != nil {
+		check := healthCheck{Name: "telegram poller", OK: true}
+
+		lastPoll := coordinator.poller.LastPoll()
+		if lastPoll.IsZero() {
+			lastPoll = coordinator.startedAt
+		}
+
+		if now.Sub(lastPoll) > coordinator.poller.Timeout+timeout {
+			check.OK = false
+			check.Error = "no successful poll since " +
+				lastPoll.Format(time.RFC3339)
+		}
+
+		checks = append(checks, check)
+	}
+
+	writeHealthChecks(writer, checks)
+}
+
+// serveReadyz reports whether the bot can serve requests: database is
+// reachable and telegram poller has received updates at least once.
+func (coordinator *Coordinator) serveReadyz(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	var checks []healthCheck
+
+	database := healthCheck{Name: "database", OK: true}
+
+	ctx, cancel := context.WithTimeout(request.Context(), 5*time.Second)
+	defer cancel()
+
+	err := coordinator.database.Ping(ctx)
+	if err != nil {
+		database.OK = false
+		database.Error = err.Error()
+	}
+
+	checks = append(checks, database)
+
+	if coordinator.poller != nil {
+		check := healthCheck{Name: "telegram poller", OK: true}
+		if coordinator.poller.LastPoll().IsZero() {
+			check.OK = false
+			check.Error = "telegram is not polled yet"
+		}
+
+		checks = append(checks, check)
+	}
+
+	writeHealthChecks(writer, checks)
+}
+
+func writeHealthChecks(writer http.ResponseWriter, checks []healthCheck) {
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(writer, status, map[string]interface{}{"checks": checks})
+}
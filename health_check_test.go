@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_serveHealthz_FailsIfRoutineIsStalled(t *testing.T) {
+	routine := &Routine{
+		name:     "updating endpoints",
+		interval: time.Second,
+	}
+
+	coordinator := &Coordinator{
+		config: &Config{
+			HTTP: HTTPConfig{StallTimeout: Duration{time.Minute}},
+		},
+		routines:  []*Routine{routine},
+		startedAt: time.Now(),
+	}
+
+	recorder := httptest.NewRecorder()
+	coordinator.serveHealthz(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	routine.lastSuccess = time.Now().Add(-2 * time.Minute)
+
+	recorder = httptest.NewRecorder()
+	coordinator.serveHealthz(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "updating endpoints")
+}
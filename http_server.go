@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/reconquest/pkg/log"
+)
+
+func (coordinator *Coordinator) newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	// metrics are protected by the api token when it's set, otherwise the
+	// listener shouldn't be reachable from outside
+	if coordinator.config.API.Token != "" {
+		mux.Handle("/api/", coordinator.authorizeAPI(
+			http.HandlerFunc(coordinator.serveAPI),
+		))
+		mux.Handle("/metrics", coordinator.authorizeAPI(coordinator.newMetricsHandler()))
+	} else {
+		log.Warningf(nil, "api token is not set, http api is disabled")
+		mux.Handle("/metrics", coordinator.newMetricsHandler())
+	}
+
+	mux.HandleFunc("/webhooks/", coordinator.serveWebhook)
+	mux.HandleFunc("/healthz", coordinator.serveHealthz)
+	mux.HandleFunc("/readyz", coordinator.serveReadyz)
+
+	return mux
+}
+
+func (coordinator *Coordinator) serveHTTP() error {
+	log.Infof(nil, "starting http server on %s", coordinator.config.HTTP.Listen)
+
+	coordinator.server = &http.Server{
+		Addr:    coordinator.config.HTTP.Listen,
+		Handler: coordinator.newHTTPHandler(),
+	}
+
+	err := coordinator.server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+
+	err := json.NewEncoder(writer).Encode(value)
+	if err != nil {
+		log.Errorf(err, "unable to encode http response")
+	}
+}
+
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeJSON(writer, status, map[string]string{"error": message})
+}
@@ -0,0 +1,234 @@
+package args
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reasons of parse errors, they are used as keys of translations.
+const (
+	UnterminatedQuote  = "unterminated quote"
+	OptionWithoutName  = "option without name"
+	DuplicateOption    = "duplicate option"
+	UnknownOption      = "unknown option"
+	UnexpectedArgument = "unexpected argument"
+	InvalidValue       = "invalid value"
+)
+
+// optionName is the part before '=' which makes a token an option, so urls
+// with query strings stay positional arguments.
+var optionName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// quotes maps opening quotes to closing ones, Telegram clients often replace
+// straight quotes with typographic ones.
+var quotes = map[rune]rune{
+	'"':      '"',
+	'\'':     '\'',
+	'\u201c': '\u201d',
+	'\u00ab': '\u00bb',
+}
+
+// Error points at the token which can't be parsed or isn't expected by the
+// command.
+type Error struct {
+	Reason string
+	Token  string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Reason, err.Token)
+}
+
+// Args are arguments of a command: positional arguments in the given order
+// and key=value options.
+type Args struct {
+	Positional []string
+	Options    map[string]string
+
+	// tokens keeps options as they were written for error messages
+	tokens map[string]string
+}
+
+type token struct {
+	value string
+	raw   string
+
+	// equals is the position of the first '=' in value which is not
+	// quoted and not preceded by quotes, -1 if there is no such '='
+	equals int
+	quoted bool
+}
+
+// Parse splits the payload of a command into arguments. Arguments are
+// separated by any number of spaces, quotes keep spaces in arguments and
+// backslash escapes the next character in quotes. Unquoted name=value
+// arguments are options.
+func Parse(payload string) (Args, error) {
+	args := Args{
+		Options: map[string]string{},
+		tokens:  map[string]string{},
+	}
+
+	tokens, err := tokenize(payload)
+	if err != nil {
+		return args, err
+	}
+
+	for _, token := range tokens {
+		if token.equals < 0 {
+			args.Positional = append(args.Positional, token.value)
+			continue
+		}
+
+		name := token.value[:token.equals]
+		if name == "" {
+			return args, &Error{Reason: OptionWithoutName, Token: token.raw}
+		}
+
+		if !optionName.MatchString(name) {
+			args.Positional = append(args.Positional, token.value)
+			continue
+		}
+
+		name = strings.ToLower(name)
+		if _, ok := args.Options[name]; ok {
+			return args, &Error{Reason: DuplicateOption, Token: token.raw}
+		}
+
+		args.Options[name] = token.value[token.equals+1:]
+		args.tokens[name] = token.raw
+	}
+
+	return args, nil
+}
+
+func tokenize(payload string) ([]token, error) {
+	var (
+		tokens  []token
+		current *token
+		value   strings.Builder
+		start   int
+		closing rune
+		escaped bool
+	)
+
+	runes := []rune(payload)
+	for i, char := range runes {
+		if current == nil {
+			if isSpace(char) {
+				continue
+			}
+
+			current = &token{equals: -1}
+			value.Reset()
+			start = i
+		}
+
+		switch {
+		case closing != 0 && escaped:
+			value.WriteRune(char)
+			escaped = false
+
+		case closing != 0 && char == '\\':
+			escaped = true
+
+		case closing != 0 && char == closing:
+			closing = 0
+
+		case closing != 0:
+			value.WriteRune(char)
+
+		case isSpace(char):
+			current.value = value.String()
+			current.raw = string(runes[start:i])
+			tokens = append(tokens, *current)
+			current = nil
+
+		case quotes[char] != 0:
+			closing = quotes[char]
+			current.quoted = true
+
+		case char == '=' && current.equals < 0 && !current.quoted:
+			current.equals = value.Len()
+			value.WriteRune(char)
+
+		default:
+			value.WriteRune(char)
+		}
+	}
+
+	if closing != 0 {
+		return nil, &Error{
+			Reason: UnterminatedQuote,
+			Token:  string(runes[start:]),
+		}
+	}
+
+	if current != nil {
+		current.value = value.String()
+		current.raw = string(runes[start:])
+		tokens = append(tokens, *current)
+	}
+
+	return tokens, nil
+}
+
+func isSpace(char rune) bool {
+	return char == ' ' || char == '\t' || char == '\n' || char == '\u00a0'
+}
+
+// Check returns an error if there are more than max positional arguments or
+// options other than the given ones.
+func (args Args) Check(max int, options ...string) error {
+	if len(args.Positional) > max {
+		return &Error{
+			Reason: UnexpectedArgument,
+			Token:  args.Positional[max],
+		}
+	}
+
+	var names []string
+	for name := range args.Options {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		known := false
+		for _, option := range options {
+			if name == option {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return &Error{Reason: UnknownOption, Token: args.tokens[name]}
+		}
+	}
+
+	return nil
+}
+
+// Get returns the positional argument or an empty string if there are not
+// enough arguments.
+func (args Args) Get(index int) string {
+	if index < len(args.Positional) {
+		return args.Positional[index]
+	}
+
+	return ""
+}
+
+// Option returns the value of the option or the fallback if the option is
+// not given.
+func (args Args) Option(name string, fallback string) string {
+	if value, ok := args.Options[name]; ok {
+		return value
+	}
+
+	return fallback
+}
@@ -0,0 +1,75 @@
+package args
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse_SplitsArguments(t *testing.T) {
+	args, err := Parse("  http://example.com/?a=b   1m \"first key,second\"  format=html name=\"sales team\"")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{"http://example.com/?a=b", "1m", "first key,second"},
+		args.Positional,
+	)
+	assert.Equal(
+		t,
+		map[string]string{"format": "html", "name": "sales team"},
+		args.Options,
+	)
+	assert.Equal(t, "1m", args.Get(1))
+	assert.Equal(t, "", args.Get(3))
+	assert.Equal(t, "change", args.Option("on", "change"))
+}
+
+func TestParse_KeepsQuotedEquals(t *testing.T) {
+	args, err := Parse(`"a=b" 'it\'s' “typed quotes” «x y»`)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{"a=b", "it's", "typed quotes", "x y"},
+		args.Positional,
+	)
+	assert.Empty(t, args.Options)
+}
+
+func TestParse_ReturnsBadToken(t *testing.T) {
+	testcases := []struct {
+		payload string
+		reason  string
+		token   string
+	}{
+		{`url 1m "key`, UnterminatedQuote, `"key`},
+		{`url =html`, OptionWithoutName, `=html`},
+		{`on=change on=error`, DuplicateOption, `on=error`},
+	}
+
+	for _, testcase := range testcases {
+		_, err := Parse(testcase.payload)
+		assert.Equal(
+			t,
+			&Error{Reason: testcase.reason, Token: testcase.token},
+			err,
+			testcase.payload,
+		)
+	}
+}
+
+func TestArgs_Check(t *testing.T) {
+	args, err := Parse("a b format=yaml")
+	assert.NoError(t, err)
+
+	assert.NoError(t, args.Check(2, "format"))
+	assert.Equal(
+		t,
+		&Error{Reason: UnexpectedArgument, Token: "b"},
+		args.Check(1, "format"),
+	)
+	assert.Equal(
+		t,
+		&Error{Reason: UnknownOption, Token: "format=yaml"},
+		args.Check(2),
+	)
+}
@@ -0,0 +1,154 @@
+package i18n
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	English = "en"
+	Russian = "ru"
+)
+
+// Languages are supported languages, English is used for all others.
+var Languages = []string{English, Russian}
+
+// catalogs map messages to their translations, messages are written in
+// English and are fmt formats, so translations must keep their verbs.
+var catalogs = map[string]map[string]string{
+	Russian: russian,
+}
+
+type numberFormat struct {
+	decimal string
+	group   string
+}
+
+var numberFormats = map[string]numberFormat{
+	English: {decimal: ".", group: ","},
+	Russian: {decimal: ",", group: "\u00a0"},
+}
+
+var timeFormats = map[string]string{
+	English: "Jan 2, 2006 15:04 MST",
+	Russian: "02.01.2006 15:04 MST",
+}
+
+// Locale translates messages and formats numbers and dates for a chat, the
+// zero value is English.
+type Locale struct {
+	Language string
+
+	// Location is the timezone dates are written in, if it's not set dates
+	// are written as they are
+	Location *time.Location
+}
+
+func NewLocale(language string) Locale {
+	if !IsSupported(language) {
+		language = English
+	}
+
+	return Locale{Language: language}
+}
+
+// IsSupported reports whether messages are translated to the language.
+func IsSupported(language string) bool {
+	for _, supported := range Languages {
+		if supported == language {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match returns the supported language of the language code given by
+// Telegram clients, such as en-US, or an empty string.
+func Match(code string) string {
+	code = strings.ToLower(code)
+	if index := strings.IndexAny(code, "-_"); index >= 0 {
+		code = code[:index]
+	}
+
+	if IsSupported(code) {
+		return code
+	}
+
+	return ""
+}
+
+// Translate returns the translation of the message, messages without
+// translation are returned as is.
+func (locale Locale) Translate(message string) string {
+	if translated, ok := catalogs[locale.Language][message]; ok {
+		return translated
+	}
+
+	return message
+}
+
+// Sprintf translates the format and formats it.
+func (locale Locale) Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(locale.Translate(format), args...)
+}
+
+func (locale Locale) numberFormat() numberFormat {
+	if format, ok := numberFormats[locale.Language]; ok {
+		return format
+	}
+
+	return numberFormats[English]
+}
+
+// FormatNumber writes the number without exponent, digits of the integer
+// part are grouped by thousands when there are more than four of them, so
+// years and other short numbers are left as is.
+func (locale Locale) FormatNumber(value float64) string {
+	format := locale.numberFormat()
+
+	text := strconv.FormatFloat(value, 'f', -1, 64)
+
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign = "-"
+		text = text[1:]
+	}
+
+	integer, fraction := text, ""
+	if index := strings.Index(text, "."); index >= 0 {
+		integer, fraction = text[:index], text[index+1:]
+	}
+
+	if len(integer) > 4 {
+		var groups []string
+		for len(integer) > 3 {
+			groups = append([]string{integer[len(integer)-3:]}, groups...)
+			integer = integer[:len(integer)-3]
+		}
+
+		integer = strings.Join(append([]string{integer}, groups...), format.group)
+	}
+
+	if fraction != "" {
+		return sign + integer + format.decimal + fraction
+	}
+
+	return sign + integer
+}
+
+// FormatTime writes the date and time in the order used by the language.
+func (locale Locale) FormatTime(value time.Time) string {
+	format, ok := timeFormats[locale.Language]
+	if !ok {
+		format = timeFormats[English]
+	}
+
+	if locale.Location != nil {
+		value = value.In(locale.Location)
+	}
+
+	return value.Format(format)
+}
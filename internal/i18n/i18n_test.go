@@ -0,0 +1,74 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func Test_catalogs_KeepVerbs(t *testing.T) {
+	for language, catalog := range catalogs {
+		for message, translation := range catalog {
+			assert.Equal(
+				t,
+				verbs.FindAllString(message, -1),
+				verbs.FindAllString(translation, -1),
+				"%s: %q", language, message,
+			)
+		}
+	}
+}
+
+func Test_Match_ReturnsSupportedLanguage(t *testing.T) {
+	assert.Equal(t, Russian, Match("ru"))
+	assert.Equal(t, English, Match("en-US"))
+	assert.Equal(t, "", Match("de"))
+	assert.Equal(t, "", Match(""))
+}
+
+func Test_Locale_Sprintf_FallsBackToEnglish(t *testing.T) {
+	assert.Equal(
+		t,
+		"Причина: timeout",
+		NewLocale(Russian).Sprintf("Reason: %s", "timeout"),
+	)
+	assert.Equal(
+		t,
+		"Reason: timeout",
+		NewLocale("de").Sprintf("Reason: %s", "timeout"),
+	)
+	assert.Equal(t, "no translation", NewLocale(Russian).Translate("no translation"))
+}
+
+func Test_Locale_FormatNumber(t *testing.T) {
+	english := NewLocale(English)
+	russian := NewLocale(Russian)
+
+	assert.Equal(t, "2020", english.FormatNumber(2020))
+	assert.Equal(t, "12,345.5", english.FormatNumber(12345.5))
+	assert.Equal(t, "-1,000,000", english.FormatNumber(-1e6))
+	assert.Equal(t, "0.25", english.FormatNumber(0.25))
+
+	assert.Equal(t, "12 345,5", russian.FormatNumber(12345.5))
+	assert.Equal(t, "0,25", russian.FormatNumber(0.25))
+}
+
+func Test_Locale_FormatTime(t *testing.T) {
+	value := time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC)
+
+	assert.Equal(t, "Mar 1, 2020 14:05 UTC", NewLocale(English).FormatTime(value))
+	assert.Equal(t, "01.03.2020 14:05 UTC", NewLocale(Russian).FormatTime(value))
+
+	location, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	assert.Equal(
+		t,
+		"Mar 1, 2020 15:05 CET",
+		Locale{Language: English, Location: location}.FormatTime(value),
+	)
+}
@@ -0,0 +1,260 @@
+package i18n
+
+var russian = map[string]string{
+	// /help
+	"Hi! I am a telegram bot and I can notify you about all changes in " +
+		"any json data fields by url, if url unavailable I'll let you " +
+		"know. All commands in bot:": "Привет! Я телеграм-бот и могу " +
+		"сообщать обо всех изменениях полей json по url, а если url " +
+		"станет недоступен, я тоже дам знать. Все команды бота:",
+	"Send /help <command> to see its usage and examples": "Отправьте " +
+		"/help <команда>, чтобы увидеть формат и примеры",
+	"Unknown command: %s, send /help to see all commands": "Неизвестная " +
+		"команда: %s, отправьте /help, чтобы увидеть все команды",
+	"Examples:": "Примеры:",
+
+	// commands
+	"[command]":      "[команда]",
+	"subscriptionID": "ID-подписки",
+	"url duration":   "url интервал",
+	"url duration json-key.nested-key,second-key": "url интервал " +
+		"json-ключ.вложенный-ключ,второй-ключ",
+	"url [json-key.nested-key,second-key]": "url " +
+		"[json-ключ.вложенный-ключ,второй-ключ]",
+	"url|subscriptionID": "url|ID-подписки",
+	"subscriptionID [clear] [ignore=glob,glob] [round=N|off] " +
+		"[tolerance=X|off] [sort=on|off]": "ID-подписки [clear] " +
+		"[ignore=маска,маска] [round=N|off] [tolerance=X|off] [sort=on|off]",
+	"json-key.nested-key,second-key":        "json-ключ.вложенный-ключ,второй-ключ",
+	"start bot":                             "запустить бота",
+	"show commands or usage of one command": "показать команды или формат одной команды",
+	"show list with your subscriptions":     "показать список ваших подписок",
+	"notify about changes of json keys":     "сообщать об изменениях ключей json",
+	"The url is requested every duration, like 30s, 5m or 1h. Nested " +
+		"keys are separated by dots, several keys by commas. Keys with " +
+		"spaces are written in quotes. Subscribing to the same url and " +
+		"keys again changes the duration. The command has no name=value " +
+		"options.": "Url запрашивается с заданным интервалом, например " +
+		"30s, 5m или 1h. Вложенные ключи разделяются точками, несколько " +
+		"ключей — запятыми. Ключи с пробелами пишутся в кавычках. " +
+		"Повторная подписка на тот же url и ключи меняет интервал. У " +
+		"команды нет опций name=value.",
+	"unsubscribe from one selected subscription": "отписаться от выбранной подписки",
+	"Subscription IDs are shown by /list.":       "ID подписок показывает /list.",
+	"unsubscribe from all subscriptions":         "отписаться от всех подписок",
+	"Subscriptions declared in the configuration file are kept.": "Подписки, " +
+		"заданные в файле конфигурации, сохраняются.",
+	"notify only when url goes up or down": "сообщать, только когда url " +
+		"становится доступен или недоступен",
+	"The response doesn't have to be json, only the availability and " +
+		"the status code are checked.": "Ответ не обязан быть json, " +
+		"проверяются только доступность и код ответа.",
+	"show current values of subscription keys": "показать текущие " +
+		"значения ключей подписки",
+	"Values are taken from the latest response of the url, it is not " +
+		"requested again.": "Значения берутся из последнего ответа url, " +
+		"повторный запрос не выполняется.",
+	"request url once and show its keys or values": "запросить url один " +
+		"раз и показать его ключи или значения",
+	"Without keys the top-level keys of the response are shown, it " +
+		"helps to find keys before subscribing.": "Без ключей " +
+		"показываются ключи верхнего уровня ответа, это помогает найти " +
+		"ключи перед подпиской.",
+	"browse json keys of url": "просмотреть ключи json по url",
+	"Objects are opened by buttons. If the chat is subscribed to the " +
+		"url, the selected key can be added to the subscription.": "Объекты " +
+		"открываются кнопками. Если чат подписан на этот url, выбранный " +
+		"ключ можно добавить в подписку.",
+	"show or change filters of noisy keys": "показать или изменить " +
+		"фильтры шумных ключей",
+	"Changes of ignored keys are not notified, * matches a single key " +
+		"and globs without dots match keys at any depth. Numbers are " +
+		"rounded to N decimals and differences up to the tolerance from " +
+		"the last notified value are ignored, sorted arrays are equal if " +
+		"they have the same items in any order. clear removes all " +
+		"filters.": "Об изменениях " +
+		"игнорируемых ключей не сообщается, * соответствует одному " +
+		"ключу, а маски без точек — ключам на любой глубине. Числа " +
+		"округляются до N знаков после запятой, а отличия от последнего " +
+		"отправленного значения в пределах tolerance не учитываются, " +
+		"отсортированные массивы равны, если " +
+		"в них те же элементы в любом порядке. clear удаляет все фильтры.",
+	"show url status and uptime": "показать статус и доступность url",
+	"get url to push json data to instead of polling": "получить url, на " +
+		"который можно отправлять json вместо опроса",
+	"The first request is used as a baseline, you'll be notified about " +
+		"changes in the next ones.": "Первый запрос используется как " +
+		"исходные данные, уведомления придут об изменениях в следующих.",
+	"show limits of subscriptions":         "показать ограничения подписок",
+	"get your subscriptions as a document": "получить подписки документом",
+	"Send the document back with /import caption to restore the " +
+		"subscriptions.": "Чтобы восстановить подписки, отправьте " +
+		"документ обратно с подписью /import.",
+	"show or change the language of the bot": "показать или изменить язык бота",
+	"show or change the timezone of dates":   "показать или изменить часовой пояс дат",
+
+	// arguments
+	"Invalid arguments, %s: %s": "Неверные аргументы, %s: %s",
+	"unterminated quote":        "незакрытая кавычка",
+	"option without name":       "параметр без имени",
+	"duplicate option":          "повторяющийся параметр",
+	"unknown option":            "неизвестный параметр",
+	"unexpected argument":       "лишний аргумент",
+	"invalid value":             "неверное значение",
+
+	// subscriptions
+	"Data required!\nIn format:  /subscribe url duration " +
+		"json-key.nested-key,second-key": "Не хватает данных!\n" +
+		"Формат:  /subscribe url интервал json-ключ.вложенный-ключ,второй-ключ",
+	"Data required!\nIn format:  /uptime url duration": "Не хватает данных!\nФормат:  /uptime url интервал",
+	"Data required!\nIn format:  /webhook json-key.nested-key,second-key": "Не хватает данных!\n" +
+		"Формат:  /webhook json-ключ.вложенный-ключ,второй-ключ",
+	"Subscription ID required!\nIn format:  /status subscriptionID": "Не указан ID подписки!\nФормат:  /status ID-подписки",
+	"You wrote the wrong url":                                    "Неверный url",
+	"This url is not allowed: %s":                                "Этот url запрещен: %s",
+	"Your write incorrect duration":                              "Неверный интервал",
+	"Sorry, %s":                                                  "Извините, %s",
+	"You successfully subscribed!":                               "Вы успешно подписались!",
+	"You have already subscribed on this URL with same duration": "Вы уже подписаны на этот URL с тем же интервалом",
+	"Duration was successfully updated":                          "Интервал успешно обновлен",
+	"You don't have any subscriptions":                           "У вас нет подписок",
+	"You don't have subscription with this id":                   "У вас нет подписки с таким ID",
+	"All notifications stopped":                                  "Все уведомления остановлены",
+	"All notifications stopped except %d managed by the configuration " +
+		"file": "Все уведомления остановлены, кроме %d, заданных в " +
+		"файле конфигурации",
+	"This subscription is managed by the configuration file and can't " +
+		"be removed": "Эта подписка задана в файле конфигурации и не " +
+		"может быть удалена",
+	"\nMy subscriptions:\n":                             "\nМои подписки:\n",
+	"\nID - %s\nURL - %s\nDURATION - %s\nJSON KEY - %v": "\nID - %s\nURL - %s\nИНТЕРВАЛ - %s\nКЛЮЧ JSON - %v",
+	"\nKIND - %s":        "\nТИП - %s",
+	"\nNEXT CHECK - %s":  "\nСЛЕДУЮЩАЯ ПРОВЕРКА - %s",
+	"\nLAST CHANGE - %s": "\nПОСЛЕДНЕЕ ИЗМЕНЕНИЕ - %s",
+	"\nPAUSED":           "\nПРИОСТАНОВЛЕНА",
+	"\nDISABLED - %s":    "\nОТКЛЮЧЕНА - %s",
+	"Unsubscribed:\nID - %s\nURL - %s\nJSON KEY - %s\n\n": "Подписка удалена:\nID - %s\nURL - %s\nКЛЮЧ JSON - %s\n\n",
+	"Webhooks are not configured":                         "Вебхуки не настроены",
+	"You successfully subscribed!\n\nID - %s\n\nPOST json data to:\n" +
+		"%s\n\nThe first request is used as a baseline, you'll be " +
+		"notified about changes in the next ones.": "Вы успешно " +
+		"подписались!\n\nID - %s\n\nОтправляйте json методом POST на:\n" +
+		"%s\n\nПервый запрос используется как исходные данные, " +
+		"уведомления придут об изменениях в следующих.",
+
+	// current values
+	"NOT FOUND - %s": "НЕ НАЙДЕНЫ - %s",
+	"Subscription ID required!\nIn format:  /get subscriptionID": "Не " +
+		"указан ID подписки!\nФормат:  /get ID-подписки",
+	"This subscription doesn't have json keys, use /status to see the " +
+		"state of its url": "У этой подписки нет ключей json, " +
+		"используйте /status, чтобы увидеть состояние url",
+	"No data was received yet": "Данные еще не получены",
+	"Data required!\nIn format:  /peek url " +
+		"[json-key.nested-key,second-key]": "Не хватает данных!\n" +
+		"Формат:  /peek url [json-ключ.вложенный-ключ,второй-ключ]",
+	"The response is an empty json object": "Ответ — пустой объект json",
+	"KEYS:\n%s\n\nSend /peek url key to see its value, nested keys are " +
+		"separated by dots": "КЛЮЧИ:\n%s\n\nОтправьте /peek url ключ, " +
+		"чтобы увидеть его значение, вложенные ключи разделяются точками",
+	"This url was requested recently, try again in %s": "Этот url " +
+		"недавно запрашивался, попробуйте снова через %s",
+
+	// keys
+	"Data required!\nIn format:  /keys url|subscriptionID": "Не хватает " +
+		"данных!\nФормат:  /keys url|ID-подписки",
+	"These keys are outdated, send /keys again": "Эти ключи устарели, " +
+		"отправьте /keys еще раз",
+	"This subscription is managed by the configuration file and can't " +
+		"be changed": "Эта подписка задана в файле конфигурации и не " +
+		"может быть изменена",
+	"Key %s is already in the subscription": "Ключ %s уже есть в подписке",
+	"Key %s was added to the subscription":  "Ключ %s добавлен в подписку",
+	"PATH - %s":                             "ПУТЬ - %s",
+	"top level":                             "верхний уровень",
+	"TYPE - %s":                             "ТИП - %s",
+	"PAGE - %d of %d":                       "СТРАНИЦА - %d из %d",
+	"Up":                                    "Наверх",
+	"Add %s":                                "Добавить %s",
+	"Subscribe with: /subscribe %s duration %s": "Подписаться: " +
+		"/subscribe %s интервал %s",
+	"object, %d keys": "объект, ключей: %d",
+	"array, %d items": "массив, элементов: %d",
+	"string, %s":      "строка, %s",
+	"number, %s":      "число, %s",
+	"boolean, %t":     "логическое, %t",
+
+	// filters
+	"Subscription ID required!\nIn format:  /filter subscriptionID " +
+		"[ignore=*.timestamp,request_id] [round=2] [tolerance=0.5] " +
+		"[sort=on]": "Не указан ID подписки!\nФормат:  /filter " +
+		"ID-подписки [ignore=*.timestamp,request_id] [round=2] " +
+		"[tolerance=0.5] [sort=on]",
+	"none": "нет",
+	"ID - %s\n\nIGNORE - %s\nROUND - %s\nTOLERANCE - %s\nSORT - %s": "ID - %s\n\n" +
+		"ИГНОРИРОВАТЬ - %s\nОКРУГЛЯТЬ - %s\nДОПУСК - %s\nСОРТИРОВАТЬ - %s",
+
+	// validation
+	"invalid url":                                  "неверный url",
+	"invalid webhook url":                          "неверный url вебхука",
+	"unknown kind":                                 "неизвестный тип",
+	"keys are required":                            "не указаны ключи",
+	"invalid duration":                             "неверный интервал",
+	"interval must be at least %s":                 "интервал должен быть не меньше %s",
+	"interval must be at most %s":                  "интервал должен быть не больше %s",
+	"a chat can't have more than %d subscriptions": "в чате не может быть больше %d подписок",
+
+	// availability
+	"URL is unavailable!":                        "URL недоступен!",
+	"URL is unavailable!\n\nReason: %s":          "URL недоступен!\n\nПричина: %s",
+	"TLS certificate is invalid!":                "TLS-сертификат недействителен!",
+	"TLS certificate is invalid!\n\n%s":          "TLS-сертификат недействителен!\n\n%s",
+	"TLS certificate has expired!":               "Срок действия TLS-сертификата истек!",
+	"Reason: %s":                                 "Причина: %s",
+	"URL is available again":                     "URL снова доступен",
+	"URL is available again, recovered after %s": "URL снова доступен, восстановлен через %s",
+	"TLS certificate expires in %d days, on %s":  "Срок действия TLS-сертификата истекает через %d дн., %s",
+	"up":              "доступен",
+	"down":            "недоступен",
+	"%s, no response": "%s, нет ответа",
+	"\nID - %s\nURL - %s\n\nStatus changed: %s → %s": "\nID - %s\nURL - %s\n\nСтатус изменился: %s → %s",
+	"ID - %s\n\nSTATUS - %s\nLATENCY - %s":           "ID - %s\n\nСТАТУС - %s\nЗАДЕРЖКА - %s",
+	"STATUS - %s":                                    "СТАТУС - %s",
+	"LATENCY - %s":                                   "ЗАДЕРЖКА - %s",
+	"SIZE - %s bytes":                                "РАЗМЕР - %s байт",
+	"CERTIFICATE - %s":                               "СЕРТИФИКАТ - %s",
+	"CERTIFICATE - expires %s":                       "СЕРТИФИКАТ - истекает %s",
+	"UPTIME - %s":                                    "ДОСТУПНОСТЬ - %s",
+	"n/a":                                            "нет данных",
+
+	// quotas
+	"unlimited": "без ограничений",
+	"SUBSCRIPTIONS - %d of %s\nMIN INTERVAL - %s\nMAX INTERVAL - %s\n" +
+		"MAX RESPONSE SIZE - %s bytes": "ПОДПИСКИ - %d из %s\n" +
+		"МИН. ИНТЕРВАЛ - %s\nМАКС. ИНТЕРВАЛ - %s\n" +
+		"МАКС. РАЗМЕР ОТВЕТА - %s байт",
+	"TOP CHATS:": "ЧАТЫ С НАИБОЛЬШИМ ЧИСЛОМ ПОДПИСОК:",
+
+	// export and import
+	"The document is too large":       "Документ слишком большой",
+	"Unable to read the document: %s": "Не удалось прочитать документ: %s",
+	"Unable to import: %s":            "Не удалось импортировать: %s",
+	"Imported %d subscriptions":       "Импортировано подписок: %d",
+
+	// access
+	"Anonymous messages are not allowed":                     "Анонимные сообщения запрещены",
+	"You are not allowed to use this bot":                    "Вам не разрешено пользоваться этим ботом",
+	"Only chat admins can change subscriptions of this chat": "Только администраторы чата могут изменять его подписки",
+
+	// language
+	"LANGUAGE - %s\n\nIn format:  /language %s": "ЯЗЫК - %s\n\nФормат:  /language %s",
+	"Unknown language, available languages: %s": "Неизвестный язык, доступные языки: %s",
+	"Language was changed to %s":                "Язык изменен на %s",
+
+	// timezone
+	"TIMEZONE - %s\nNOW - %s\n\nIn format:  /timezone Europe/Berlin|%s": "ЧАСОВОЙ ПОЯС - %s\nСЕЙЧАС - %s\n\n" +
+		"Формат:  /timezone Europe/Berlin|%s",
+	"Unknown timezone, use names like Europe/Berlin or America/New_York: %s": "Неизвестный часовой пояс, используйте названия вроде " +
+		"Europe/Berlin или America/New_York: %s",
+	"Timezone was changed to %s": "Часовой пояс изменен на %s",
+}
@@ -2,16 +2,96 @@ package printer
 
 import (
 	"fmt"
+	"math"
 	"sort"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Formatter writes numbers and dates in the format of a chat.
+type Formatter interface {
+	FormatNumber(value float64) string
+	FormatTime(value time.Time) string
+}
+
+// unix timestamps in seconds and milliseconds are detected within this
+// range, from 2001 till 2286
+const (
+	minTimestamp = 1e9
+	maxTimestamp = 1e10
+)
+
+// Printer writes data like String, numbers and dates are written by the
+// formatter if it's set.
+type Printer struct {
+	Formatter Formatter
+
+	// DetectDates makes RFC 3339 strings and unix timestamps in seconds or
+	// milliseconds written as dates
+	DetectDates bool
+}
+
 func String(data interface{}) string {
-	return makeString(data, false)
+	return Printer{}.String(data)
+}
+
+func (printer Printer) String(data interface{}) string {
+	return printer.makeString(data, false)
+}
+
+func (printer Printer) formatValue(data interface{}) (string, bool) {
+	switch typed := data.(type) {
+	case float64:
+		return printer.formatNumber(typed), true
+	case float32:
+		return printer.formatNumber(float64(typed)), true
+	case int:
+		return printer.formatNumber(float64(typed)), true
+	case int32:
+		return printer.formatNumber(float64(typed)), true
+	case int64:
+		return printer.formatNumber(float64(typed)), true
+	case time.Time:
+		return printer.Formatter.FormatTime(typed), true
+	case primitive.DateTime:
+		return printer.Formatter.FormatTime(typed.Time()), true
+	case string:
+		if !printer.DetectDates {
+			return "", false
+		}
+
+		parsed, err := time.Parse(time.RFC3339, typed)
+		if err == nil {
+			return printer.Formatter.FormatTime(parsed), true
+		}
+	}
+
+	return "", false
 }
 
-func makeString(data interface{}, indent bool) string {
+func (printer Printer) formatNumber(value float64) string {
+	if printer.DetectDates && value == math.Trunc(value) {
+		switch {
+		case value >= minTimestamp && value < maxTimestamp:
+			return printer.Formatter.FormatTime(time.Unix(int64(value), 0))
+		case value >= minTimestamp*1000 && value < maxTimestamp*1000:
+			return printer.Formatter.FormatTime(
+				time.Unix(0, int64(value)*int64(time.Millisecond)),
+			)
+		}
+	}
+
+	return printer.Formatter.FormatNumber(value)
+}
+
+func (printer Printer) makeString(data interface{}, indent bool) string {
+	if printer.Formatter != nil {
+		if text, ok := printer.formatValue(data); ok {
+			return text
+		}
+	}
+
 	switch typed := data.(type) {
 	case map[string]interface{}:
 		var keys []string
@@ -42,7 +122,7 @@ func makeString(data interface{}, indent bool) string {
 				message += ": "
 			}
 
-			message += makeString(value, false)
+			message += printer.makeString(value, false)
 		}
 
 		return message
@@ -53,7 +133,7 @@ func makeString(data interface{}, indent bool) string {
 				message += "\n\n"
 			}
 
-			message += makeString(value, true)
+			message += printer.makeString(value, true)
 		}
 
 		return message
@@ -65,7 +145,7 @@ func makeString(data interface{}, indent bool) string {
 				message += "\n\n"
 			}
 
-			message += makeString(value, true)
+			message += printer.makeString(value, true)
 		}
 
 		return message
@@ -80,7 +160,7 @@ func makeString(data interface{}, indent bool) string {
 				message += "\n\n"
 			}
 
-			message += makeString(value, true)
+			message += printer.makeString(value, true)
 		}
 
 		return message
@@ -2,8 +2,10 @@ package printer
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -138,3 +140,36 @@ total: 350`
 	)
 
 }
+
+type testFormatter struct{}
+
+func (testFormatter) FormatNumber(value float64) string {
+	return fmt.Sprintf("<%v>", value)
+}
+
+func (testFormatter) FormatTime(value time.Time) string {
+	return value.Format("02.01.2006")
+}
+
+func Test_Printer_UsesFormatter(t *testing.T) {
+	data := map[string]interface{}{
+		"price":   12.5,
+		"date":    "2020-03-01T10:00:00Z",
+		"created": float64(1583056800),
+		"comment": "2020",
+	}
+
+	assert.Equal(
+		t,
+		"comment: 2020\ncreated: <1.5830568e+09>\n"+
+			"date: 2020-03-01T10:00:00Z\nprice: <12.5>",
+		Printer{Formatter: testFormatter{}}.String(data),
+	)
+
+	assert.Equal(
+		t,
+		"comment: 2020\ncreated: 01.03.2020\n"+
+			"date: 01.03.2020\nprice: <12.5>",
+		Printer{Formatter: testFormatter{}, DetectDates: true}.String(data),
+	)
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter spaces out messages so the bot stays within Telegram limits: the
+// global limit for all chats and separate limits for private and group chats.
+type Limiter struct {
+	mutex sync.Mutex
+
+	global  time.Duration
+	private time.Duration
+	group   time.Duration
+
+	last  time.Time
+	chats map[int64]time.Time
+}
+
+func NewLimiter(global, private, group time.Duration) *Limiter {
+	return &Limiter{
+		global:  global,
+		private: private,
+		group:   group,
+		chats:   map[int64]time.Time{},
+	}
+}
+
+// Delay returns how long the caller should wait before sending a message to
+// the given chat. Zero means that the message can be sent right now, in that
+// case the send is recorded.
+func (limiter *Limiter) Delay(chatID int64, now time.Time) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	interval := limiter.private
+	// group and channel identifiers are negative
+	if chatID < 0 {
+		interval = limiter.group
+	}
+
+	delay := limiter.last.Add(limiter.global).Sub(now)
+
+	if last, ok := limiter.chats[chatID]; ok {
+		chatDelay := last.Add(interval).Sub(now)
+		if chatDelay > delay {
+			delay = chatDelay
+		}
+	}
+
+	if delay > 0 {
+		return delay
+	}
+
+	limiter.last = now
+	limiter.chats[chatID] = now
+
+	limiter.forget(now)
+
+	return 0
+}
+
+func (limiter *Limiter) forget(now time.Time) {
+	for chatID, last := range limiter.chats {
+		if now.Sub(last) > limiter.private && now.Sub(last) > limiter.group {
+			delete(limiter.chats, chatID)
+		}
+	}
+}
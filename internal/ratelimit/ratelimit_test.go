@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Limiter_DelaysMessagesToSameChat(t *testing.T) {
+	limiter := NewLimiter(time.Millisecond, time.Second, 3*time.Second)
+	now := time.Now()
+
+	assert.Zero(t, limiter.Delay(1, now))
+	assert.Equal(t, time.Second, limiter.Delay(1, now))
+	assert.Zero(t, limiter.Delay(1, now.Add(time.Second)))
+}
+
+func Test_Limiter_UsesGroupLimitForNegativeChatID(t *testing.T) {
+	limiter := NewLimiter(time.Millisecond, time.Second, 3*time.Second)
+	now := time.Now()
+
+	assert.Zero(t, limiter.Delay(-1, now))
+	assert.Equal(t, 2*time.Second, limiter.Delay(-1, now.Add(time.Second)))
+	assert.Zero(t, limiter.Delay(-1, now.Add(3*time.Second)))
+}
+
+func Test_Limiter_DelaysMessagesToDifferentChatsByGlobalLimit(t *testing.T) {
+	limiter := NewLimiter(100*time.Millisecond, time.Second, 3*time.Second)
+	now := time.Now()
+
+	assert.Zero(t, limiter.Delay(1, now))
+	assert.Equal(t, 100*time.Millisecond, limiter.Delay(2, now))
+	assert.Zero(t, limiter.Delay(2, now.Add(100*time.Millisecond)))
+}
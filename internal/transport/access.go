@@ -0,0 +1,17 @@
+package transport
+
+import (
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// AccessDenied is returned by Authorizer when the sender isn't allowed to
+// run the command, the text is sent back to the chat.
+type AccessDenied string
+
+func (denied AccessDenied) Error() string {
+	return string(denied)
+}
+
+// Authorizer is called before every handler registered with Handle, the
+// handler is not called if it returns an error.
+type Authorizer func(cmd string, message *tb.Message) error
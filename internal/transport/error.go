@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error is returned when Telegram Bot API rejects a request, it keeps the
+// response parameters which are dropped by telebot.
+type Error struct {
+	Code        int
+	Description string
+	RetryAfter  time.Duration
+	MigrateTo   int64
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("telegram api error %d: %s", err.Code, err.Description)
+}
+
+// RetryAfter returns the delay requested by Telegram for the given error or
+// zero if the error is not a rate limit error.
+func RetryAfter(err error) time.Duration {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr.RetryAfter
+	}
+
+	return 0
+}
+
+// MigratedTo returns the new chat identifier if the group was upgraded to a
+// supergroup or zero otherwise.
+func MigratedTo(err error) int64 {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr.MigrateTo
+	}
+
+	return 0
+}
+
+// IsUnreachable reports whether the chat can't receive messages anymore: the
+// bot was blocked or kicked, the chat was deleted or the user was
+// deactivated. Retrying such messages is pointless.
+func IsUnreachable(err error) bool {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+
+	switch apiErr.Code {
+	case http.StatusForbidden:
+		return true
+	case http.StatusBadRequest:
+		return apiErr.MigrateTo == 0 &&
+			strings.Contains(apiErr.Description, "chat not found")
+	}
+
+	return false
+}
@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IsUnreachable_ClassifiesTelegramErrors(t *testing.T) {
+	assert.True(t, IsUnreachable(&Error{
+		Code:        403,
+		Description: "Forbidden: bot was blocked by the user",
+	}))
+	assert.True(t, IsUnreachable(&Error{
+		Code:        400,
+		Description: "Bad Request: chat not found",
+	}))
+	assert.False(t, IsUnreachable(&Error{
+		Code:        400,
+		Description: "Bad Request: group chat was upgraded to a supergroup chat",
+		MigrateTo:   -1001234567890,
+	}))
+	assert.False(t, IsUnreachable(&Error{
+		Code:        429,
+		Description: "Too Many Requests: retry after 5",
+		RetryAfter:  5 * time.Second,
+	}))
+	assert.False(t, IsUnreachable(errors.New("network is unreachable")))
+}
+
+func Test_MigratedTo_ReturnsNewChatID(t *testing.T) {
+	assert.Equal(t, int64(-1001234567890), MigratedTo(&Error{
+		Code:      400,
+		MigrateTo: -1001234567890,
+	}))
+	assert.Zero(t, MigratedTo(errors.New("timeout")))
+}
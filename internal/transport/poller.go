@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/reconquest/pkg/log"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// Poller is a long poller which remembers the time of the last successful
+// request to Telegram, so a stalled poller can be detected.
+type Poller struct {
+	Timeout time.Duration
+
+	lastUpdateID int
+
+	mutex    sync.RWMutex
+	lastPoll time.Time
+}
+
+func NewPoller(timeout time.Duration) *Poller {
+	return &Poller{
+		Timeout: timeout,
+	}
+}
+
+// LastPoll returns the time of the last successful getUpdates request.
+func (poller *Poller) LastPoll() time.Time {
+	poller.mutex.RLock()
+	defer poller.mutex.RUnlock()
+
+	return poller.lastPoll
+}
+
+// Poll implements telebot.Poller.
+func (poller *Poller) Poll(
+	bot *tb.Bot,
+	updates chan tb.Update,
+	stop chan struct{},
+) {
+	done := make(chan struct{})
+	go func() {
+		<-stop
+		close(done)
+		close(stop)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		received, err := poller.getUpdates(bot)
+		if err != nil {
+			log.Errorf(err, "unable to get updates from telegram")
+			time.Sleep(time.Second)
+			continue
+		}
+
+		poller.mutex.Lock()
+		poller.lastPoll = time.Now()
+		poller.mutex.Unlock()
+
+		for _, update := range received {
+			poller.lastUpdateID = update.ID
+
+			select {
+			case updates <- update:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+func (poller *Poller) getUpdates(bot *tb.Bot) ([]tb.Update, error) {
+	data, err := bot.Raw("getUpdates", map[string]string{
+		"offset":  strconv.Itoa(poller.lastUpdateID + 1),
+		"timeout": strconv.Itoa(int(poller.Timeout / time.Second)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var reply struct {
+		response
+		Result []tb.Update `json:"result"`
+	}
+
+	err = json.Unmarshal(data, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if !reply.Ok {
+		return nil, &Error{
+			Code:        reply.Code,
+			Description: reply.Description,
+			RetryAfter:  time.Duration(reply.Parameters.RetryAfter) * time.Second,
+		}
+	}
+
+	return reply.Result, nil
+}
@@ -1,41 +1,268 @@
 package transport
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
 	"github.com/reconquest/pkg/log"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
 type Telegram struct {
-	bot *tb.Bot
+	bot       *tb.Bot
+	authorize Authorizer
+
+	// routes are handlers of commands and tb.OnDocument, updates are
+	// dispatched by Start instead of telebot so they can be waited for
+	routes    map[string]func(*tb.Message)
+	callback  func(*tb.Callback)
+	migration func(from, to int64)
+
+	// handlers counts updates which are being processed, stop and stopped
+	// end the loop of Start
+	handlers sync.WaitGroup
+	stop     chan struct{}
+	stopped  chan struct{}
 }
 
 type Recipient struct {
 	recipient tb.Recipient
 }
 
+type response struct {
+	Ok          bool   `json:"ok"`
+	Code        int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int   `json:"retry_after"`
+		MigrateTo  int64 `json:"migrate_to_chat_id"`
+	} `json:"parameters"`
+}
+
 func NewBot(bot *tb.Bot) *Telegram {
 	return &Telegram{
-		bot: bot,
+		bot:     bot,
+		routes:  map[string]func(*tb.Message){},
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 }
 
 func (telegram *Telegram) SendMessage(recipient tb.Recipient, message string) error {
-	_, err := telegram.bot.Send(recipient, message)
+	return telegram.call("sendMessage", map[string]string{
+		"chat_id": recipient.Recipient(),
+		"text":    message,
+	})
+}
+
+// SendKeyboard sends the message with an inline keyboard.
+func (telegram *Telegram) SendKeyboard(
+	recipient tb.Recipient,
+	text string,
+	keyboard Keyboard,
+) error {
+	return telegram.call("sendMessage", map[string]interface{}{
+		"chat_id":      recipient.Recipient(),
+		"text":         text,
+		"reply_markup": getReplyMarkup(keyboard),
+	})
+}
+
+// EditKeyboard replaces the text and the inline keyboard of the message
+// which was sent by the bot.
+func (telegram *Telegram) EditKeyboard(
+	message *tb.Message,
+	text string,
+	keyboard Keyboard,
+) error {
+	return telegram.call("editMessageText", map[string]interface{}{
+		"chat_id":      message.Chat.Recipient(),
+		"message_id":   message.ID,
+		"text":         text,
+		"reply_markup": getReplyMarkup(keyboard),
+	})
+}
+
+func getReplyMarkup(keyboard Keyboard) map[string]interface{} {
+	if keyboard == nil {
+		keyboard = Keyboard{}
+	}
+
+	return map[string]interface{}{"inline_keyboard": keyboard}
+}
+
+// BotCommand is an item of the command menu which Telegram shows to users.
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// SetCommands replaces the command menu of the bot for users with the given
+// language, the menu with empty language is shown to everyone else.
+func (telegram *Telegram) SetCommands(language string, commands []BotCommand) error {
+	payload := map[string]interface{}{
+		"commands": commands,
+	}
+
+	if language != "" {
+		payload["language_code"] = language
+	}
+
+	return telegram.call("setMyCommands", payload)
+}
+
+// call sends the request to Telegram and returns an *Error if Telegram
+// rejected it.
+func (telegram *Telegram) call(method string, payload interface{}) error {
+	data, err := telegram.bot.Raw(method, payload)
 	if err != nil {
 		return err
 	}
 
+	var reply response
+	err = json.Unmarshal(data, &reply)
+	if err != nil {
+		return karma.Format(err, "unable to decode telegram response")
+	}
+
+	if !reply.Ok {
+		return &Error{
+			Code:        reply.Code,
+			Description: reply.Description,
+			RetryAfter:  time.Duration(reply.Parameters.RetryAfter) * time.Second,
+			MigrateTo:   reply.Parameters.MigrateTo,
+		}
+	}
+
 	return nil
 }
 
+func (telegram *Telegram) SendDocument(
+	recipient tb.Recipient,
+	name string,
+	data []byte,
+) error {
+	_, err := telegram.bot.Send(recipient, &tb.Document{
+		File:     tb.FromReader(bytes.NewReader(data)),
+		FileName: name,
+	})
+
+	return err
+}
+
+// Download returns contents of the file which was sent to the bot.
+func (telegram *Telegram) Download(file *tb.File) (io.ReadCloser, error) {
+	return telegram.bot.GetFile(file)
+}
+
+// IsChatAdmin reports whether the user is the creator or an administrator
+// of the chat.
+func (telegram *Telegram) IsChatAdmin(chat *tb.Chat, user *tb.User) (bool, error) {
+	member, err := telegram.bot.ChatMemberOf(chat, user)
+	if err != nil {
+		return false, err
+	}
+
+	return member.Role == tb.Creator || member.Role == tb.Administrator, nil
+}
+
+// SetAuthorizer sets the check which is done before every handler.
+func (telegram *Telegram) SetAuthorizer(authorizer Authorizer) {
+	telegram.authorize = authorizer
+}
+
 func (telegram *Telegram) Handle(
 	cmd string,
 	fn func(*tb.Message) error,
 ) {
-	telegram.bot.Handle(cmd, func(message *tb.Message) {
+	telegram.routes[cmd] = func(message *tb.Message) {
+		if telegram.authorize != nil {
+			err := telegram.authorize(cmd, message)
+			if err != nil {
+				telegram.deny(cmd, message, err)
+				return
+			}
+		}
+
 		err := fn(message)
 		if err != nil {
 			log.Infof(nil, "error while processing %s: %s", cmd, err)
 		}
-	})
+	}
+}
+
+func (telegram *Telegram) deny(cmd string, message *tb.Message, err error) {
+	denied, ok := err.(AccessDenied)
+	if !ok {
+		log.Errorf(err, "unable to authorize %s", cmd)
+		return
+	}
+
+	log.Infof(
+		nil,
+		"access denied to %s in chat %d: %s",
+		cmd, message.Chat.ID, denied,
+	)
+
+	err = telegram.SendMessage(message.Chat, string(denied))
+	if err != nil {
+		log.Errorf(err, "unable to send access denied message")
+	}
+}
+
+// HandleCallback registers a handler of inline keyboard buttons, the text
+// returned by the handler is shown to the user who pressed the button.
+// Callbacks are authorized as tb.OnCallback on behalf of that user.
+func (telegram *Telegram) HandleCallback(fn func(*tb.Callback) (string, error)) {
+	telegram.callback = func(callback *tb.Callback) {
+		// buttons of inline mode messages are not used by the bot
+		if callback.Message == nil {
+			return
+		}
+
+		var text string
+		var err error
+
+		message := *callback.Message
+		message.Sender = callback.Sender
+
+		if telegram.authorize != nil {
+			err = telegram.authorize(tb.OnCallback, &message)
+		}
+
+		if denied, ok := err.(AccessDenied); ok {
+			text = string(denied)
+		} else if err != nil {
+			log.Errorf(err, "unable to authorize callback")
+		} else {
+			text, err = fn(callback)
+			if err != nil {
+				log.Infof(nil, "error while processing callback: %s", err)
+			}
+		}
+
+		err = telegram.bot.Respond(callback, &tb.CallbackResponse{Text: text})
+		if err != nil {
+			log.Errorf(err, "unable to answer callback")
+		}
+	}
+}
+
+// HandleMigration registers a handler which is called when a group is
+// upgraded to a supergroup and gets a new identifier.
+func (telegram *Telegram) HandleMigration(fn func(from, to int64) error) {
+	telegram.migration = func(from, to int64) {
+		err := fn(from, to)
+		if err != nil {
+			log.Errorf(
+				err,
+				"unable to migrate chat %d to %d",
+				from, to,
+			)
+		}
+	}
 }
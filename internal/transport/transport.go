@@ -1,7 +1,35 @@
 package transport
 
-import tb "gopkg.in/tucnak/telebot.v2"
+import (
+	"io"
+	"strconv"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
 
 type Transport interface {
 	SendMessage(tb.Recipient, string) error
+	SendDocument(recipient tb.Recipient, name string, data []byte) error
+	Download(file *tb.File) (io.ReadCloser, error)
+	IsChatAdmin(chat *tb.Chat, user *tb.User) (bool, error)
+	SendKeyboard(recipient tb.Recipient, text string, keyboard Keyboard) error
+	EditKeyboard(message *tb.Message, text string, keyboard Keyboard) error
+}
+
+// Button is a button of an inline keyboard, Data is sent back to the bot
+// when the button is pressed.
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"callback_data"`
+}
+
+// Keyboard is an inline keyboard attached to a message, a row per item.
+type Keyboard [][]Button
+
+// ChatID is a recipient which is known only by its identifier, it is used for
+// messages which are sent later than they were created.
+type ChatID int64
+
+func (id ChatID) Recipient() string {
+	return strconv.FormatInt(int64(id), 10)
 }
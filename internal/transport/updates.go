@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/reconquest/pkg/log"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// commandPattern matches "/command@bot payload" like telebot does.
+var commandPattern = regexp.MustCompile(`^(/\w+)(@(\w+))?(\s|$)(.+)?`)
+
+// Start receives updates from the poller and runs their handlers until Stop
+// is called. Handlers are counted before their goroutines are started, so
+// Wait doesn't miss an update which was received right before Stop.
+func (telegram *Telegram) Start(poller tb.Poller) {
+	// the poller blocks until the update is counted, so an update is either
+	// counted or not received before stop
+	updates := make(chan tb.Update)
+	stopPoller := make(chan struct{})
+
+	go poller.Poll(telegram.bot, updates, stopPoller)
+
+	for {
+		select {
+		case update := <-updates:
+			telegram.handlers.Add(1)
+			go func() {
+				defer telegram.handlers.Done()
+
+				telegram.dispatch(update)
+			}()
+
+		case <-telegram.stop:
+			stopPoller <- struct{}{}
+
+		// the poller closes the channel when it's stopped
+		case <-stopPoller:
+			close(telegram.stopped)
+			return
+		}
+	}
+}
+
+// Stop stops receiving updates and returns when Start returns, handlers of
+// received updates may still be running, use Wait for them.
+func (telegram *Telegram) Stop() {
+	telegram.stop <- struct{}{}
+	<-telegram.stopped
+}
+
+// Wait blocks until handlers of already received updates return, it should
+// be called after Stop so no new handlers are started.
+func (telegram *Telegram) Wait() {
+	telegram.handlers.Wait()
+}
+
+func (telegram *Telegram) dispatch(update tb.Update) {
+	defer func() {
+		if reason := recover(); reason != nil {
+			log.Errorf(nil, "panic while processing update %d: %v", update.ID, reason)
+		}
+	}()
+
+	switch {
+	case update.Message != nil:
+		telegram.dispatchMessage(update.Message)
+
+	case update.Callback != nil:
+		if telegram.callback != nil {
+			telegram.callback(update.Callback)
+		}
+	}
+}
+
+func (telegram *Telegram) dispatchMessage(message *tb.Message) {
+	if message.MigrateTo != 0 {
+		// the service message is sent to the old group
+		if telegram.migration != nil && message.Chat != nil {
+			telegram.migration(message.Chat.ID, message.MigrateTo)
+		}
+
+		return
+	}
+
+	if message.Text != "" {
+		match := commandPattern.FindStringSubmatch(message.Text)
+		if match == nil {
+			return
+		}
+
+		command, botName := match[1], match[3]
+		if botName != "" && !telegram.isBotName(botName) {
+			return
+		}
+
+		message.Payload = match[5]
+
+		if handler, ok := telegram.routes[command]; ok {
+			handler(message)
+		}
+
+		return
+	}
+
+	if message.Document != nil {
+		if handler, ok := telegram.routes[tb.OnDocument]; ok {
+			handler(message)
+		}
+	}
+}
+
+func (telegram *Telegram) isBotName(name string) bool {
+	return telegram.bot.Me != nil &&
+		strings.EqualFold(telegram.bot.Me.Username, name)
+}
@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// testPoller delivers the given updates and then waits to be stopped.
+type testPoller struct {
+	updates   []tb.Update
+	delivered chan struct{}
+}
+
+func (poller *testPoller) Poll(
+	bot *tb.Bot,
+	updates chan tb.Update,
+	stop chan struct{},
+) {
+	for _, update := range poller.updates {
+		updates <- update
+	}
+
+	close(poller.delivered)
+
+	<-stop
+	close(stop)
+}
+
+func Test_Telegram_WaitsForUpdateReceivedBeforeStop(t *testing.T) {
+	telegram := NewBot(&tb.Bot{Me: &tb.User{Username: "notify_bot"}})
+
+	var finished int32
+	var payload string
+	telegram.Handle("/subscribe", func(message *tb.Message) error {
+		time.Sleep(100 * time.Millisecond)
+
+		payload = message.Payload
+		atomic.StoreInt32(&finished, 1)
+
+		return nil
+	})
+
+	var other int32
+	telegram.Handle("/list", func(message *tb.Message) error {
+		atomic.StoreInt32(&other, 1)
+		return nil
+	})
+
+	poller := &testPoller{
+		updates: []tb.Update{
+			{ID: 1, Message: &tb.Message{
+				Text:   "/list@other_bot",
+				Chat:   &tb.Chat{ID: 2},
+				Sender: &tb.User{ID: 2},
+			}},
+			{ID: 2, Message: &tb.Message{
+				Text:   "/subscribe@notify_bot http://example.com/ 1m a",
+				Chat:   &tb.Chat{ID: 2},
+				Sender: &tb.User{ID: 2},
+			}},
+		},
+		delivered: make(chan struct{}),
+	}
+
+	go telegram.Start(poller)
+
+	<-poller.delivered
+
+	telegram.Stop()
+	telegram.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&finished))
+	assert.Equal(t, "http://example.com/ 1m a", payload)
+
+	// commands to other bots of the group are ignored
+	assert.EqualValues(t, 0, atomic.LoadInt32(&other))
+}
+
+func Test_Telegram_DispatchesDocumentsAndMigrations(t *testing.T) {
+	telegram := NewBot(&tb.Bot{})
+
+	var caption string
+	telegram.Handle(tb.OnDocument, func(message *tb.Message) error {
+		caption = message.Caption
+		return nil
+	})
+
+	var from, to int64
+	telegram.HandleMigration(func(oldID, newID int64) error {
+		from, to = oldID, newID
+		return nil
+	})
+
+	telegram.dispatch(tb.Update{Message: &tb.Message{
+		Caption:  "/import",
+		Document: &tb.Document{},
+		Chat:     &tb.Chat{ID: 2},
+	}})
+	assert.Equal(t, "/import", caption)
+
+	telegram.dispatch(tb.Update{Message: &tb.Message{
+		MigrateTo: -1001234567890,
+		Chat:      &tb.Chat{ID: -100},
+	}})
+	assert.Equal(t, int64(-100), from)
+	assert.Equal(t, int64(-1001234567890), to)
+
+	// updates without handlers are skipped
+	telegram.dispatch(tb.Update{Message: &tb.Message{Text: "hello"}})
+	telegram.dispatch(tb.Update{Callback: &tb.Callback{}})
+}
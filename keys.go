@@ -0,0 +1,648 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+	"github.com/reconquest/notify-telegram-bot/internal/printer"
+	"github.com/reconquest/notify-telegram-bot/internal/transport"
+
+	karma "github.com/reconquest/karma-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// keyTreesLimit is the number of trees kept for navigation, buttons of
+	// older trees ask to send /keys again
+	keyTreesLimit = 100
+
+	// keyNodesLimit bounds the number of nodes of all kept trees, the oldest
+	// trees are dropped first
+	keyNodesLimit = 100000
+
+	keyTreePageSize = 10
+	keySampleLength = 32
+	keyValueLength  = 1000
+
+	keysCallbackPrefix = "keys"
+	keysCallbackAdd    = "add"
+)
+
+// keyNode is a value of the browsed document. Objects keep only their
+// Children, which are nodes of object keys sorted by key, other values are
+// cut to what can be shown in a message.
+type keyNode struct {
+	Key      string
+	Parent   int
+	Children []int
+	Object   bool
+
+	// Items is the length of the array before it was cut
+	Items int
+	Value interface{}
+}
+
+// keyTree is a document shown by /keys. Nodes are numbered so buttons can
+// refer to them within 64 bytes of callback data, the tree itself is kept
+// in memory until it's pushed out by newer ones.
+type keyTree struct {
+	ID     string
+	ChatID int64
+	URL    string
+	Nodes  []keyNode
+
+	// SubscriptionID is the subscription of the chat on the url which keys
+	// can be added to, it's zero if there is no such subscription
+	SubscriptionID primitive.ObjectID
+}
+
+func newKeyTree(data map[string]interface{}) *keyTree {
+	tree := &keyTree{}
+	tree.addNode("", data, -1)
+
+	return tree
+}
+
+func (tree *keyTree) addNode(key string, value interface{}, parent int) int {
+	index := len(tree.Nodes)
+	tree.Nodes = append(tree.Nodes, keyNode{
+		Key:    key,
+		Parent: parent,
+	})
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		if array, ok := value.([]interface{}); ok {
+			tree.Nodes[index].Items = len(array)
+		}
+
+		// one rune more than is shown, so the shown text is still cut
+		budget := keyValueLength + 1
+		tree.Nodes[index].Value = cutValue(value, &budget)
+
+		return index
+	}
+
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var children []int
+	for _, key := range keys {
+		children = append(children, tree.addNode(key, object[key], index))
+	}
+
+	tree.Nodes[index].Object = true
+	tree.Nodes[index].Children = children
+
+	return index
+}
+
+// getPath returns keys from the top level to the node.
+func (tree *keyTree) getPath(index int) []string {
+	var path []string
+	for ; index > 0; index = tree.Nodes[index].Parent {
+		path = append([]string{tree.Nodes[index].Key}, path...)
+	}
+
+	return path
+}
+
+// cutValue drops the part of the value which is written by the printer after
+// the budget of runes is spent, so a few first runes of the value are kept
+// instead of the whole response.
+func cutValue(value interface{}, budget *int) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		var keys []string
+		for key := range typed {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		result := map[string]interface{}{}
+		for _, key := range keys {
+			if *budget <= 0 {
+				break
+			}
+
+			*budget -= len([]rune(key)) + 1
+			result[key] = cutValue(typed[key], budget)
+		}
+
+		return result
+
+	case []interface{}:
+		var result []interface{}
+		for _, item := range typed {
+			if *budget <= 0 {
+				break
+			}
+
+			result = append(result, cutValue(item, budget))
+		}
+
+		return result
+
+	case string:
+		runes := []rune(typed)
+		if len(runes) > keyValueLength {
+			typed = string(runes[:keyValueLength+1])
+		}
+
+		*budget -= len(runes)
+
+		return typed
+	}
+
+	*budget--
+
+	return value
+}
+
+type keyTrees struct {
+	mutex   sync.Mutex
+	counter int64
+	trees   map[string]*keyTree
+	order   []string
+	nodes   int
+}
+
+func newKeyTrees() *keyTrees {
+	return &keyTrees{
+		trees: map[string]*keyTree{},
+	}
+}
+
+func (trees *keyTrees) add(tree *keyTree) {
+	trees.mutex.Lock()
+	defer trees.mutex.Unlock()
+
+	trees.counter++
+	tree.ID = strconv.FormatInt(trees.counter, 36)
+
+	trees.trees[tree.ID] = tree
+	trees.order = append(trees.order, tree.ID)
+	trees.nodes += len(tree.Nodes)
+
+	// the newest tree is kept even if it's bigger than the limit
+	for len(trees.order) > 1 &&
+		(len(trees.order) > keyTreesLimit || trees.nodes > keyNodesLimit) {
+		trees.nodes -= len(trees.trees[trees.order[0]].Nodes)
+		delete(trees.trees, trees.order[0])
+		trees.order = trees.order[1:]
+	}
+}
+
+func (trees *keyTrees) get(id string) *keyTree {
+	trees.mutex.Lock()
+	defer trees.mutex.Unlock()
+
+	return trees.trees[id]
+}
+
+// keys shows the tree of keys of the url or the subscription's url, objects
+// are opened by buttons of the inline keyboard.
+func (coordinator *Coordinator) keys(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+	recipientID := getRecipientID(message)
+
+	target := arguments.Get(0)
+	if target == "" {
+		return coordinator.sendReply(
+			message,
+			locale.Translate("Data required!\nIn format:  /keys url|subscriptionID"),
+		)
+	}
+
+	var data map[string]interface{}
+	var subscriber *Subscriber
+
+	url := target
+	trusted := coordinator.isBotAdmin(message.Sender.ID)
+
+	id, err := primitive.ObjectIDFromHex(target)
+	bySubscription := err == nil
+	if bySubscription {
+		subscriber, err = coordinator.database.getSubscription(id)
+		if err != nil {
+			return karma.Format(err, "unable to find subscription")
+		}
+
+		if subscriber == nil || subscriber.UserID != recipientID {
+			return coordinator.sendReply(
+				message,
+				locale.Translate("You don't have subscription with this id"),
+			)
+		}
+
+		url = subscriber.URL
+		trusted = trusted || subscriber.Trusted
+	} else {
+		subscriber, err = coordinator.database.findSubscriber(recipientID, url)
+		if err != nil {
+			return karma.Format(err, "unable to find subscription")
+		}
+	}
+
+	if subscriber != nil && subscriber.Kind == SubscriptionUptime {
+		if bySubscription {
+			return coordinator.sendReply(
+				message,
+				locale.Translate(
+					"This subscription doesn't have json keys, use /status to "+
+						"see the state of its url",
+				),
+			)
+		}
+
+		// keys can't be added to uptime subscriptions
+		subscriber = nil
+	}
+
+	if subscriber != nil && subscriber.Kind == SubscriptionWebhook {
+		endpoint, err := coordinator.database.findSubscriberEndpoint(*subscriber)
+		if err != nil {
+			return karma.Format(err, "unable to find endpoint")
+		}
+
+		if endpoint == nil || endpoint.Data == nil {
+			return coordinator.sendReply(
+				message,
+				locale.Translate("No data was received yet"),
+			)
+		}
+
+		data = endpoint.Data
+	} else {
+		data, err = coordinator.fetchChatJSON(message, locale, url, trusted)
+		if data == nil {
+			return err
+		}
+	}
+
+	tree := newKeyTree(data)
+	tree.ChatID = int64(recipientID)
+	tree.URL = url
+	if subscriber != nil {
+		tree.SubscriptionID = subscriber.ID
+	}
+
+	coordinator.keyTrees.add(tree)
+
+	text, keyboard := coordinator.renderKeyTree(locale, tree, 0, 0, subscriber)
+
+	var recipient tb.Recipient = message.Sender
+	if message.Chat != nil {
+		recipient = message.Chat
+	}
+
+	err = coordinator.transport.SendKeyboard(recipient, text, keyboard)
+	if err != nil {
+		return karma.Format(err, "unable to send message to user: %d", recipientID)
+	}
+
+	return nil
+}
+
+// keysCallback handles buttons of /keys messages: opens nodes, turns pages
+// and adds keys to the subscription.
+func (coordinator *Coordinator) keysCallback(callback *tb.Callback) (string, error) {
+	fields := strings.Split(callback.Data, ":")
+	if len(fields) != 4 || fields[0] != keysCallbackPrefix {
+		return "", nil
+	}
+
+	message := *callback.Message
+	message.Sender = callback.Sender
+
+	locale := coordinator.getLocale(&message)
+
+	tree := coordinator.keyTrees.get(fields[1])
+	node, err := strconv.Atoi(fields[2])
+	if tree == nil || tree.ChatID != message.Chat.ID ||
+		err != nil || node < 0 || node >= len(tree.Nodes) {
+		return locale.Translate("These keys are outdated, send /keys again"), nil
+	}
+
+	var notice string
+	page := 0
+	if fields[3] == keysCallbackAdd {
+		notice, err = coordinator.addKeyFromTree(&message, locale, tree, node)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		page, _ = strconv.Atoi(fields[3])
+	}
+
+	subscriber, err := coordinator.getKeyTreeSubscriber(tree)
+	if err != nil {
+		return "", err
+	}
+
+	text, keyboard := coordinator.renderKeyTree(locale, tree, node, page, subscriber)
+
+	err = coordinator.transport.EditKeyboard(callback.Message, text, keyboard)
+	if err != nil {
+		return "", karma.Format(err, "unable to edit message")
+	}
+
+	return notice, nil
+}
+
+func (coordinator *Coordinator) getKeyTreeSubscriber(
+	tree *keyTree,
+) (*Subscriber, error) {
+	if tree.SubscriptionID.IsZero() {
+		return nil, nil
+	}
+
+	subscriber, err := coordinator.database.getSubscription(tree.SubscriptionID)
+	if err != nil {
+		return nil, karma.Format(err, "unable to find subscription")
+	}
+
+	// the subscription could be removed while the tree was browsed
+	if subscriber == nil || int64(subscriber.UserID) != tree.ChatID {
+		return nil, nil
+	}
+
+	return subscriber, nil
+}
+
+// addKeyFromTree adds the path of the node to the keys of the subscription,
+// the returned text is shown to the user who pressed the button.
+func (coordinator *Coordinator) addKeyFromTree(
+	message *tb.Message,
+	locale i18n.Locale,
+	tree *keyTree,
+	node int,
+) (string, error) {
+	// in groups only chat admins can change subscriptions
+	err := coordinator.authorize("/subscribe", message)
+	if denied, ok := err.(transport.AccessDenied); ok {
+		return string(denied), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	subscriber, err := coordinator.getKeyTreeSubscriber(tree)
+	if err != nil {
+		return "", err
+	}
+
+	if subscriber == nil {
+		return locale.Translate("You don't have subscription with this id"), nil
+	}
+
+	if subscriber.Managed {
+		return locale.Translate(
+			"This subscription is managed by the configuration file and " +
+				"can't be changed",
+		), nil
+	}
+
+	path := tree.getPath(node)
+	if len(path) == 0 || strings.Contains(strings.Join(path, ""), ".") {
+		return "", nil
+	}
+
+	key := strings.Join(path, ".")
+	if hasKey(subscriber.Keys, key) {
+		return locale.Sprintf("Key %s is already in the subscription", key), nil
+	}
+
+	subscriber.Keys = append(subscriber.Keys, key)
+
+	err = coordinator.saveSubscription(*subscriber)
+	if err != nil {
+		return "", err
+	}
+
+	return locale.Sprintf("Key %s was added to the subscription", key), nil
+}
+
+// renderKeyTree writes the node of the tree: children of objects with their
+// types and sample values or the whole value of other nodes.
+func (coordinator *Coordinator) renderKeyTree(
+	locale i18n.Locale,
+	tree *keyTree,
+	index int,
+	page int,
+	subscriber *Subscriber,
+) (string, transport.Keyboard) {
+	node := tree.Nodes[index]
+	printer := coordinator.newPrinter(locale)
+	nodePath := tree.getPath(index)
+	path := strings.Join(nodePath, ".")
+
+	header := []string{"URL - " + tree.URL}
+	if index == 0 {
+		header = append(header, locale.Sprintf("PATH - %s", locale.Translate("top level")))
+	} else {
+		header = append(
+			header,
+			locale.Sprintf("PATH - %s", path),
+			locale.Sprintf("TYPE - %s", describeNode(locale, printer, node)),
+		)
+	}
+
+	text := []string{strings.Join(header, "\n")}
+
+	var keyboard transport.Keyboard
+
+	pages := (len(node.Children) + keyTreePageSize - 1) / keyTreePageSize
+	if page < 0 || page >= pages {
+		page = 0
+	}
+
+	if node.Object {
+		var children []int
+		if len(node.Children) > 0 {
+			end := (page + 1) * keyTreePageSize
+			if end > len(node.Children) {
+				end = len(node.Children)
+			}
+
+			children = node.Children[page*keyTreePageSize : end]
+		}
+
+		var lines []string
+		var row []transport.Button
+		for _, child := range children {
+			key := tree.Nodes[child].Key
+
+			lines = append(lines, key+" - "+describeNode(
+				locale,
+				printer,
+				tree.Nodes[child],
+			))
+
+			label := key
+			if len(tree.Nodes[child].Children) > 0 {
+				label += " ›"
+			}
+
+			row = append(row, transport.Button{
+				Text: label,
+				Data: getKeysCallbackData(tree, child, "0"),
+			})
+
+			if len(row) == 2 {
+				keyboard = append(keyboard, row)
+				row = nil
+			}
+		}
+
+		if len(row) > 0 {
+			keyboard = append(keyboard, row)
+		}
+
+		if len(lines) > 0 {
+			text = append(text, strings.Join(lines, "\n"))
+		}
+
+		if pages > 1 {
+			text = append(text, locale.Sprintf("PAGE - %d of %d", page+1, pages))
+		}
+	} else {
+		text = append(text, truncate(printer.String(node.Value), keyValueLength))
+	}
+
+	var navigation []transport.Button
+	if node.Parent >= 0 {
+		parentPage := 0
+		for position, sibling := range tree.Nodes[node.Parent].Children {
+			if sibling == index {
+				parentPage = position / keyTreePageSize
+			}
+		}
+
+		navigation = append(navigation, transport.Button{
+			Text: "⬆ " + locale.Translate("Up"),
+			Data: getKeysCallbackData(tree, node.Parent, strconv.Itoa(parentPage)),
+		})
+	}
+
+	if page > 0 {
+		navigation = append(navigation, transport.Button{
+			Text: "‹",
+			Data: getKeysCallbackData(tree, index, strconv.Itoa(page-1)),
+		})
+	}
+
+	if page+1 < pages {
+		navigation = append(navigation, transport.Button{
+			Text: "›",
+			Data: getKeysCallbackData(tree, index, strconv.Itoa(page+1)),
+		})
+	}
+
+	if len(navigation) > 0 {
+		keyboard = append(keyboard, navigation)
+	}
+
+	// keys with dots can't be addressed by subscriptions
+	if index == 0 || strings.Contains(strings.Join(nodePath, ""), ".") {
+		return strings.Join(text, "\n\n"), keyboard
+	}
+
+	switch {
+	case subscriber == nil:
+		if tree.SubscriptionID.IsZero() {
+			text = append(text, locale.Sprintf(
+				"Subscribe with: /subscribe %s duration %s",
+				tree.URL,
+				quoteArgument(path),
+			))
+		}
+
+	case subscriber.Managed || hasKey(subscriber.Keys, path):
+
+	default:
+		keyboard = append(keyboard, []transport.Button{{
+			Text: "+ " + locale.Sprintf("Add %s", path),
+			Data: getKeysCallbackData(tree, index, keysCallbackAdd),
+		}})
+	}
+
+	return strings.Join(text, "\n\n"), keyboard
+}
+
+func getKeysCallbackData(tree *keyTree, node int, action string) string {
+	return fmt.Sprintf("%s:%s:%d:%s", keysCallbackPrefix, tree.ID, node, action)
+}
+
+// describeNode returns the type of the node's value with its size or a
+// sample.
+func describeNode(
+	locale i18n.Locale,
+	printer printer.Printer,
+	node keyNode,
+) string {
+	if node.Object {
+		return locale.Sprintf("object, %d keys", len(node.Children))
+	}
+
+	value := node.Value
+	switch typed := value.(type) {
+	case []interface{}:
+		return locale.Sprintf("array, %d items", node.Items)
+	case string:
+		return locale.Sprintf(
+			"string, %s",
+			strconv.Quote(truncate(typed, keySampleLength)),
+		)
+	case float64:
+		return locale.Sprintf("number, %s", printer.String(typed))
+	case bool:
+		return locale.Sprintf("boolean, %t", typed)
+	case nil:
+		return "null"
+	}
+
+	return truncate(printer.String(value), keySampleLength)
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+
+	return string(runes[:length]) + "…"
+}
+
+func hasKey(keys []string, key string) bool {
+	for _, existing := range keys {
+		if existing == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quoteArgument quotes the command argument if it has spaces.
+func quoteArgument(argument string) string {
+	if strings.ContainsAny(argument, " \"'") {
+		return strconv.Quote(argument)
+	}
+
+	return argument
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/reconquest/notify-telegram-bot/internal/printer"
+	"github.com/reconquest/notify-telegram-bot/internal/transport"
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func Test_Coordinator_BrowsesKeysAndAddsThemToSubscription(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(
+				writer,
+				`{"status": "ok", "build": {"version": "1.2"}, "items": [1, 2]}`,
+			)
+		},
+	))
+	defer server.Close()
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	message := createMessage(server.URL, "10s", "status", 1, 2)
+	err = coordinator.subscribe(message)
+	assert.NoError(t, err)
+
+	message.Payload = server.URL
+	err = coordinator.keys(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"URL - "+server.URL+"\nPATH - top level\n\n"+
+			"build - object, 1 keys\n"+
+			"items - array, 2 items\n"+
+			"status - string, \"ok\"",
+		telegramBot.lastSentMessage,
+	)
+	assert.Equal(
+		t,
+		transport.Keyboard{
+			{{Text: "build ›", Data: "keys:1:1:0"}, {Text: "items", Data: "keys:1:3:0"}},
+			{{Text: "status", Data: "keys:1:4:0"}},
+		},
+		telegramBot.lastKeyboard,
+	)
+
+	callback := &tb.Callback{
+		Sender:  message.Sender,
+		Message: &tb.Message{Chat: message.Chat},
+		Data:    "keys:1:2:0",
+	}
+
+	notice, err := coordinator.keysCallback(callback)
+	assert.NoError(t, err)
+	assert.Empty(t, notice)
+	assert.Equal(
+		t,
+		"URL - "+server.URL+"\nPATH - build.version\nTYPE - string, \"1.2\"\n\n1.2",
+		telegramBot.lastSentMessage,
+	)
+	assert.Equal(
+		t,
+		transport.Keyboard{
+			{{Text: "⬆ Up", Data: "keys:1:1:0"}},
+			{{Text: "+ Add build.version", Data: "keys:1:2:add"}},
+		},
+		telegramBot.lastKeyboard,
+	)
+
+	callback.Data = "keys:1:2:add"
+	notice, err = coordinator.keysCallback(callback)
+	assert.NoError(t, err)
+	assert.Equal(t, "Key build.version was added to the subscription", notice)
+	assert.Equal(
+		t,
+		transport.Keyboard{{{Text: "⬆ Up", Data: "keys:1:1:0"}}},
+		telegramBot.lastKeyboard,
+	)
+
+	subscriber, err := coordinator.database.findSubscriber(2, server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"status", "build.version"}, subscriber.Keys)
+
+	// buttons of other chats and unknown trees are ignored
+	callback.Message = &tb.Message{Chat: &tb.Chat{ID: 5}}
+	notice, err = coordinator.keysCallback(callback)
+	assert.NoError(t, err)
+	assert.Equal(t, "These keys are outdated, send /keys again", notice)
+}
+
+func Test_Coordinator_SuggestsSubscribeForBrowsedKeys(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(writer, `{"total sales": 10}`)
+		},
+	))
+	defer server.Close()
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = server.URL
+	err = coordinator.keys(message)
+	assert.NoError(t, err)
+
+	notice, err := coordinator.keysCallback(&tb.Callback{
+		Sender:  message.Sender,
+		Message: &tb.Message{Chat: message.Chat},
+		Data:    "keys:1:1:0",
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, notice)
+	assert.Equal(
+		t,
+		"URL - "+server.URL+"\nPATH - total sales\nTYPE - number, 10\n\n10\n\n"+
+			"Subscribe with: /subscribe "+server.URL+" duration \"total sales\"",
+		telegramBot.lastSentMessage,
+	)
+}
+
+func Test_keyTree_KeepsOnlyShownPartOfValues(t *testing.T) {
+	var items []interface{}
+	for i := 0; i < 1000; i++ {
+		items = append(items, map[string]interface{}{
+			"name": strings.Repeat("x", 100),
+		})
+	}
+
+	tree := newKeyTree(map[string]interface{}{
+		"items": items,
+		"text":  strings.Repeat("y", 100000),
+	})
+
+	assert.Len(t, tree.Nodes, 3)
+	assert.Equal(t, []string{"items"}, tree.getPath(1))
+	assert.Equal(t, 1000, tree.Nodes[1].Items)
+	assert.True(t, len(tree.Nodes[1].Value.([]interface{})) < 20)
+	assert.Len(t, tree.Nodes[2].Value, keyValueLength+1)
+
+	text := printer.String(tree.Nodes[1].Value)
+	assert.Equal(
+		t,
+		truncate(printer.String(items), keyValueLength),
+		truncate(text, keyValueLength),
+	)
+}
+
+func Test_keyTrees_DropsOldestTreesAboveNodesLimit(t *testing.T) {
+	data := map[string]interface{}{}
+	for i := 0; i < keyNodesLimit/4; i++ {
+		data[fmt.Sprint(i)] = i
+	}
+
+	trees := newKeyTrees()
+
+	first := newKeyTree(data)
+	trees.add(first)
+	trees.add(newKeyTree(data))
+	trees.add(newKeyTree(data))
+
+	assert.NotNil(t, trees.get(first.ID))
+
+	last := newKeyTree(data)
+	trees.add(last)
+
+	assert.Nil(t, trees.get(first.ID))
+	assert.NotNil(t, trees.get(last.ID))
+}
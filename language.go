@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+	"github.com/reconquest/notify-telegram-bot/internal/printer"
+
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// languageAuto resets the language of the chat to the language of the
+// Telegram client.
+const languageAuto = "auto"
+
+// getChatLocale returns the locale of the chat: the language chosen by
+// /language or the language of the user's Telegram client and the timezone
+// chosen by /timezone. Messages are still sent if settings can't be read,
+// so errors are only logged.
+func (coordinator *Coordinator) getChatLocale(
+	chatID int64,
+	user *tb.User,
+) i18n.Locale {
+	settings, err := coordinator.database.getChatSettings(chatID)
+	if err != nil {
+		log.Errorf(err, "unable to get settings of chat %d", chatID)
+	}
+
+	var language string
+	if settings != nil {
+		language = settings.Language
+	}
+
+	if language == "" && user != nil {
+		language = i18n.Match(user.LanguageCode)
+	}
+
+	locale := i18n.NewLocale(language)
+	locale.Location = coordinator.getChatLocation(settings)
+
+	return locale
+}
+
+// newPrinter returns the printer of json data for the chat.
+func (coordinator *Coordinator) newPrinter(locale i18n.Locale) printer.Printer {
+	return printer.Printer{
+		Formatter:   locale,
+		DetectDates: coordinator.config.Format.DetectDates,
+	}
+}
+
+func (coordinator *Coordinator) getLocale(message *tb.Message) i18n.Locale {
+	return coordinator.getChatLocale(
+		int64(getRecipientID(message)),
+		message.Sender,
+	)
+}
+
+func (coordinator *Coordinator) getSubscriberLocale(
+	subscriber Subscriber,
+) i18n.Locale {
+	return coordinator.getChatLocale(
+		getSubscriberChatID(subscriber),
+		subscriber.Sender,
+	)
+}
+
+// language shows or changes the language of the chat.
+func (coordinator *Coordinator) language(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+
+	language := strings.ToLower(arguments.Get(0))
+	if language == "" {
+		return coordinator.sendReply(
+			message,
+			locale.Sprintf(
+				"LANGUAGE - %s\n\nIn format:  /language %s",
+				locale.Language,
+				strings.Join(append(i18n.Languages, languageAuto), "|"),
+			),
+		)
+	}
+
+	if language == languageAuto {
+		language = ""
+	} else if !i18n.IsSupported(language) {
+		return coordinator.sendReply(
+			message,
+			locale.Sprintf(
+				"Unknown language, available languages: %s",
+				strings.Join(i18n.Languages, ", "),
+			),
+		)
+	}
+
+	chatID := int64(getRecipientID(message))
+
+	err = coordinator.database.setChatLanguage(chatID, language)
+	if err != nil {
+		return karma.Format(err, "unable to set language of chat %d", chatID)
+	}
+
+	locale = coordinator.getLocale(message)
+
+	return coordinator.sendReply(
+		message,
+		locale.Sprintf("Language was changed to %s", locale.Language),
+	)
+}
+
+// localizeError returns the text of the error shown in chats, only
+// validation errors are translated, other errors are technical details.
+func localizeError(locale i18n.Locale, err error) string {
+	if validation, ok := err.(validationError); ok {
+		return validation.localize(locale)
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_UsesLanguageOfChat(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(writer, `{"value": 12345.5}`)
+		},
+	))
+	defer server.Close()
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	message := createMessage(server.URL, "10s", "value", 1, 2)
+	message.Sender.LanguageCode = "ru-RU"
+
+	err = coordinator.subscribe(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "Вы успешно подписались!")
+	assert.Contains(t, telegramBot.lastSentMessage, "12\u00a0345,5")
+
+	language := createMessage("", "", "", 1, 2)
+	language.Payload = "en"
+
+	err = coordinator.language(language)
+	assert.NoError(t, err)
+	assert.Equal(t, "Language was changed to en", telegramBot.lastSentMessage)
+
+	// the chosen language overrides the language of the client
+	err = coordinator.list(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "My subscriptions:")
+
+	language.Payload = "de"
+	err = coordinator.language(language)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Unknown language, available languages: en, ru",
+		telegramBot.lastSentMessage,
+	)
+
+	language.Payload = "auto"
+	err = coordinator.language(language)
+	assert.NoError(t, err)
+
+	err = coordinator.list(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "Мои подписки:")
+}
+
+func Test_localizeError_TranslatesValidationErrors(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	err = coordinator.database.setChatLanguage(2, "ru")
+	assert.NoError(t, err)
+
+	locale := coordinator.getChatLocale(2, nil)
+
+	assert.Equal(
+		t,
+		"интервал должен быть не меньше 1s",
+		localizeError(locale, newValidationError("interval must be at least %s", "1s")),
+	)
+	assert.Equal(
+		t,
+		"interval must be at least 1s",
+		newValidationError("interval must be at least %s", "1s").Error(),
+	)
+}
+
+func Test_Storage_KeepsChatSettings(t *testing.T) {
+	database := createTestDatabase()
+	defer database.Drop()
+
+	settings, err := database.getChatSettings(2)
+	assert.NoError(t, err)
+	assert.Nil(t, settings)
+
+	err = database.setChatLanguage(2, "ru")
+	assert.NoError(t, err)
+
+	err = database.setChatTimezone(2, "Europe/Berlin")
+	assert.NoError(t, err)
+
+	err = database.migrateChatSettings(2, 3)
+	assert.NoError(t, err)
+
+	settings, err = database.getChatSettings(2)
+	assert.NoError(t, err)
+	assert.Nil(t, settings)
+
+	settings, err = database.getChatSettings(3)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		&ChatSettings{ChatID: 3, Language: "ru", Timezone: "Europe/Berlin"},
+		settings,
+	)
+}
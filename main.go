@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/reconquest/notify-telegram-bot/internal/transport"
@@ -20,9 +23,12 @@ Get json data and send notifications by json-key.
 
 Usage:
   notify-telegram-bot [options]
+  notify-telegram-bot [options] export [--format <format>]
+  notify-telegram-bot [options] import [<file>]
 
 Options:
   -c --config <path>  Read specified config file. [default: config.toml]
+  --format <format>   Export format, json or yaml. [default: json]
   --debug             Enable debug messages.
   -v --version        Print version.
   -h --help           Show this help.
@@ -54,24 +60,52 @@ func main() {
 		log.Fatal(err)
 	}
 
+	switch {
+	case args["export"].(bool):
+		err := runExport(config, args["--format"].(string), os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+
+	case args["import"].(bool):
+		input := os.Stdin
+		if path, ok := args["<file>"].(string); ok {
+			input, err = os.Open(path)
+			if err != nil {
+				log.Fatal(karma.Format(err, "unable to open file: %s", path))
+			}
+
+			defer input.Close()
+		}
+
+		err := runImport(config, input)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	log.Infof(nil, "creating telegram bot")
 
+	poller := transport.NewPoller(10 * time.Second)
+
 	bot, err := tb.NewBot(
 		tb.Settings{
-			Token:  config.TelegramBotToken,
-			Poller: &tb.LongPoller{Timeout: 10 * time.Second},
+			Token: config.TelegramBotToken,
 		},
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Infof(nil, "connecting to the database")
-	database, err := NewDatabase(
-		config.DatabaseURI,
-		config.DatabaseName,
-		context.Background(),
-	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log.Infof(nil, "connecting to the %s storage", config.Storage)
+	database, err := OpenStorage(config, ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -81,49 +115,112 @@ func main() {
 	coordinator := NewCoordinator(telegramBot, database, config)
 	coordinator.cache = nil
 
-	go func() {
-		log.Info("start cycle with updating endpoints")
-		for {
-			err := coordinator.routineUpdateEndpoints()
+	coordinator.poller = poller
+	coordinator.context = ctx
+	coordinator.configPath = args["--config"].(string)
+
+	declarations, err := loadSubscriptionDeclarations(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = coordinator.reconcileSubscriptions(declarations)
+	if err != nil {
+		log.Fatal(karma.Format(err, "unable to reconcile declared subscriptions"))
+	}
+
+	coordinator.startRoutine(
+		"updating endpoints",
+		1*time.Second,
+		coordinator.routineUpdateEndpoints,
+	)
+
+	coordinator.startRoutine(
+		"sending data to subscriber",
+		2*time.Second,
+		coordinator.routineSendDataToSubscribers,
+	)
+
+	coordinator.startRoutine(
+		"sending outbox messages",
+		200*time.Millisecond,
+		coordinator.routineSendOutbox,
+	)
+
+	coordinator.startRoutine(
+		"cleaning unused endpoints",
+		60*time.Second,
+		coordinator.routineCleanEndpoints,
+	)
+
+	coordinator.startRoutine(
+		"watching declared subscriptions",
+		5*time.Second,
+		coordinator.routineWatchDeclarations,
+	)
+
+	if config.HTTP.Listen != "" {
+		go func() {
+			err := coordinator.serveHTTP()
 			if err != nil {
-				log.Error(err)
+				log.Fatal(err)
 			}
+		}()
+	}
 
-			time.Sleep(1 * time.Second)
-		}
-	}()
+	telegramBot.SetAuthorizer(coordinator.authorize)
+	coordinator.handlers = telegramBot
 
+	err = coordinator.registerCommands(telegramBot)
+	if err != nil {
+		log.Error(err)
+	}
+
+	telegramBot.Handle(tb.OnDocument, coordinator.importDocument)
+	telegramBot.HandleCallback(coordinator.keysCallback)
+	telegramBot.HandleMigration(coordinator.migrateChat)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
 	go func() {
-		log.Info("start cycle with sending data to subscriber")
-		for {
-			err := coordinator.routineSendDataToSubscribers()
+		for range reloads {
+			log.Infof(nil, "received SIGHUP, reloading declared subscriptions")
+
+			err := coordinator.reloadSubscriptions()
 			if err != nil {
-				log.Error(err)
+				log.Errorf(err, "unable to reload declared subscriptions")
 			}
-
-			time.Sleep(2 * time.Second)
 		}
 	}()
 
-	go func() {
-		log.Info("start cycle with cleaning unused endpoints")
-		for {
-			err := coordinator.routineCleanEndpoints()
-			if err != nil {
-				log.Error(err)
-			}
+	log.Infof(nil, "starting to listen and serve telegram bot")
+	go telegramBot.Start(poller)
 
-			time.Sleep(60 * time.Second)
-		}
+	received := <-signals
+	log.Infof(nil, "received %s, shutting down", received)
+
+	go func() {
+		received := <-signals
+		log.Warningf(nil, "received %s again, exiting immediately", received)
+		os.Exit(1)
 	}()
 
-	telegramBot.Handle("/start", coordinator.start)
-	telegramBot.Handle("/help", coordinator.start)
-	telegramBot.Handle("/subscribe", coordinator.subscribe)
-	telegramBot.Handle("/stop", coordinator.stop)
-	telegramBot.Handle("/list", coordinator.list)
-	telegramBot.Handle("/unsubscribe", coordinator.unsubscribe)
+	telegramBot.Stop()
 
-	log.Infof(nil, "starting to listen and serve telegram bot")
-	bot.Start()
+	err = coordinator.shutdown(config.ShutdownTimeout.Duration, cancel)
+	if err != nil {
+		log.Error(err)
+	}
+
+	cancel()
+
+	err = database.Disconnect()
+	if err != nil {
+		log.Error(err)
+	}
+
+	log.Infof(nil, "notify-telegram-bot stopped")
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const metricsNamespace = "notify_bot"
+
+var (
+	metricFetchDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "fetch_duration_seconds",
+			Help:      "Duration of endpoint requests by host and result.",
+		},
+		[]string{"host", "result"},
+	)
+
+	metricFetchErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "fetch_errors_total",
+			Help:      "Number of failed endpoint requests by host.",
+		},
+		[]string{"host"},
+	)
+
+	metricEndpointsDue = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "endpoints_due",
+			Help:      "Number of endpoints due for refresh on the last tick.",
+		},
+	)
+
+	metricEndpointsRefreshed = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "endpoints_refreshed",
+			Help:      "Number of endpoints refreshed on the last tick.",
+		},
+	)
+
+	metricNotificationsSent = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notifications_sent_total",
+			Help:      "Number of delivered notifications by transport.",
+		},
+		[]string{"transport"},
+	)
+
+	metricNotificationsFailed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notifications_failed_total",
+			Help:      "Number of failed notification attempts by transport.",
+		},
+		[]string{"transport"},
+	)
+
+	metricOutboxDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "outbox_depth",
+			Help:      "Number of notifications waiting for delivery.",
+		},
+	)
+
+	metricDatabaseDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "database_operation_duration_seconds",
+			Help:      "Duration of MongoDB commands by command and result.",
+		},
+		[]string{"command", "result"},
+	)
+
+	metricActiveSubscriptions = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_subscriptions",
+			Help:      "Number of subscriptions which are not paused or disabled.",
+		},
+	)
+
+	metricEndpoints = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "endpoints",
+			Help:      "Number of endpoints.",
+		},
+	)
+)
+
+// transportTelegram is the only transport so far, it's used as a label
+// value for notification metrics.
+const transportTelegram = "telegram"
+
+// metricHostOther is the host label of requests to hosts which didn't fit
+// into metric_hosts, urls come from users and a label per host would grow
+// without bound.
+const metricHostOther = "other"
+
+// metricHosts remembers hosts which got their own label, the first
+// limit hosts keep it until restart.
+type metricHosts struct {
+	mutex sync.Mutex
+	limit int
+	hosts map[string]struct{}
+}
+
+func newMetricHosts(limit int) *metricHosts {
+	return &metricHosts{
+		limit: limit,
+		hosts: map[string]struct{}{},
+	}
+}
+
+// getLabel returns the host label of fetch metrics for the url.
+func (labels *metricHosts) getLabel(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return metricHostOther
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+
+	labels.mutex.Lock()
+	defer labels.mutex.Unlock()
+
+	if _, ok := labels.hosts[host]; ok {
+		return host
+	}
+
+	if len(labels.hosts) >= labels.limit {
+		return metricHostOther
+	}
+
+	labels.hosts[host] = struct{}{}
+
+	return host
+}
+
+func observeFetch(host string, started time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+		metricFetchErrors.WithLabelValues(host).Inc()
+	}
+
+	metricFetchDuration.WithLabelValues(host, result).Observe(
+		time.Since(started).Seconds(),
+	)
+}
+
+// updateCountMetrics counts subscriptions and endpoints, it's called on
+// every scrape so the gauges are never behind.
+func (coordinator *Coordinator) updateCountMetrics() error {
+	subscribers, err := coordinator.database.listSubscriptions()
+	if err != nil {
+		return karma.Format(err, "unable to list subscriptions")
+	}
+
+	endpoints, err := coordinator.database.listEndpoints()
+	if err != nil {
+		return karma.Format(err, "unable to list endpoints")
+	}
+
+	active := 0
+	for _, subscriber := range subscribers {
+		if !subscriber.Disabled && !subscriber.Paused {
+			active++
+		}
+	}
+
+	metricActiveSubscriptions.Set(float64(active))
+	metricEndpoints.Set(float64(len(endpoints)))
+
+	return nil
+}
+
+// newMetricsHandler serves prometheus metrics, counts which are stored in
+// the database are updated first.
+func (coordinator *Coordinator) newMetricsHandler() http.Handler {
+	handler := promhttp.Handler()
+
+	return http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			err := coordinator.updateCountMetrics()
+			if err != nil {
+				log.Errorf(err, "unable to update count metrics")
+			}
+
+			handler.ServeHTTP(writer, request)
+		},
+	)
+}
+
+func newDatabaseMonitor() *event.CommandMonitor {
+	observe := func(command string, nanos int64, result string) {
+		metricDatabaseDuration.WithLabelValues(command, result).Observe(
+			time.Duration(nanos).Seconds(),
+		)
+	}
+
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, event *event.CommandSucceededEvent) {
+			observe(event.CommandName, event.DurationNanos, "success")
+		},
+		Failed: func(_ context.Context, event *event.CommandFailedEvent) {
+			observe(event.CommandName, event.DurationNanos, "error")
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_metricHosts_LimitsNumberOfLabels(t *testing.T) {
+	hosts := newMetricHosts(2)
+
+	assert.Equal(t, "a.example.com", hosts.getLabel("https://A.example.com:8443/health"))
+	assert.Equal(t, "b.example.com", hosts.getLabel("https://b.example.com/"))
+	assert.Equal(t, metricHostOther, hosts.getLabel("https://c.example.com/"))
+	assert.Equal(t, "a.example.com", hosts.getLabel("http://a.example.com/other"))
+	assert.Equal(t, metricHostOther, hosts.getLabel("://broken"))
+}
+
+func Test_Coordinator_CountsSubscriptionsOnScrape(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	err = coordinator.subscribe(createMessage("http://127.0.0.1:1/", "1m", "a", 1, 2))
+	assert.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	coordinator.newMetricsHandler().ServeHTTP(
+		recorder,
+		httptest.NewRequest("GET", "/metrics", nil),
+	)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricActiveSubscriptions))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricEndpoints))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration changes a raw document of the collection and reports whether
+// the document was changed. Raw documents are used so old migrations keep
+// working after structs change.
+type migration struct {
+	version    int
+	name       string
+	collection string
+	migrate    func(document bson.M) bool
+}
+
+// migrations are applied in order, a new migration must be appended with
+// the next version.
+var migrations = []migration{
+	{
+		version:    1,
+		name:       "convert keys of subscriptions to array",
+		collection: "subscriptions",
+		migrate:    migrateKeysToArray,
+	},
+	{
+		version:    2,
+		name:       "drop recipient fields of subscriptions",
+		collection: "subscriptions",
+		migrate:    migrateDropRecipient,
+	},
+}
+
+// appliedMigration is stored in the migrations collection, the largest
+// version is the schema version of the database.
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// parseKeys splits comma-separated json keys given by user.
+func parseKeys(text string) []string {
+	var keys []string
+	for _, key := range strings.Split(text, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func migrateKeysToArray(document bson.M) bool {
+	keys, ok := document["keys"].(string)
+	if !ok {
+		return false
+	}
+
+	document["keys"] = parseKeys(keys)
+
+	return true
+}
+
+// migrateDropRecipient removes fields which are computed before sending
+// but were persisted by older versions.
+func migrateDropRecipient(document bson.M) bool {
+	changed := false
+	for _, field := range []string{"recipient", "recipientid"} {
+		if _, ok := document[field]; ok {
+			delete(document, field)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// getPendingMigrations returns migrations newer than the given version.
+func getPendingMigrations(version int) []migration {
+	var pending []migration
+	for _, migration := range migrations {
+		if migration.version > version {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending
+}
+
+func (database *Database) getSchemaVersion() (int, error) {
+	var applied appliedMigration
+	err := database.Migrations.FindOne(
+		database.context,
+		bson.M{},
+		options.FindOne().SetSort(bson.M{"_id": -1}),
+	).Decode(&applied)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+
+		return 0, karma.Format(
+			err,
+			"unable to find data in %s collection",
+			database.Migrations.Name(),
+		)
+	}
+
+	return applied.Version, nil
+}
+
+// migrate applies pending migrations one by one, every migration is
+// recorded right after it's applied, so an interrupted run continues from
+// the failed migration.
+func (database *Database) migrate() error {
+	version, err := database.getSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range getPendingMigrations(version) {
+		log.Infof(
+			nil,
+			"applying migration %d: %s",
+			migration.version,
+			migration.name,
+		)
+
+		err := database.applyMigration(migration)
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to apply migration %d",
+				migration.version,
+			)
+		}
+	}
+
+	return nil
+}
+
+func (database *Database) applyMigration(migration migration) error {
+	collection := database.client.Database(database.name).Collection(
+		migration.collection,
+	)
+
+	cursor, err := collection.Find(database.context, bson.M{})
+	if err != nil {
+		return karma.Format(
+			err,
+			"can't find data in %s collection",
+			migration.collection,
+		)
+	}
+
+	defer cursor.Close(database.context)
+
+	for cursor.Next(database.context) {
+		var document bson.M
+		err := cursor.Decode(&document)
+		if err != nil {
+			return karma.Format(
+				err,
+				"can't decode data from %s collection",
+				migration.collection,
+			)
+		}
+
+		if !migration.migrate(document) {
+			continue
+		}
+
+		_, err = collection.ReplaceOne(
+			database.context,
+			bson.M{"_id": document["_id"]},
+			document,
+		)
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to update record in %s collection",
+				migration.collection,
+			)
+		}
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Migrations.InsertOne(
+		database.context,
+		appliedMigration{
+			Version:   migration.version,
+			Name:      migration.name,
+			AppliedAt: time.Now(),
+		},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to insert record into %s collection",
+			database.Migrations.Name(),
+		)
+	}
+
+	return nil
+}
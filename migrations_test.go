@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_NewBoltStorage_MigratesOldSubscriptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify-telegram-bot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bot.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	assert.NoError(t, err)
+
+	id := primitive.NewObjectID()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(boltSubscriptions)
+		if err != nil {
+			return err
+		}
+
+		data, err := bson.Marshal(bson.M{
+			"_id":         id,
+			"url":         "http://example.com",
+			"userid":      1,
+			"keys":        "time, date.day",
+			"recipient":   bson.M{"id": 1},
+			"recipientid": 1,
+		})
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(id[:], data)
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	storage, err := NewBoltStorage(path)
+	assert.NoError(t, err)
+	defer storage.Disconnect()
+
+	subscriber, err := storage.getSubscription(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"time", "date.day"}, subscriber.Keys)
+
+	records := storage.(*recordStorage).recordStore.(*boltRecords)
+	err = records.db.View(func(tx *bolt.Tx) error {
+		var document bson.M
+		err := bson.Unmarshal(tx.Bucket(boltSubscriptions).Get(id[:]), &document)
+		assert.NotContains(t, document, "recipient")
+		assert.NotContains(t, document, "recipientid")
+
+		key, _ := tx.Bucket(boltMigrations).Cursor().Last()
+		assert.EqualValues(
+			t,
+			migrations[len(migrations)-1].version,
+			binary.BigEndian.Uint64(key),
+		)
+
+		return err
+	})
+	assert.NoError(t, err)
+}
@@ -1,57 +1,108 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
-
-	karma "github.com/reconquest/karma-go"
+	"time"
 )
 
-var errorResponse = errors.New("not response from url")
+// FetchResult describes a single request to an endpoint.
+type FetchResult struct {
+	Data       map[string]interface{}
+	StatusCode int
+	Latency    time.Duration
+	BodySize   int
+
+	// CertExpiresAt is the earliest expiration time in the peer certificate
+	// chain, it is zero for plain http.
+	CertExpiresAt time.Time
+}
 
-func getJSON(url string) (
+func (fetcher *Fetcher) getJSON(ctx context.Context, url string, trusted bool) (
 	map[string]interface{},
 	error,
 ) {
-	var jsonData map[string]interface{}
-	var err error
-
-	_, err = http.Get(url)
+	result, err := fetcher.fetchJSON(ctx, url, trusted)
 	if err != nil {
-		return nil, errorResponse
+		return nil, err
 	}
 
+	return result.Data, nil
+}
+
+// fetchJSON requests url and decodes its body, the result is returned along
+// with the decoding error so status code and latency are still known.
+// Returned errors are one of fetch errors declared in fetcher.go.
+func (fetcher *Fetcher) fetchJSON(
+	ctx context.Context,
+	url string,
+	trusted bool,
+) (result *FetchResult, err error) {
+	defer func(started time.Time) {
+		observeFetch(fetcher.metricHosts.getLabel(url), started, err)
+	}(time.Now())
+
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return jsonData, karma.Format(
-			err,
-			"unable to get request to url",
-		)
+		return nil, &ConnectionError{err: err}
+	}
+
+	request.Header.Set("User-Agent", fetcher.config.UserAgent)
+	request.Header.Set("Accept", "application/json")
+
+	err = fetcher.checkProxiedURL(ctx, url, trusted)
+	if err != nil {
+		return nil, err
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(request)
+	started := time.Now()
+	resp, err := fetcher.client(trusted).Do(request.WithContext(ctx))
 	if err != nil {
-		return jsonData, karma.Format(
-			err,
-			"unable to send an http request",
-		)
+		return nil, classifyRequestError(err)
 	}
 
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&jsonData)
+
+	result = &FetchResult{
+		StatusCode: resp.StatusCode,
+	}
+
+	if resp.TLS != nil {
+		for _, certificate := range resp.TLS.PeerCertificates {
+			if result.CertExpiresAt.IsZero() ||
+				certificate.NotAfter.Before(result.CertExpiresAt) {
+				result.CertExpiresAt = certificate.NotAfter
+			}
+		}
+	}
+
+	// one more byte is read to tell a body of exactly max size from a
+	// larger one
+	body, err := ioutil.ReadAll(
+		io.LimitReader(resp.Body, fetcher.maxResponseSize+1),
+	)
+	result.Latency = time.Since(started)
+	result.BodySize = len(body)
+	if err != nil {
+		return result, classifyRequestError(err)
+	}
+
+	if int64(len(body)) > fetcher.maxResponseSize {
+		return result, &ResponseTooLargeError{Limit: fetcher.maxResponseSize}
+	}
+
+	err = json.Unmarshal(body, &result.Data)
 	if err != nil {
-		return jsonData, karma.Format(
-			err,
-			"unable to decode response body",
-		)
+		return result, &DecodeError{err: err}
 	}
 
-	return jsonData, nil
+	return result, nil
 }
 
 func getValueByKey(resource interface{}, keys []string) (interface{}, error) {
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+)
+
+// OutboxMessage is a notification which is waiting to be delivered to a chat.
+// Messages which were failed to be sent MaxAttempts times are marked as dead
+// and stay in the collection for investigation.
+type OutboxMessage struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	ChatID    int64              `bson:"chat_id"`
+	Text      string             `bson:"text"`
+	Attempts  int                `bson:"attempts"`
+	LastError string             `bson:"last_error"`
+	Dead      bool               `bson:"dead"`
+	SendAt    time.Time          `bson:"send_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// enqueueMessage schedules the message to be sent to the chat right away.
+func (coordinator *Coordinator) enqueueMessage(chatID int64, text string) error {
+	return coordinator.database.enqueueMessage(
+		chatID,
+		text,
+		coordinator.clock.Now(),
+	)
+}
+
+// holdBackOutboxMessages leaves out due messages which were enqueued after a
+// message to the same chat that is waiting for retry, so a chat receives
+// messages in the order they were enqueued. Both lists are sorted by id.
+func holdBackOutboxMessages(due, waiting []OutboxMessage) []OutboxMessage {
+	first := map[int64]primitive.ObjectID{}
+	for _, message := range waiting {
+		if _, ok := first[message.ChatID]; !ok {
+			first[message.ChatID] = message.ID
+		}
+	}
+
+	messages := []OutboxMessage{}
+	for _, message := range due {
+		id, ok := first[message.ChatID]
+		if ok && lessObjectID(id, message.ID) {
+			continue
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+func (database *Database) ensureOutboxIndexes() error {
+	_, err := database.Outbox.Indexes().CreateOne(
+		database.context,
+		mongo.IndexModel{
+			Keys: bsonx.Doc{
+				{Key: "dead", Value: bsonx.Int32(1)},
+				{Key: "send_at", Value: bsonx.Int32(1)},
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (database *Database) enqueueMessage(
+	chatID int64,
+	text string,
+	now time.Time,
+) error {
+	_, err := database.Outbox.InsertOne(
+		database.context,
+		OutboxMessage{
+			ChatID:    chatID,
+			Text:      text,
+			SendAt:    now,
+			CreatedAt: now,
+		},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to insert message into %s collection, chat_id: %d",
+			database.Outbox.Name(),
+			chatID,
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) findDueOutboxMessages(now time.Time) (
+	[]OutboxMessage,
+	error,
+) {
+	due, err := database.findOutboxMessages(bson.M{
+		"dead":    false,
+		"send_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	waiting, err := database.findOutboxMessages(bson.M{
+		"dead":    false,
+		"send_at": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return holdBackOutboxMessages(due, waiting), nil
+}
+
+func (database *Database) findOutboxMessages(filter bson.M) (
+	[]OutboxMessage,
+	error,
+) {
+	var messages []OutboxMessage
+	cursor, err := database.Outbox.Find(
+		database.context,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, karma.Format(
+			err,
+			"can't find data in %s collection",
+			database.Outbox.Name(),
+		)
+	}
+
+	err = cursor.All(database.context, &messages)
+	if err != nil {
+		return nil, karma.Format(
+			err,
+			"can't decode data from %s collection",
+			database.Outbox.Name(),
+		)
+	}
+
+	return messages, nil
+}
+
+func (database *Database) removeOutboxMessage(id primitive.ObjectID) error {
+	_, err := database.Outbox.DeleteOne(database.context, bson.M{"_id": id})
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to remove record in %s collection",
+			database.Outbox.Name(),
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) retryOutboxMessage(
+	message OutboxMessage,
+	sendAt time.Time,
+	reason error,
+) error {
+	_, err := database.Outbox.UpdateOne(
+		database.context,
+		bson.M{"_id": message.ID},
+		bson.M{"$set": bson.M{
+			"attempts":   message.Attempts,
+			"last_error": reason.Error(),
+			"send_at":    sendAt,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update record in %s collection",
+			database.Outbox.Name(),
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) buryOutboxMessage(
+	message OutboxMessage,
+	reason error,
+) error {
+	_, err := database.Outbox.UpdateOne(
+		database.context,
+		bson.M{"_id": message.ID},
+		bson.M{"$set": bson.M{
+			"attempts":   message.Attempts,
+			"last_error": reason.Error(),
+			"dead":       true,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update record in %s collection",
+			database.Outbox.Name(),
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) buryChatOutboxMessages(
+	chatID int64,
+	reason error,
+) error {
+	_, err := database.Outbox.UpdateMany(
+		database.context,
+		bson.M{
+			"chat_id": chatID,
+			"dead":    false,
+		},
+		bson.M{"$set": bson.M{
+			"last_error": reason.Error(),
+			"dead":       true,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update records in %s collection, chat_id: %d",
+			database.Outbox.Name(),
+			chatID,
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) migrateOutboxMessages(from, to int64) error {
+	_, err := database.Outbox.UpdateMany(
+		database.context,
+		bson.M{
+			"chat_id": from,
+			"dead":    false,
+		},
+		bson.M{"$set": bson.M{
+			"chat_id": to,
+		}},
+	)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to update records in %s collection, chat_id: %d",
+			database.Outbox.Name(),
+			from,
+		)
+	}
+
+	return nil
+}
+
+func (database *Database) countOutboxMessages() (int64, error) {
+	count, err := database.Outbox.CountDocuments(
+		database.context,
+		bson.M{"dead": false},
+	)
+	if err != nil {
+		return 0, karma.Format(
+			err,
+			"unable to count records in %s collection",
+			database.Outbox.Name(),
+		)
+	}
+
+	return count, nil
+}
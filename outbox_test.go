@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_KeepsOrderOfMessagesWhileRetrying(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.Outbox.MinBackoff.Duration = 5 * time.Second
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	tick := func(duration time.Duration) {
+		clock.Advance(duration)
+		assert.NoError(t, coordinator.routineSendOutbox())
+	}
+
+	assert.NoError(t, coordinator.enqueueMessage(2, "first"))
+	assert.NoError(t, coordinator.enqueueMessage(2, "second"))
+	assert.NoError(t, coordinator.enqueueMessage(3, "other"))
+
+	telegramBot.sendErrors = []error{errors.New("temporary failure")}
+
+	// the second message waits for the first one, other chats don't, the
+	// global interval between them is waited out on the fake clock
+	tick(0)
+	assert.Equal(t, []string{"other"}, telegramBot.allSentMessages)
+
+	tick(2 * time.Second)
+	assert.Equal(t, []string{"other"}, telegramBot.allSentMessages)
+
+	messages, err := coordinator.database.findDueOutboxMessages(clock.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	tick(4 * time.Second)
+	assert.Equal(t, []string{"other", "first"}, telegramBot.allSentMessages)
+
+	// the chat limit is exceeded until the next second
+	tick(2 * time.Second)
+	assert.Equal(
+		t,
+		[]string{"other", "first", "second"},
+		telegramBot.allSentMessages,
+	)
+
+	count, err := coordinator.database.countOutboxMessages()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+}
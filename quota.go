@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// number of chats shown to bot admins by /quota
+const quotaTopChats = 10
+
+// checkInterval rejects intervals which are out of the configured range.
+func (coordinator *Coordinator) checkInterval(interval time.Duration) error {
+	quota := coordinator.config.Quota
+
+	if interval < quota.MinInterval.Duration {
+		return newValidationError(
+			"interval must be at least %s",
+			quota.MinInterval.Duration,
+		)
+	}
+
+	if quota.MaxInterval.Duration > 0 && interval > quota.MaxInterval.Duration {
+		return newValidationError(
+			"interval must be at most %s",
+			quota.MaxInterval.Duration,
+		)
+	}
+
+	return nil
+}
+
+// checkSubscriptionsQuota rejects subscriptions which would exceed the
+// max number of subscriptions of their chats. Existing subscriptions are
+// updated instead of created, so they are not counted.
+func (coordinator *Coordinator) checkSubscriptionsQuota(
+	subscribers []Subscriber,
+) error {
+	limit := coordinator.config.Quota.MaxSubscriptions
+	if limit == 0 {
+		return nil
+	}
+
+	added := map[int]int{}
+	for _, subscriber := range subscribers {
+		if subscriber.Trusted {
+			continue
+		}
+
+		found, err := coordinator.database.findSubscriber(
+			subscriber.UserID,
+			subscriber.URL,
+		)
+		if err != nil {
+			return karma.Format(err, "unable to find subscription")
+		}
+
+		if found == nil {
+			added[subscriber.UserID]++
+		}
+	}
+
+	for userID, count := range added {
+		existing, err := coordinator.database.findChatSubscriptions(userID)
+		if err != nil {
+			return karma.Format(err, "unable to find subscriptions")
+		}
+
+		if len(existing)+count > limit {
+			return newValidationError(
+				"a chat can't have more than %d subscriptions",
+				limit,
+			)
+		}
+	}
+
+	return nil
+}
+
+// quota shows limits and usage of the chat, bot admins also see chats with
+// the most subscriptions.
+func (coordinator *Coordinator) quota(message *tb.Message) error {
+	quota := coordinator.config.Quota
+	locale := coordinator.getLocale(message)
+
+	subscribers, err := coordinator.database.findChatSubscriptions(
+		getRecipientID(message),
+	)
+	if err != nil {
+		return karma.Format(err, "unable to find subscriptions")
+	}
+
+	limit := locale.Translate("unlimited")
+	if quota.MaxSubscriptions > 0 {
+		limit = fmt.Sprint(quota.MaxSubscriptions)
+	}
+
+	maxInterval := locale.Translate("unlimited")
+	if quota.MaxInterval.Duration > 0 {
+		maxInterval = quota.MaxInterval.Duration.String()
+	}
+
+	text := []string{locale.Sprintf(
+		"SUBSCRIPTIONS - %d of %s\nMIN INTERVAL - %s\n"+
+			"MAX INTERVAL - %s\nMAX RESPONSE SIZE - %s bytes",
+		len(subscribers),
+		limit,
+		quota.MinInterval.Duration,
+		maxInterval,
+		locale.FormatNumber(float64(quota.MaxResponseSize)),
+	)}
+
+	if coordinator.isBotAdmin(message.Sender.ID) {
+		top, err := coordinator.getTopChats(quotaTopChats)
+		if err != nil {
+			return err
+		}
+
+		text = append(
+			text,
+			locale.Translate("TOP CHATS:")+"\n"+strings.Join(top, "\n"),
+		)
+	}
+
+	return coordinator.sendReply(message, strings.Join(text, "\n\n"))
+}
+
+func (coordinator *Coordinator) getTopChats(limit int) ([]string, error) {
+	subscribers, err := coordinator.database.listSubscriptions()
+	if err != nil {
+		return nil, karma.Format(err, "unable to list subscriptions")
+	}
+
+	counts := map[int64]int{}
+	for _, subscriber := range subscribers {
+		counts[getSubscriberChatID(subscriber)]++
+	}
+
+	var chats []int64
+	for chatID := range counts {
+		chats = append(chats, chatID)
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		if counts[chats[i]] != counts[chats[j]] {
+			return counts[chats[i]] > counts[chats[j]]
+		}
+
+		return chats[i] < chats[j]
+	})
+
+	if len(chats) > limit {
+		chats = chats[:limit]
+	}
+
+	var top []string
+	for _, chatID := range chats {
+		top = append(top, fmt.Sprintf("%d - %d", chatID, counts[chatID]))
+	}
+
+	return top, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createSubscription_ChecksQuota(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.Quota.MaxSubscriptions = 1
+	config.Quota.MinInterval.Duration = time.Minute
+	config.Quota.MaxInterval.Duration = time.Hour
+	config.Access.Admins = []int{9}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(writer, `{"value": 1}`)
+		},
+	))
+	defer server.Close()
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	err = coordinator.subscribe(createMessage(server.URL+"/a", "10s", "value", 1, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, "Sorry, interval must be at least 1m0s", telegramBot.lastSentMessage)
+
+	err = coordinator.subscribe(createMessage(server.URL+"/a", "2h", "value", 1, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, "Sorry, interval must be at most 1h0m0s", telegramBot.lastSentMessage)
+
+	err = coordinator.subscribe(createMessage(server.URL+"/a", "1m", "value", 1, 2))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(telegramBot.lastSentMessage, "You successfully subscribed!"))
+
+	err = coordinator.subscribe(createMessage(server.URL+"/b", "1m", "value", 1, 2))
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Sorry, a chat can't have more than 1 subscriptions",
+		telegramBot.lastSentMessage,
+	)
+
+	// updating the existing subscription doesn't count
+	err = coordinator.subscribe(createMessage(server.URL+"/a", "5m", "value", 1, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, "Duration was successfully updated", telegramBot.lastSentMessage)
+
+	// bot admins are not limited
+	err = coordinator.subscribe(createMessage(server.URL+"/b", "1s", "value", 9, 9))
+	assert.NoError(t, err)
+	err = coordinator.subscribe(createMessage(server.URL+"/c", "1s", "value", 9, 9))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(telegramBot.lastSentMessage, "You successfully subscribed!"))
+}
+
+func Test_Fetcher_LimitsResponseSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(writer, `{"value": "`+strings.Repeat("x", 100)+`"}`)
+		},
+	))
+	defer server.Close()
+
+	fetcher := NewFetcher(FetchConfig{AllowPrivate: true}, 50)
+
+	result, err := fetcher.fetchJSON(context.Background(), server.URL, false)
+	assert.EqualError(t, err, "response is larger than 50 bytes")
+	assert.Nil(t, result.Data)
+}
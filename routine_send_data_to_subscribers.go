@@ -2,31 +2,16 @@ package main
 
 import (
 	"fmt"
-	"reflect"
 	"strings"
-	"time"
 
-	"github.com/reconquest/notify-telegram-bot/internal/printer"
-
-	"github.com/globalsign/mgo/bson"
 	karma "github.com/reconquest/karma-go"
 	"github.com/reconquest/pkg/log"
 )
 
 func (coordinator *Coordinator) routineSendDataToSubscribers() error {
-	var subscribers []Subscriber
-
-	cursor, err := coordinator.database.Subscriptions.Find(
-		coordinator.database.context,
-		bson.M{"send_at": bson.M{"$lt": time.Now()}},
-	)
+	subscribers, err := coordinator.database.findDueSubscriptions(coordinator.clock.Now())
 	if err != nil {
-		return karma.Format(err, "unable to find subscription data")
-	}
-
-	err = cursor.All(coordinator.database.context, &subscribers)
-	if err != nil {
-		return karma.Format(err, "unable to decode mongodb data")
+		return karma.Format(err, "unable to find due subscriptions")
 	}
 
 	for _, subscriber := range subscribers {
@@ -60,41 +45,59 @@ func (coordinator *Coordinator) sendDataToSubscriber(subscriber Subscriber) erro
 		subscriber.RecipientID = subscriber.Sender.ID
 	}
 
-	endpointFilter := bson.M{
-		"url":      subscriber.URL,
-		"duration": subscriber.Duration,
-	}
-	cursor, err := coordinator.database.Endpoints.Find(
-		coordinator.database.context,
-		endpointFilter,
-	)
-	if err != nil {
-		return karma.Format(err, "unable to find subscription data")
-	}
-
-	var endpoints []Endpoint
-	err = cursor.All(coordinator.database.context, &endpoints)
+	found, err := coordinator.database.findSubscriberEndpoint(subscriber)
 	if err != nil {
-		return karma.Format(err, "unable to decode data from database")
+		return karma.Format(err, "unable to find subscription endpoint")
 	}
 
-	if len(endpoints) == 0 {
+	if found == nil {
 		return fmt.Errorf(
 			"endpoints is empty, "+
 				"url = %s; duration = %s",
 			subscriber.URL, subscriber.Duration)
 	}
 
-	// send message if not response by url
-	if endpoints[0].Response == false {
+	endpoint := *found
+
+	err = coordinator.checkCertificateExpiry(subscriber, endpoint)
+	if err != nil {
+		return karma.Format(err, "unable to check certificate expiry")
+	}
+
+	if subscriber.Kind == SubscriptionUptime {
+		return coordinator.sendUptimeToSubscriber(subscriber, endpoint)
+	}
+
+	switch {
+	case coordinator.isEndpointDown(endpoint) && !subscriber.Alerted:
 		err := coordinator.sendMessageAboutUnavailableURL(
 			subscriber,
+			endpoint,
 		)
 		if err != nil {
 			return karma.Format(err, "unable to send message")
 		}
 
-		err = coordinator.database.updateSubscriber(subscriber)
+		err = coordinator.database.setSubscriberAlerted(subscriber.ID, true)
+		if err != nil {
+			return karma.Format(err, "unable to update subscriber data in database")
+		}
+
+	case endpoint.Failures == 0 && subscriber.Alerted:
+		err := coordinator.sendMessageAboutRecoveredURL(subscriber, endpoint)
+		if err != nil {
+			return karma.Format(err, "unable to send message")
+		}
+
+		err = coordinator.database.setSubscriberAlerted(subscriber.ID, false)
+		if err != nil {
+			return karma.Format(err, "unable to update subscriber data in database")
+		}
+	}
+
+	// nothing to compare until url responds with data
+	if endpoint.Response == false {
+		err = coordinator.updateSubscriber(subscriber)
 		if err != nil {
 			return karma.Format(err, "unable to update subscriber data in database")
 		}
@@ -108,33 +111,38 @@ func (coordinator *Coordinator) sendDataToSubscriber(subscriber Subscriber) erro
 		return nil
 	}
 
-	keys := strings.Split(subscriber.Keys, ",")
+	keys := subscriber.Keys
 
 	// default case
 	messageWithData := coordinator.prepareMessageForSubscriber(
 		keys,
-		endpoints,
+		endpoint,
 		subscriber,
 	)
 
 	if messageWithData == nil {
-		return nil
+		return coordinator.rememberNotifiedValues(subscriber, endpoint)
 	}
 
-	err = coordinator.transport.SendMessage(
-		subscriber.Recipient,
+	err = coordinator.enqueueMessage(
+		int64(subscriber.RecipientID),
 		strings.Join(
 			messageWithData, "\n\n"),
 	)
 	if err != nil {
 		return karma.Format(
 			err,
-			"unable to send message to user: %d",
-			subscriber.Recipient,
+			"unable to enqueue message to user: %d",
+			subscriber.RecipientID,
 		)
 	}
 
-	err = coordinator.database.updateSubscriber(subscriber)
+	err = coordinator.rememberNotifiedValues(subscriber, endpoint)
+	if err != nil {
+		return err
+	}
+
+	err = coordinator.updateSubscriber(subscriber)
 	if err != nil {
 		return karma.Format(err, "unable to update subscriber data in the database")
 	}
@@ -142,7 +150,7 @@ func (coordinator *Coordinator) sendDataToSubscriber(subscriber Subscriber) erro
 	err = coordinator.database.updateSubscriberStatus(
 		subscriber.UserID,
 		subscriber.URL,
-		endpoints[0].UpdatedAt,
+		endpoint.UpdatedAt,
 	)
 	if err != nil {
 		return karma.Format(err, "unable to update subscriber status in database")
@@ -151,35 +159,54 @@ func (coordinator *Coordinator) sendDataToSubscriber(subscriber Subscriber) erro
 	return nil
 }
 
+// updateSubscriber schedules the next notification of the subscriber.
+func (coordinator *Coordinator) updateSubscriber(subscriber Subscriber) error {
+	return coordinator.database.updateSubscriber(
+		subscriber.ID,
+		coordinator.clock.Now().Add(subscriber.Duration),
+	)
+}
+
 func (coordinator *Coordinator) prepareMessageForSubscriber(
 	keys []string,
-	endpoints []Endpoint,
+	endpoint Endpoint,
 	subscriber Subscriber,
 ) []string {
+	printer := coordinator.newPrinter(
+		coordinator.getSubscriberLocale(subscriber),
+	)
+
 	var messageWithData []string
 	var notification string
 	isAddedID := false
+	changes := map[string]interface{}{}
 	for _, key := range keys {
 		nestedKey := strings.Split(key, ".")
-		updatedData, err := getValueByKey(endpoints[0].Data, nestedKey)
+		updatedData, err := getValueByKey(endpoint.Data, nestedKey)
 		if err != nil {
 			log.Errorf(nil, "unable to get data by key, key = %s", nestedKey)
 		}
 
-		previousData, err := getValueByKey(endpoints[0].PreviousData, nestedKey)
+		previousData, err := getValueByKey(endpoint.PreviousData, nestedKey)
 		if err != nil {
 			log.Errorf(nil, "unable to get data by key, key = %s", nestedKey)
 		}
 
-		if previousData == nil || endpoints[0].UpdatedAt == subscriber.UpdatedAt {
+		if previousData == nil || endpoint.UpdatedAt == subscriber.UpdatedAt {
 			return nil
 		}
 
-		if reflect.DeepEqual(updatedData, previousData) ||
-			updatedData == nil {
+		if updatedData == nil || subscriber.Filters.IsIgnored(key) ||
+			subscriber.Filters.Equal(
+				key,
+				updatedData,
+				subscriber.getBaseline(key, previousData),
+			) {
 			continue
 		}
 
+		changes[key] = updatedData
+
 		preparedMessage := printer.String(updatedData)
 
 		if isAddedID == false {
@@ -199,14 +226,30 @@ func (coordinator *Coordinator) prepareMessageForSubscriber(
 		messageWithData = append(messageWithData, notification)
 	}
 
+	if subscriber.Template != "" && len(changes) > 0 {
+		text, err := renderTemplate(subscriber, endpoint, changes)
+		if err == nil {
+			return []string{text}
+		}
+
+		log.Errorf(err, "unable to render template of subscription: %s", subscriber.ID.Hex())
+	}
+
 	return messageWithData
 }
 
 func (coordinator *Coordinator) sendMessageAboutUnavailableURL(
 	subscriber Subscriber,
+	endpoint Endpoint,
 ) error {
+	locale := coordinator.getSubscriberLocale(subscriber)
+
 	var text []string
-	message := "URL is unavailable!"
+	message := locale.Translate("URL is unavailable!")
+	if endpoint.CertError != "" {
+		message = locale.Translate("TLS certificate is invalid!")
+	}
+
 	text = append(text, fmt.Sprintf(
 		"\nID - %s\nURL - %s\n\n%s",
 		subscriber.ID.Hex(),
@@ -214,16 +257,20 @@ func (coordinator *Coordinator) sendMessageAboutUnavailableURL(
 		message,
 	))
 
-	err := coordinator.transport.SendMessage(
-		subscriber.Recipient,
+	if endpoint.LastError != "" {
+		text = append(text, locale.Sprintf("Reason: %s", endpoint.LastError))
+	}
+
+	err := coordinator.enqueueMessage(
+		int64(subscriber.RecipientID),
 		strings.Join(
 			text, "\n\n"),
 	)
 	if err != nil {
 		return karma.Format(
 			err,
-			"unable to send message to user: %d",
-			subscriber.Recipient,
+			"unable to enqueue message to user: %d",
+			subscriber.RecipientID,
 		)
 	}
 
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"time"
+
+	"github.com/reconquest/notify-telegram-bot/internal/transport"
+
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+)
+
+func (coordinator *Coordinator) routineSendOutbox() error {
+	messages, err := coordinator.database.findDueOutboxMessages(coordinator.clock.Now())
+	if err != nil {
+		return karma.Format(err, "unable to find outbox messages")
+	}
+
+	// chats whose message wasn't sent on this iteration, their later
+	// messages wait so they aren't delivered out of order
+	held := map[int64]bool{}
+
+	for _, message := range messages {
+		if held[message.ChatID] {
+			continue
+		}
+
+		if !coordinator.waitForLimiter(message.ChatID) {
+			held[message.ChatID] = true
+			continue
+		}
+
+		sent, err := coordinator.sendOutboxMessage(message)
+		if err != nil {
+			log.Errorf(
+				err,
+				"unable to process outbox message: %s",
+				message.ID.Hex(),
+			)
+		}
+
+		if !sent {
+			held[message.ChatID] = true
+		}
+	}
+
+	depth, err := coordinator.database.countOutboxMessages()
+	if err != nil {
+		return karma.Format(err, "unable to count outbox messages")
+	}
+
+	metricOutboxDepth.Set(float64(depth))
+
+	return nil
+}
+
+// waitForLimiter blocks while the global rate limit is exceeded and returns
+// false if the chat limit is exceeded, such messages are left for the next
+// iteration so other chats are not blocked by a single busy one.
+func (coordinator *Coordinator) waitForLimiter(chatID int64) bool {
+	for {
+		delay := coordinator.limiter.Delay(chatID, coordinator.clock.Now())
+		if delay == 0 {
+			return true
+		}
+
+		if delay > coordinator.config.Outbox.GlobalInterval.Duration {
+			return false
+		}
+
+		coordinator.clock.Sleep(delay)
+	}
+}
+
+// sendOutboxMessage sends the message and tells whether it was delivered,
+// otherwise it's scheduled for retry, buried or moved to a migrated chat.
+func (coordinator *Coordinator) sendOutboxMessage(
+	message OutboxMessage,
+) (bool, error) {
+	err := coordinator.transport.SendMessage(
+		transport.ChatID(message.ChatID),
+		message.Text,
+	)
+	if err == nil {
+		metricNotificationsSent.WithLabelValues(transportTelegram).Inc()
+
+		return true, coordinator.database.removeOutboxMessage(message.ID)
+	}
+
+	metricNotificationsFailed.WithLabelValues(transportTelegram).Inc()
+
+	if chatID := transport.MigratedTo(err); chatID != 0 {
+		// the message is moved along with other messages of the chat and
+		// will be sent to the new chat on the next iteration
+		return false, coordinator.migrateChat(message.ChatID, chatID)
+	}
+
+	if transport.IsUnreachable(err) {
+		return false, coordinator.disableChat(message.ChatID, err)
+	}
+
+	message.Attempts++
+
+	if message.Attempts >= coordinator.config.Outbox.MaxAttempts {
+		log.Errorf(
+			err,
+			"giving up on outbox message %s after %d attempts, chat_id: %d",
+			message.ID.Hex(),
+			message.Attempts,
+			message.ChatID,
+		)
+
+		return false, coordinator.database.buryOutboxMessage(message, err)
+	}
+
+	delay := transport.RetryAfter(err)
+	if delay == 0 {
+		delay = coordinator.getOutboxBackoff(message.Attempts)
+	}
+
+	log.Debugf(
+		nil,
+		"unable to send outbox message %s, retrying in %s: %s",
+		message.ID.Hex(),
+		delay,
+		err,
+	)
+
+	return false, coordinator.database.retryOutboxMessage(
+		message,
+		coordinator.clock.Now().Add(delay),
+		err,
+	)
+}
+
+func (coordinator *Coordinator) getOutboxBackoff(attempts int) time.Duration {
+	delay := coordinator.config.Outbox.MinBackoff.Duration
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= coordinator.config.Outbox.MaxBackoff.Duration {
+			return coordinator.config.Outbox.MaxBackoff.Duration
+		}
+	}
+
+	return delay
+}
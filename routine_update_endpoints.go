@@ -6,24 +6,18 @@ import (
 
 	karma "github.com/reconquest/karma-go"
 	"github.com/reconquest/pkg/log"
-	"go.mongodb.org/mongo-driver/bson"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
 func (coordinator *Coordinator) routineUpdateEndpoints() error {
-	var endpoints []Endpoint
-	filter := bson.M{"refresh_at": bson.M{"$lt": time.Now()}}
-
-	cursor, err := coordinator.database.Endpoints.Find(coordinator.database.context, filter)
+	endpoints, err := coordinator.database.findDueEndpoints(coordinator.clock.Now())
 	if err != nil {
-		return karma.Format(err, "unable to find in endpoints collection")
+		return karma.Format(err, "unable to find due endpoints")
 	}
 
-	err = cursor.All(coordinator.database.context, &endpoints)
-	if err != nil {
-		return karma.Format(err, "unable to decode mongodb data")
-	}
+	metricEndpointsDue.Set(float64(len(endpoints)))
 
+	refreshed := 0
 	for _, endpoint := range endpoints {
 		err := coordinator.updateEndpoint(endpoint)
 
@@ -32,9 +26,15 @@ func (coordinator *Coordinator) routineUpdateEndpoints() error {
 				err,
 				"unable to update endpoint data endpoint_id: %s", endpoint.ID.Hex(),
 			)
+
+			continue
 		}
+
+		refreshed++
 	}
 
+	metricEndpointsRefreshed.Set(float64(refreshed))
+
 	return nil
 }
 
@@ -44,53 +44,79 @@ func (coordinator *Coordinator) updateEndpoint(endpoint Endpoint) error {
 		"start endpoint %v data refresh\n",
 		endpoint.ID,
 	)
-	data, err := getJSON(endpoint.URL)
-	if err != nil {
-		if err == errorResponse && endpoint.Response == true {
-			err = coordinator.updateEndpointResponseFiled(endpoint)
-			if err != nil {
-				return karma.Format(err, "unable to update endpoint in the database")
-			}
+	result, err := coordinator.fetcher.fetchJSON(
+		coordinator.context,
+		endpoint.URL,
+		endpoint.Trusted,
+	)
 
-			return nil
-		}
+	checkErr := coordinator.database.writeCheck(endpoint, result, coordinator.clock.Now())
+	if checkErr != nil {
+		log.Errorf(checkErr, "unable to write check of url: %s", endpoint.URL)
+	}
 
-		if err == errorResponse && endpoint.Response == false {
-			err = coordinator.updateEndpointRefreshAtField(endpoint)
-			if err != nil {
-				return karma.Format(err, "unable to update endpoint in the database")
-			}
+	if err != nil {
+		return coordinator.updateEndpointFailure(endpoint, result, err)
+	}
 
-			return nil
-		}
+	if result.Data == nil {
+		return coordinator.updateEndpointFailure(
+			endpoint,
+			result,
+			&DecodeError{err: errors.New("json data is empty")},
+		)
+	}
 
-		return karma.Format(
-			err,
-			"unable to get json from url = %s ",
-			endpoint.URL,
+	if coordinator.config.Health.AlertOnStatus && !isSuccessStatus(result) {
+		return coordinator.updateEndpointFailure(
+			endpoint,
+			result,
+			&StatusError{StatusCode: result.StatusCode},
 		)
 	}
 
-	if data == nil {
-		return errors.New("json data is empty")
+	return coordinator.updateEndpointData(endpoint, result)
+}
+
+// updateEndpointData stores new data of the endpoint and moves the current
+// data to previous, it's used for both polled and pushed data.
+func (coordinator *Coordinator) updateEndpointData(
+	endpoint Endpoint,
+	result *FetchResult,
+) error {
+	now := coordinator.clock.Now()
+	previous := endpoint.Data
+	refreshAt := endpoint.RefreshAt
+
+	setFetchFields(&endpoint, result, nil)
+	endpoint.RefreshAt = now.Add(endpoint.Duration)
+	endpoint.Data = result.Data
+	endpoint.PreviousData = previous
+	endpoint.Response = true
+	endpoint.UpdatedAt = now
+
+	// slow response still carries valid data, but counts as a failure
+	slow := coordinator.checkEndpointLatency(result)
+	if slow != nil {
+		endpoint.LastError = slow.Error()
+		if endpoint.FailingSince.IsZero() {
+			endpoint.FailingSince = now
+		}
+
+		endpoint.Failures++
+	} else {
+		if !endpoint.FailingSince.IsZero() {
+			endpoint.LastDowntime = now.Sub(endpoint.FailingSince)
+		}
+
+		endpoint.Failures = 0
+		endpoint.LastError = ""
+		endpoint.FailingSince = time.Time{}
 	}
 
-	duration := endpoint.Duration
-	filter := bson.M{"_id": bson.M{"$eq": endpoint.ID}}
-	update := bson.M{"$set": bson.M{
-		"refresh_at":    time.Now().Add(duration),
-		"data":          data,
-		"previous_data": endpoint.Data,
-		"response":      true,
-		"updated_at":    time.Now(),
-	}}
-	_, err = coordinator.database.Endpoints.UpdateOne(
-		coordinator.database.context,
-		filter,
-		update,
-	)
+	err := coordinator.database.saveEndpointFetch(endpoint, refreshAt)
 	if err != nil {
-		return karma.Format(err, "unable to update mongo")
+		return karma.Format(err, "unable to save endpoint")
 	}
 
 	log.Debugf(
@@ -110,56 +136,59 @@ func validateIsChatID(message *tb.Message) int {
 	return 0
 }
 
-func (coordinator *Coordinator) updateEndpointResponseFiled(
+func (coordinator *Coordinator) updateEndpointFailure(
 	endpoint Endpoint,
+	result *FetchResult,
+	reason error,
 ) error {
-	filter := bson.M{"_id": bson.M{"$eq": endpoint.ID}}
-	update := bson.M{"$set": bson.M{
-		"refresh_at": time.Now().Add(endpoint.Duration),
-		"response":   false,
-	}}
-
-	_, err := coordinator.database.Endpoints.UpdateOne(
-		coordinator.database.context,
-		filter,
-		update,
-	)
+	now := coordinator.clock.Now()
+	refreshAt := endpoint.RefreshAt
+
+	setFetchFields(&endpoint, result, reason)
+	endpoint.RefreshAt = now.Add(endpoint.Duration)
+	endpoint.Response = false
+	endpoint.LastError = reason.Error()
+	endpoint.Failures++
+
+	if endpoint.FailingSince.IsZero() {
+		endpoint.FailingSince = now
+	}
+
+	err := coordinator.database.saveEndpointFetch(endpoint, refreshAt)
 	if err != nil {
-		return karma.Format(err, "unable to update mongo")
+		return karma.Format(err, "unable to save endpoint")
 	}
 
 	log.Debugf(
 		nil,
-		"url is unavailable, url: %s, endpoint: %v ",
+		"url is unavailable, url: %s, endpoint: %v, failures: %d: %s",
 		endpoint.URL,
 		endpoint.ID,
+		endpoint.Failures,
+		reason,
 	)
 	return nil
 }
 
-func (coordinator *Coordinator) updateEndpointRefreshAtField(
-	endpoint Endpoint,
-) error {
-	filter := bson.M{"_id": bson.M{"$eq": endpoint.ID}}
-	update := bson.M{"$set": bson.M{
-		"refresh_at": time.Now().Add(endpoint.Duration),
-		"response":   false,
-	}}
-
-	_, err := coordinator.database.Endpoints.UpdateOne(
-		coordinator.database.context,
-		filter,
-		update,
-	)
-	if err != nil {
-		return karma.Format(err, "unable to update mongo")
+// setFetchFields sets endpoint fields which describe the request itself
+// regardless of the data it returned. The last known certificate expiry is
+// kept if the url didn't respond, so a short outage doesn't look like a
+// renewed certificate.
+func setFetchFields(endpoint *Endpoint, result *FetchResult, reason error) {
+	endpoint.Up = isUp(result)
+	endpoint.StatusCode = 0
+	endpoint.Latency = 0
+	endpoint.BodySize = 0
+	endpoint.CertError = ""
+
+	if result != nil {
+		endpoint.StatusCode = result.StatusCode
+		endpoint.Latency = result.Latency
+		endpoint.BodySize = result.BodySize
+		endpoint.CertExpiresAt = result.CertExpiresAt
 	}
 
-	log.Debugf(
-		nil,
-		"url is unavailable, url: %s, endpoint: %v ",
-		endpoint.URL,
-		endpoint.ID,
-	)
-	return nil
+	if _, ok := reason.(*CertificateError); ok {
+		endpoint.CertError = reason.Error()
+	}
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// Routine is a background loop of the bot, it remembers the time of the last
+// successful iteration so a stalled loop can be detected by /healthz.
+type Routine struct {
+	name     string
+	interval time.Duration
+	fn       func() error
+
+	mutex       sync.RWMutex
+	lastSuccess time.Time
+	lastError   error
+
+	done chan struct{}
+}
+
+// run calls fn every interval until stop is closed, the current iteration
+// is always finished.
+func (routine *Routine) run(stop chan struct{}) {
+	defer close(routine.done)
+
+	log.Infof(nil, "start cycle with %s", routine.name)
+	for {
+		err := routine.fn()
+		if err != nil {
+			log.Error(err)
+		}
+
+		routine.mutex.Lock()
+		routine.lastError = err
+		if err == nil {
+			routine.lastSuccess = time.Now()
+		}
+		routine.mutex.Unlock()
+
+		select {
+		case <-stop:
+			log.Infof(nil, "stop cycle with %s", routine.name)
+			return
+		case <-time.After(routine.interval):
+		}
+	}
+}
+
+// LastSuccess returns the time of the last successful iteration and the
+// error of the last iteration.
+func (routine *Routine) LastSuccess() (time.Time, error) {
+	routine.mutex.RLock()
+	defer routine.mutex.RUnlock()
+
+	return routine.lastSuccess, routine.lastError
+}
+
+func (coordinator *Coordinator) startRoutine(
+	name string,
+	interval time.Duration,
+	fn func() error,
+) {
+	routine := &Routine{
+		name:     name,
+		interval: interval,
+		fn:       fn,
+		done:     make(chan struct{}),
+	}
+
+	coordinator.routines = append(coordinator.routines, routine)
+
+	go routine.run(coordinator.stopping)
+}
+
+// stopRoutines asks background loops to stop and waits until they finish
+// their current iterations.
+func (coordinator *Coordinator) stopRoutines() {
+	close(coordinator.stopping)
+
+	for _, routine := range coordinator.routines {
+		<-routine.done
+	}
+}
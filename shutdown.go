@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+)
+
+// shutdown stops accepting new work and waits for the work in progress,
+// cancel is called when timeout is exceeded to abandon in-flight requests.
+func (coordinator *Coordinator) shutdown(
+	timeout time.Duration,
+	cancel context.CancelFunc,
+) error {
+	deadline := time.AfterFunc(timeout, func() {
+		log.Warningf(nil, "shutdown timeout %s exceeded, canceling work", timeout)
+		cancel()
+	})
+	defer deadline.Stop()
+
+	if coordinator.server != nil {
+		log.Infof(nil, "stopping http server")
+		err := coordinator.server.Shutdown(coordinator.context)
+		if err != nil {
+			log.Errorf(err, "unable to stop http server")
+		}
+	}
+
+	if coordinator.handlers != nil {
+		log.Infof(nil, "waiting for telegram handlers")
+		coordinator.waitHandlers()
+	}
+
+	log.Infof(nil, "waiting for background loops")
+	coordinator.stopRoutines()
+
+	log.Infof(nil, "draining outbox")
+	err := coordinator.drainOutbox()
+	if err != nil {
+		return karma.Format(err, "unable to drain outbox")
+	}
+
+	return nil
+}
+
+// waitHandlers waits for handlers of already received updates, so a command
+// isn't cut off by disconnecting from the database, handlers which are still
+// running when the context is canceled are abandoned.
+func (coordinator *Coordinator) waitHandlers() {
+	done := make(chan struct{})
+	go func() {
+		coordinator.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-coordinator.context.Done():
+		log.Warningf(nil, "abandoning telegram handlers which are still running")
+	}
+}
+
+// drainOutbox sends messages which are already due, messages scheduled for
+// retry stay in the database and are sent after restart.
+func (coordinator *Coordinator) drainOutbox() error {
+	for {
+		select {
+		case <-coordinator.context.Done():
+			return coordinator.context.Err()
+		default:
+		}
+
+		messages, err := coordinator.database.findDueOutboxMessages(coordinator.clock.Now())
+		if err != nil {
+			return err
+		}
+
+		if len(messages) == 0 {
+			return nil
+		}
+
+		err = coordinator.routineSendOutbox()
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+}
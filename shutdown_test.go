@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_ShutdownDrainsOutboxAndStopsRoutines(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	coordinator.context = ctx
+
+	var iterations int32
+	coordinator.startRoutine("counting", 10*time.Millisecond, func() error {
+		atomic.AddInt32(&iterations, 1)
+		return nil
+	})
+
+	// a command which is still being processed replies after polling is
+	// stopped
+	var handlers sync.WaitGroup
+	handlers.Add(1)
+	go func() {
+		defer handlers.Done()
+
+		time.Sleep(100 * time.Millisecond)
+
+		assert.NoError(t, coordinator.enqueueMessage(2, "subscribed"))
+	}()
+
+	coordinator.handlers = &handlers
+
+	assert.NoError(t, coordinator.enqueueMessage(2, "queued"))
+
+	started := time.Now()
+
+	err = coordinator.shutdown(5*time.Second, cancel)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(started) < 5*time.Second)
+
+	assert.Equal(t, []string{"queued", "subscribed"}, telegramBot.allSentMessages)
+
+	count, err := coordinator.database.countOutboxMessages()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+
+	stopped := atomic.LoadInt32(&iterations)
+	assert.True(t, stopped > 0)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&iterations))
+}
+
+func Test_Coordinator_ShutdownGivesUpAfterTimeout(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	coordinator := NewCoordinator(NewTestBot(), NewMemoryStorage(), config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	coordinator.context = ctx
+
+	coordinator.startRoutine("idle", 10*time.Millisecond, func() error {
+		return nil
+	})
+
+	// the handler never returns
+	var handlers sync.WaitGroup
+	handlers.Add(1)
+	defer handlers.Done()
+
+	coordinator.handlers = &handlers
+
+	started := time.Now()
+
+	err = coordinator.shutdown(200*time.Millisecond, cancel)
+	assert.Error(t, err)
+	assert.True(t, time.Since(started) < time.Second)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	StorageMongoDB = "mongodb"
+	StorageBolt    = "bolt"
+)
+
+// Storage keeps endpoints, subscriptions, outbox messages and checks, it
+// covers every operation the coordinator needs so backends can be swapped
+// without touching routines and command handlers. Storage never reads the
+// current time, it's passed by the coordinator which owns the clock.
+type Storage interface {
+	writeEndpoint(endpoint *Endpoint) error
+	getEndpoint(id primitive.ObjectID) (*Endpoint, error)
+	findEndpoint(url string) (*Endpoint, error)
+	findSubscriberEndpoint(subscriber Subscriber) (*Endpoint, error)
+	findDueEndpoints(now time.Time) ([]Endpoint, error)
+	listEndpoints() ([]Endpoint, error)
+	// saveEndpointFetch stores only fields written by fetches and keeps
+	// refresh_at if it's no longer refreshAt
+	saveEndpointFetch(endpoint Endpoint, refreshAt time.Time) error
+	trustEndpoint(url string, duration time.Duration) error
+	refreshEndpoint(id primitive.ObjectID, now time.Time) (int64, error)
+	refreshAllEndpoints(now time.Time) (int64, error)
+	RemoveEndpoint(id primitive.ObjectID) error
+	removeEndpointsByURL(url string) error
+
+	upsertSubscriber(subscriber Subscriber) error
+	updateSubscriber(id primitive.ObjectID, sendAt time.Time) error
+	updateSubscriberStatus(userID int, url string, updatedAt time.Time) error
+	setSubscriberAlerted(id primitive.ObjectID, alerted bool) error
+	setSubscriberPaused(id primitive.ObjectID, paused bool) error
+	setSubscriberState(id primitive.ObjectID, state string, statusCode int) error
+	setSubscriberCertWarned(id primitive.ObjectID, days int) error
+	setSubscriberManaged(id primitive.ObjectID, template string) error
+	setSubscriberFilters(id primitive.ObjectID, filters Filters) error
+	setSubscriberNotified(id primitive.ObjectID, values []NotifiedValue) error
+	getSubscription(id primitive.ObjectID) (*Subscriber, error)
+	findSubscriber(userID int, url string) (*Subscriber, error)
+	findChatSubscriptions(userID int) ([]Subscriber, error)
+	hasOtherChatsSubscriptions(userID int) (bool, error)
+	findDueSubscriptions(now time.Time) ([]Subscriber, error)
+	// findActiveURLSubscriptions skips paused and disabled subscriptions
+	findActiveURLSubscriptions(url string) ([]Subscriber, error)
+	listSubscriptions() ([]Subscriber, error)
+	RemoveSubscription(id primitive.ObjectID) error
+	// removeChatSubscriptions keeps subscriptions managed by config
+	removeChatSubscriptions(userID int) error
+	removeEndpointSubscriptions(endpoint Endpoint) error
+	disableSubscriptions(chatID int64, reason string) error
+	enableSubscriptions(chatID int64) error
+	migrateSubscriptions(from, to int64) error
+
+	enqueueMessage(chatID int64, text string, now time.Time) error
+	findDueOutboxMessages(now time.Time) ([]OutboxMessage, error)
+	removeOutboxMessage(id primitive.ObjectID) error
+	retryOutboxMessage(message OutboxMessage, sendAt time.Time, reason error) error
+	buryOutboxMessage(message OutboxMessage, reason error) error
+	buryChatOutboxMessages(chatID int64, reason error) error
+	migrateOutboxMessages(from, to int64) error
+	countOutboxMessages() (int64, error)
+
+	getChatSettings(chatID int64) (*ChatSettings, error)
+	setChatLanguage(chatID int64, language string) error
+	setChatTimezone(chatID int64, timezone string) error
+	migrateChatSettings(from, to int64) error
+
+	writeCheck(endpoint Endpoint, result *FetchResult, checkedAt time.Time) error
+	countChecks(url string, since time.Time) (int64, int64, error)
+
+	Ping(ctx context.Context) error
+	Disconnect() error
+	Drop() error
+}
+
+// OpenStorage connects to the backend chosen in config.
+func OpenStorage(config *Config, ctx context.Context) (Storage, error) {
+	switch config.Storage {
+	case StorageMongoDB:
+		return NewDatabase(config.DatabaseURI, config.DatabaseName, ctx)
+	case StorageBolt:
+		return NewBoltStorage(config.StoragePath)
+	default:
+		return nil, fmt.Errorf("unknown storage: %q", config.Storage)
+	}
+}
@@ -0,0 +1,687 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	boltEndpoints     = []byte("endpoints")
+	boltSubscriptions = []byte("subscriptions")
+	boltOutbox        = []byte("outbox")
+	boltChecks        = []byte("checks")
+	boltChats         = []byte("chats")
+	boltMigrations    = []byte("migrations")
+)
+
+// boltRecords keeps everything in a single embedded database file, it's
+// meant for small installations which don't want to run MongoDB. Records
+// are encoded as BSON, so they look the same as in MongoDB, and are keyed
+// by their identifiers.
+type boltRecords struct {
+	path string
+	db   *bolt.DB
+}
+
+func NewBoltStorage(path string) (Storage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, karma.Format(
+			err,
+			"unable to open database file %s",
+			path,
+		)
+	}
+
+	records := &boltRecords{
+		path: path,
+		db:   db,
+	}
+
+	err = records.ensureBuckets()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = records.migrate()
+	if err != nil {
+		db.Close()
+		return nil, karma.Format(err, "unable to migrate database file")
+	}
+
+	return &recordStorage{records}, nil
+}
+
+func (records *boltRecords) ensureBuckets() error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			boltEndpoints,
+			boltSubscriptions,
+			boltOutbox,
+			boltChecks,
+			boltChats,
+			boltMigrations,
+		} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return karma.Format(err, "unable to create bucket %s", name)
+			}
+		}
+
+		return nil
+	})
+}
+
+// migrate applies pending migrations, every migration is applied and
+// recorded in a single transaction.
+func (records *boltRecords) migrate() error {
+	var version int
+	err := records.db.View(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket(boltMigrations).Cursor().Last()
+		if key != nil {
+			version = int(binary.BigEndian.Uint64(key))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range getPendingMigrations(version) {
+		log.Infof(
+			nil,
+			"applying migration %d: %s",
+			migration.version,
+			migration.name,
+		)
+
+		err := records.db.Update(func(tx *bolt.Tx) error {
+			return applyBoltMigration(tx, migration)
+		})
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to apply migration %d",
+				migration.version,
+			)
+		}
+	}
+
+	return nil
+}
+
+func applyBoltMigration(tx *bolt.Tx, migration migration) error {
+	bucket := tx.Bucket([]byte(migration.collection))
+
+	changed := map[string][]byte{}
+	err := bucket.ForEach(func(key, value []byte) error {
+		var document bson.M
+		err := bson.Unmarshal(value, &document)
+		if err != nil {
+			return karma.Format(err, "unable to decode record %x", key)
+		}
+
+		if !migration.migrate(document) {
+			return nil
+		}
+
+		data, err := bson.Marshal(document)
+		if err != nil {
+			return karma.Format(err, "unable to encode record %x", key)
+		}
+
+		changed[string(key)] = data
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, data := range changed {
+		err := bucket.Put([]byte(key), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := bson.Marshal(appliedMigration{
+		Version:   migration.version,
+		Name:      migration.name,
+		AppliedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(migration.version))
+
+	return tx.Bucket(boltMigrations).Put(key, data)
+}
+
+func putBoltRecord(
+	tx *bolt.Tx,
+	bucket []byte,
+	id primitive.ObjectID,
+	record interface{},
+) error {
+	data, err := bson.Marshal(record)
+	if err != nil {
+		return karma.Format(err, "unable to encode record of %s", bucket)
+	}
+
+	return tx.Bucket(bucket).Put(id[:], data)
+}
+
+func deleteBoltRecord(tx *bolt.Tx, bucket []byte, id primitive.ObjectID) error {
+	return tx.Bucket(bucket).Delete(id[:])
+}
+
+func loadEndpoints(tx *bolt.Tx, match func(Endpoint) bool) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	err := tx.Bucket(boltEndpoints).ForEach(func(key, value []byte) error {
+		var endpoint Endpoint
+		err := bson.Unmarshal(value, &endpoint)
+		if err != nil {
+			return karma.Format(err, "unable to decode endpoint %x", key)
+		}
+
+		if match(endpoint) {
+			endpoints = append(endpoints, endpoint)
+		}
+
+		return nil
+	})
+
+	return endpoints, err
+}
+
+func loadSubscriptions(
+	tx *bolt.Tx,
+	match func(Subscriber) bool,
+) ([]Subscriber, error) {
+	var subscribers []Subscriber
+	err := tx.Bucket(boltSubscriptions).ForEach(func(key, value []byte) error {
+		var subscriber Subscriber
+		err := bson.Unmarshal(value, &subscriber)
+		if err != nil {
+			return karma.Format(err, "unable to decode subscription %x", key)
+		}
+
+		if match(subscriber) {
+			subscribers = append(subscribers, subscriber)
+		}
+
+		return nil
+	})
+
+	return subscribers, err
+}
+
+func loadOutboxMessages(
+	tx *bolt.Tx,
+	match func(OutboxMessage) bool,
+) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := tx.Bucket(boltOutbox).ForEach(func(key, value []byte) error {
+		var message OutboxMessage
+		err := bson.Unmarshal(value, &message)
+		if err != nil {
+			return karma.Format(err, "unable to decode outbox message %x", key)
+		}
+
+		if match(message) {
+			messages = append(messages, message)
+		}
+
+		return nil
+	})
+
+	return messages, err
+}
+
+func (records *boltRecords) findEndpoints(
+	match func(Endpoint) bool,
+) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	err := records.db.View(func(tx *bolt.Tx) error {
+		var err error
+		endpoints, err = loadEndpoints(tx, match)
+		return err
+	})
+
+	return endpoints, err
+}
+
+func (records *boltRecords) updateEndpoints(
+	match func(Endpoint) bool,
+	update func(*Endpoint),
+) (int64, error) {
+	var count int64
+	err := records.db.Update(func(tx *bolt.Tx) error {
+		endpoints, err := loadEndpoints(tx, match)
+		if err != nil {
+			return err
+		}
+
+		for _, endpoint := range endpoints {
+			update(&endpoint)
+
+			err := putBoltRecord(tx, boltEndpoints, endpoint.ID, endpoint)
+			if err != nil {
+				return err
+			}
+		}
+
+		count = int64(len(endpoints))
+
+		return nil
+	})
+
+	return count, err
+}
+
+func (records *boltRecords) insertEndpoint(
+	endpoint Endpoint,
+	conflict func(Endpoint) bool,
+) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		existing, err := loadEndpoints(tx, conflict)
+		if err != nil {
+			return err
+		}
+
+		if len(existing) > 0 {
+			return errRecordConflict
+		}
+
+		return putBoltRecord(tx, boltEndpoints, endpoint.ID, endpoint)
+	})
+}
+
+func (records *boltRecords) removeEndpoints(match func(Endpoint) bool) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		endpoints, err := loadEndpoints(tx, match)
+		if err != nil {
+			return err
+		}
+
+		for _, endpoint := range endpoints {
+			err := deleteBoltRecord(tx, boltEndpoints, endpoint.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (records *boltRecords) findSubscriptions(
+	match func(Subscriber) bool,
+) ([]Subscriber, error) {
+	var subscribers []Subscriber
+	err := records.db.View(func(tx *bolt.Tx) error {
+		var err error
+		subscribers, err = loadSubscriptions(tx, match)
+		return err
+	})
+
+	return subscribers, err
+}
+
+func (records *boltRecords) updateSubscriptions(
+	match func(Subscriber) bool,
+	update func(*Subscriber),
+) (int64, error) {
+	var count int64
+	err := records.db.Update(func(tx *bolt.Tx) error {
+		subscribers, err := loadSubscriptions(tx, match)
+		if err != nil {
+			return err
+		}
+
+		for _, subscriber := range subscribers {
+			update(&subscriber)
+
+			err := putBoltRecord(
+				tx,
+				boltSubscriptions,
+				subscriber.ID,
+				subscriber,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		count = int64(len(subscribers))
+
+		return nil
+	})
+
+	return count, err
+}
+
+func (records *boltRecords) insertSubscription(
+	subscriber Subscriber,
+	conflict func(Subscriber) bool,
+) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		existing, err := loadSubscriptions(tx, conflict)
+		if err != nil {
+			return err
+		}
+
+		if len(existing) > 0 {
+			return errRecordConflict
+		}
+
+		return putBoltRecord(tx, boltSubscriptions, subscriber.ID, subscriber)
+	})
+}
+
+func (records *boltRecords) removeSubscriptions(
+	match func(Subscriber) bool,
+) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		subscribers, err := loadSubscriptions(tx, match)
+		if err != nil {
+			return err
+		}
+
+		for _, subscriber := range subscribers {
+			err := deleteBoltRecord(tx, boltSubscriptions, subscriber.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (records *boltRecords) findOutboxMessages(
+	match func(OutboxMessage) bool,
+) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := records.db.View(func(tx *bolt.Tx) error {
+		var err error
+		messages, err = loadOutboxMessages(tx, match)
+		return err
+	})
+
+	return messages, err
+}
+
+func (records *boltRecords) updateOutboxMessages(
+	match func(OutboxMessage) bool,
+	update func(*OutboxMessage),
+) (int64, error) {
+	var count int64
+	err := records.db.Update(func(tx *bolt.Tx) error {
+		messages, err := loadOutboxMessages(tx, match)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			update(&message)
+
+			err := putBoltRecord(tx, boltOutbox, message.ID, message)
+			if err != nil {
+				return err
+			}
+		}
+
+		count = int64(len(messages))
+
+		return nil
+	})
+
+	return count, err
+}
+
+func (records *boltRecords) insertOutboxMessage(message OutboxMessage) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		return putBoltRecord(tx, boltOutbox, message.ID, message)
+	})
+}
+
+func (records *boltRecords) removeOutboxMessages(
+	match func(OutboxMessage) bool,
+) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		messages, err := loadOutboxMessages(tx, match)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			err := deleteBoltRecord(tx, boltOutbox, message.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func getChatKey(chatID int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(chatID))
+
+	return key
+}
+
+func loadChatSettings(tx *bolt.Tx, chatID int64) (*ChatSettings, error) {
+	data := tx.Bucket(boltChats).Get(getChatKey(chatID))
+	if data == nil {
+		return nil, nil
+	}
+
+	var settings ChatSettings
+	err := bson.Unmarshal(data, &settings)
+	if err != nil {
+		return nil, karma.Format(err, "unable to decode settings of chat %d", chatID)
+	}
+
+	return &settings, nil
+}
+
+func putChatSettings(tx *bolt.Tx, settings ChatSettings) error {
+	data, err := bson.Marshal(settings)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to encode settings of chat %d",
+			settings.ChatID,
+		)
+	}
+
+	return tx.Bucket(boltChats).Put(getChatKey(settings.ChatID), data)
+}
+
+func (records *boltRecords) findChatSettings(chatID int64) (
+	*ChatSettings,
+	error,
+) {
+	var settings *ChatSettings
+	err := records.db.View(func(tx *bolt.Tx) error {
+		var err error
+		settings, err = loadChatSettings(tx, chatID)
+		return err
+	})
+
+	return settings, err
+}
+
+func (records *boltRecords) updateChatSettings(
+	chatID int64,
+	update func(*ChatSettings),
+) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		settings, err := loadChatSettings(tx, chatID)
+		if err != nil {
+			return err
+		}
+
+		if settings == nil {
+			settings = &ChatSettings{ChatID: chatID}
+		}
+
+		update(settings)
+
+		return putChatSettings(tx, *settings)
+	})
+}
+
+func (records *boltRecords) moveChatSettings(from, to int64) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		settings, err := loadChatSettings(tx, from)
+		if err != nil || settings == nil {
+			return err
+		}
+
+		err = tx.Bucket(boltChats).Delete(getChatKey(from))
+		if err != nil {
+			return err
+		}
+
+		settings.ChatID = to
+
+		return putChatSettings(tx, *settings)
+	})
+}
+
+// getCheckKey returns key of the check which sorts by time within the
+// bucket of the url.
+func getCheckKey(checkedAt time.Time, id primitive.ObjectID) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(checkedAt.UnixNano()))
+	return append(key, id[:]...)
+}
+
+// insertCheck stores the check in the nested bucket of its url, so counting
+// checks of the url is a range scan.
+func (records *boltRecords) insertCheck(check Check, expiredAt time.Time) error {
+	return records.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(boltChecks).CreateBucketIfNotExists(
+			[]byte(check.URL),
+		)
+		if err != nil {
+			return karma.Format(err, "unable to create bucket for checks")
+		}
+
+		data, err := bson.Marshal(check)
+		if err != nil {
+			return karma.Format(err, "unable to encode check")
+		}
+
+		err = bucket.Put(getCheckKey(check.CheckedAt, check.ID), data)
+		if err != nil {
+			return err
+		}
+
+		expired := getCheckKey(expiredAt, primitive.ObjectID{})
+
+		var keys [][]byte
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			if string(key) >= string(expired) {
+				break
+			}
+
+			keys = append(keys, key)
+		}
+
+		for _, key := range keys {
+			err := bucket.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (records *boltRecords) findChecks(url string, since time.Time) (
+	[]Check,
+	error,
+) {
+	var checks []Check
+	err := records.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltChecks).Bucket([]byte(url))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		start := getCheckKey(since, primitive.ObjectID{})
+		for key, value := cursor.Seek(start); key != nil; key, value = cursor.Next() {
+			var check Check
+			err := bson.Unmarshal(value, &check)
+			if err != nil {
+				return karma.Format(err, "unable to decode check %x", key)
+			}
+
+			checks = append(checks, check)
+		}
+
+		return nil
+	})
+
+	return checks, err
+}
+
+func (records *boltRecords) Ping(ctx context.Context) error {
+	return records.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+func (records *boltRecords) Disconnect() error {
+	err := records.db.Close()
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to close database file %s",
+			records.path,
+		)
+	}
+
+	return nil
+}
+
+// Drop closes and removes the database file, the storage can't be used
+// after that.
+func (records *boltRecords) Drop() error {
+	err := records.Disconnect()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(records.path)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to remove database file %s",
+			records.path,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryRecords keeps everything in memory, it's used by tests which don't
+// need persistence.
+type memoryRecords struct {
+	mutex sync.Mutex
+
+	endpoints     map[primitive.ObjectID]Endpoint
+	subscriptions map[primitive.ObjectID]Subscriber
+	outbox        map[primitive.ObjectID]OutboxMessage
+	chats         map[int64]ChatSettings
+	checks        []Check
+}
+
+func NewMemoryStorage() Storage {
+	records := &memoryRecords{}
+	records.reset()
+
+	return &recordStorage{records}
+}
+
+func (records *memoryRecords) reset() {
+	records.endpoints = map[primitive.ObjectID]Endpoint{}
+	records.subscriptions = map[primitive.ObjectID]Subscriber{}
+	records.outbox = map[primitive.ObjectID]OutboxMessage{}
+	records.chats = map[int64]ChatSettings{}
+	records.checks = nil
+}
+
+// sortedIDs returns ids in order of creation to keep results stable like
+// in other backends.
+func sortedIDs(ids []primitive.ObjectID) []primitive.ObjectID {
+	sort.Slice(ids, func(i, j int) bool {
+		return lessObjectID(ids[i], ids[j])
+	})
+
+	return ids
+}
+
+func (records *memoryRecords) endpointIDs(
+	match func(Endpoint) bool,
+) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for id, endpoint := range records.endpoints {
+		if match(endpoint) {
+			ids = append(ids, id)
+		}
+	}
+
+	return sortedIDs(ids)
+}
+
+func (records *memoryRecords) subscriptionIDs(
+	match func(Subscriber) bool,
+) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for id, subscriber := range records.subscriptions {
+		if match(subscriber) {
+			ids = append(ids, id)
+		}
+	}
+
+	return sortedIDs(ids)
+}
+
+func (records *memoryRecords) outboxIDs(
+	match func(OutboxMessage) bool,
+) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for id, message := range records.outbox {
+		if match(message) {
+			ids = append(ids, id)
+		}
+	}
+
+	return sortedIDs(ids)
+}
+
+func (records *memoryRecords) findEndpoints(
+	match func(Endpoint) bool,
+) ([]Endpoint, error) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	var endpoints []Endpoint
+	for _, id := range records.endpointIDs(match) {
+		endpoints = append(endpoints, records.endpoints[id])
+	}
+
+	return endpoints, nil
+}
+
+func (records *memoryRecords) updateEndpoints(
+	match func(Endpoint) bool,
+	update func(*Endpoint),
+) (int64, error) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	ids := records.endpointIDs(match)
+	for _, id := range ids {
+		endpoint := records.endpoints[id]
+		update(&endpoint)
+		records.endpoints[id] = endpoint
+	}
+
+	return int64(len(ids)), nil
+}
+
+func (records *memoryRecords) insertEndpoint(
+	endpoint Endpoint,
+	conflict func(Endpoint) bool,
+) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	if len(records.endpointIDs(conflict)) > 0 {
+		return errRecordConflict
+	}
+
+	records.endpoints[endpoint.ID] = endpoint
+
+	return nil
+}
+
+func (records *memoryRecords) removeEndpoints(match func(Endpoint) bool) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	for _, id := range records.endpointIDs(match) {
+		delete(records.endpoints, id)
+	}
+
+	return nil
+}
+
+func (records *memoryRecords) findSubscriptions(
+	match func(Subscriber) bool,
+) ([]Subscriber, error) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	var subscribers []Subscriber
+	for _, id := range records.subscriptionIDs(match) {
+		subscribers = append(subscribers, records.subscriptions[id])
+	}
+
+	return subscribers, nil
+}
+
+func (records *memoryRecords) updateSubscriptions(
+	match func(Subscriber) bool,
+	update func(*Subscriber),
+) (int64, error) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	ids := records.subscriptionIDs(match)
+	for _, id := range ids {
+		subscriber := records.subscriptions[id]
+		update(&subscriber)
+		records.subscriptions[id] = subscriber
+	}
+
+	return int64(len(ids)), nil
+}
+
+func (records *memoryRecords) insertSubscription(
+	subscriber Subscriber,
+	conflict func(Subscriber) bool,
+) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	if len(records.subscriptionIDs(conflict)) > 0 {
+		return errRecordConflict
+	}
+
+	records.subscriptions[subscriber.ID] = subscriber
+
+	return nil
+}
+
+func (records *memoryRecords) removeSubscriptions(
+	match func(Subscriber) bool,
+) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	for _, id := range records.subscriptionIDs(match) {
+		delete(records.subscriptions, id)
+	}
+
+	return nil
+}
+
+func (records *memoryRecords) findOutboxMessages(
+	match func(OutboxMessage) bool,
+) ([]OutboxMessage, error) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	var messages []OutboxMessage
+	for _, id := range records.outboxIDs(match) {
+		messages = append(messages, records.outbox[id])
+	}
+
+	return messages, nil
+}
+
+func (records *memoryRecords) updateOutboxMessages(
+	match func(OutboxMessage) bool,
+	update func(*OutboxMessage),
+) (int64, error) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	ids := records.outboxIDs(match)
+	for _, id := range ids {
+		message := records.outbox[id]
+		update(&message)
+		records.outbox[id] = message
+	}
+
+	return int64(len(ids)), nil
+}
+
+func (records *memoryRecords) insertOutboxMessage(message OutboxMessage) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	records.outbox[message.ID] = message
+
+	return nil
+}
+
+func (records *memoryRecords) removeOutboxMessages(
+	match func(OutboxMessage) bool,
+) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	for _, id := range records.outboxIDs(match) {
+		delete(records.outbox, id)
+	}
+
+	return nil
+}
+
+func (records *memoryRecords) findChatSettings(chatID int64) (
+	*ChatSettings,
+	error,
+) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	settings, ok := records.chats[chatID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &settings, nil
+}
+
+func (records *memoryRecords) updateChatSettings(
+	chatID int64,
+	update func(*ChatSettings),
+) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	settings, ok := records.chats[chatID]
+	if !ok {
+		settings = ChatSettings{ChatID: chatID}
+	}
+
+	update(&settings)
+	records.chats[chatID] = settings
+
+	return nil
+}
+
+func (records *memoryRecords) moveChatSettings(from, to int64) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	settings, ok := records.chats[from]
+	if !ok {
+		return nil
+	}
+
+	delete(records.chats, from)
+	settings.ChatID = to
+	records.chats[to] = settings
+
+	return nil
+}
+
+func (records *memoryRecords) insertCheck(check Check, expiredAt time.Time) error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	checks := []Check{}
+	for _, item := range records.checks {
+		if item.URL == check.URL && item.CheckedAt.Before(expiredAt) {
+			continue
+		}
+
+		checks = append(checks, item)
+	}
+
+	records.checks = append(checks, check)
+
+	return nil
+}
+
+func (records *memoryRecords) findChecks(url string, since time.Time) (
+	[]Check,
+	error,
+) {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	var checks []Check
+	for _, check := range records.checks {
+		if check.URL == url && !check.CheckedAt.Before(since) {
+			checks = append(checks, check)
+		}
+	}
+
+	return checks, nil
+}
+
+func (records *memoryRecords) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (records *memoryRecords) Disconnect() error {
+	return nil
+}
+
+func (records *memoryRecords) Drop() error {
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+
+	records.reset()
+
+	return nil
+}
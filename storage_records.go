@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordStore keeps records which are queried by scanning, it's implemented
+// by the embedded backends and recordStorage builds Storage on top of it.
+// Every method is atomic.
+type recordStore interface {
+	findEndpoints(match func(Endpoint) bool) ([]Endpoint, error)
+	updateEndpoints(match func(Endpoint) bool, update func(*Endpoint)) (int64, error)
+	insertEndpoint(endpoint Endpoint, conflict func(Endpoint) bool) error
+	removeEndpoints(match func(Endpoint) bool) error
+
+	findSubscriptions(match func(Subscriber) bool) ([]Subscriber, error)
+	updateSubscriptions(match func(Subscriber) bool, update func(*Subscriber)) (int64, error)
+	insertSubscription(subscriber Subscriber, conflict func(Subscriber) bool) error
+	removeSubscriptions(match func(Subscriber) bool) error
+
+	findOutboxMessages(match func(OutboxMessage) bool) ([]OutboxMessage, error)
+	updateOutboxMessages(match func(OutboxMessage) bool, update func(*OutboxMessage)) (int64, error)
+	insertOutboxMessage(message OutboxMessage) error
+	removeOutboxMessages(match func(OutboxMessage) bool) error
+
+	findChatSettings(chatID int64) (*ChatSettings, error)
+	// updateChatSettings creates settings of the chat if they don't exist.
+	updateChatSettings(chatID int64, update func(*ChatSettings)) error
+	// moveChatSettings replaces settings of the chat to with settings of the
+	// chat from, if there are any.
+	moveChatSettings(from, to int64) error
+
+	// insertCheck stores the check and removes checks of the same url
+	// which are older than expiredAt.
+	insertCheck(check Check, expiredAt time.Time) error
+	findChecks(url string, since time.Time) ([]Check, error)
+
+	Ping(ctx context.Context) error
+	Disconnect() error
+	Drop() error
+}
+
+// errRecordConflict is returned by recordStore when a record can't be
+// inserted because a conflicting record already exists.
+var errRecordConflict = errors.New("record already exists")
+
+// recordStorage implements Storage for backends without query language.
+type recordStorage struct {
+	recordStore
+}
+
+func lessObjectID(a, b primitive.ObjectID) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
+
+func (storage *recordStorage) findFirstEndpoint(
+	match func(Endpoint) bool,
+) (*Endpoint, error) {
+	endpoints, err := storage.findEndpoints(match)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+
+	return &endpoints[0], nil
+}
+
+func (storage *recordStorage) findFirstSubscription(
+	match func(Subscriber) bool,
+) (*Subscriber, error) {
+	subscribers, err := storage.findSubscriptions(match)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscribers) == 0 {
+		return nil, nil
+	}
+
+	return &subscribers[0], nil
+}
+
+func (storage *recordStorage) updateSubscription(
+	id primitive.ObjectID,
+	update func(*Subscriber),
+) error {
+	_, err := storage.updateSubscriptions(
+		func(subscriber Subscriber) bool {
+			return subscriber.ID == id
+		},
+		update,
+	)
+
+	return err
+}
+
+func (storage *recordStorage) updateOutboxMessage(
+	id primitive.ObjectID,
+	update func(*OutboxMessage),
+) error {
+	_, err := storage.updateOutboxMessages(
+		func(message OutboxMessage) bool {
+			return message.ID == id
+		},
+		update,
+	)
+
+	return err
+}
+
+// writeEndpoint inserts the endpoint unless an endpoint with the same url
+// and duration already exists.
+func (storage *recordStorage) writeEndpoint(endpoint *Endpoint) error {
+	if endpoint.ID.IsZero() {
+		endpoint.ID = primitive.NewObjectID()
+	}
+
+	err := storage.insertEndpoint(*endpoint, func(item Endpoint) bool {
+		return item.URL == endpoint.URL && item.Duration == endpoint.Duration
+	})
+	if err == errRecordConflict {
+		return nil
+	}
+
+	return err
+}
+
+func (storage *recordStorage) getEndpoint(id primitive.ObjectID) (
+	*Endpoint,
+	error,
+) {
+	return storage.findFirstEndpoint(func(endpoint Endpoint) bool {
+		return endpoint.ID == id
+	})
+}
+
+func (storage *recordStorage) findEndpoint(url string) (*Endpoint, error) {
+	return storage.findFirstEndpoint(func(endpoint Endpoint) bool {
+		return endpoint.URL == url
+	})
+}
+
+func (storage *recordStorage) findSubscriberEndpoint(subscriber Subscriber) (
+	*Endpoint,
+	error,
+) {
+	return storage.findFirstEndpoint(func(endpoint Endpoint) bool {
+		return endpoint.URL == subscriber.URL &&
+			endpoint.Duration == subscriber.Duration
+	})
+}
+
+func (storage *recordStorage) findDueEndpoints(now time.Time) (
+	[]Endpoint,
+	error,
+) {
+	return storage.findEndpoints(func(endpoint Endpoint) bool {
+		return endpoint.RefreshAt.Before(now) && !endpoint.Webhook
+	})
+}
+
+func (storage *recordStorage) listEndpoints() ([]Endpoint, error) {
+	return storage.findEndpoints(func(Endpoint) bool {
+		return true
+	})
+}
+
+func (storage *recordStorage) saveEndpointFetch(
+	endpoint Endpoint,
+	refreshAt time.Time,
+) error {
+	_, err := storage.updateEndpoints(
+		func(item Endpoint) bool {
+			return item.ID == endpoint.ID
+		},
+		func(item *Endpoint) {
+			item.Data = endpoint.Data
+			item.PreviousData = endpoint.PreviousData
+			item.Response = endpoint.Response
+			item.UpdatedAt = endpoint.UpdatedAt
+			item.Failures = endpoint.Failures
+			item.LastError = endpoint.LastError
+			item.StatusCode = endpoint.StatusCode
+			item.Latency = endpoint.Latency
+			item.FailingSince = endpoint.FailingSince
+			item.LastDowntime = endpoint.LastDowntime
+			item.Up = endpoint.Up
+			item.BodySize = endpoint.BodySize
+			item.CertExpiresAt = endpoint.CertExpiresAt
+			item.CertError = endpoint.CertError
+
+			if item.RefreshAt.Equal(refreshAt) {
+				item.RefreshAt = endpoint.RefreshAt
+			}
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) refreshEndpoint(
+	id primitive.ObjectID,
+	now time.Time,
+) (int64, error) {
+	return storage.updateEndpoints(
+		func(endpoint Endpoint) bool {
+			return endpoint.ID == id
+		},
+		func(endpoint *Endpoint) {
+			endpoint.RefreshAt = now
+		},
+	)
+}
+
+func (storage *recordStorage) refreshAllEndpoints(now time.Time) (int64, error) {
+	return storage.updateEndpoints(
+		func(Endpoint) bool {
+			return true
+		},
+		func(endpoint *Endpoint) {
+			endpoint.RefreshAt = now
+		},
+	)
+}
+
+func (storage *recordStorage) RemoveEndpoint(id primitive.ObjectID) error {
+	return storage.removeEndpoints(func(endpoint Endpoint) bool {
+		return endpoint.ID == id
+	})
+}
+
+func (storage *recordStorage) trustEndpoint(
+	url string,
+	duration time.Duration,
+) error {
+	_, err := storage.updateEndpoints(
+		func(endpoint Endpoint) bool {
+			return endpoint.URL == url && endpoint.Duration == duration
+		},
+		func(endpoint *Endpoint) {
+			endpoint.Trusted = true
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) removeEndpointsByURL(url string) error {
+	return storage.removeEndpoints(func(endpoint Endpoint) bool {
+		return endpoint.URL == url
+	})
+}
+
+// upsertSubscriber creates the subscription or updates the existing one of
+// the same chat and url.
+func (storage *recordStorage) upsertSubscriber(subscriber Subscriber) error {
+	match := func(item Subscriber) bool {
+		return item.URL == subscriber.URL && item.UserID == subscriber.UserID
+	}
+
+	update := func(item *Subscriber) {
+		item.Duration = subscriber.Duration
+		item.Sender = subscriber.Sender
+		item.Chat = subscriber.Chat
+		item.Keys = subscriber.Keys
+		item.Kind = subscriber.Kind
+		item.SendAt = subscriber.SendAt
+		item.Disabled = false
+		item.DisabledReason = ""
+		item.Trusted = subscriber.Trusted
+	}
+
+	for {
+		count, err := storage.updateSubscriptions(match, update)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return nil
+		}
+
+		record := Subscriber{
+			ID:     primitive.NewObjectID(),
+			URL:    subscriber.URL,
+			UserID: subscriber.UserID,
+		}
+		update(&record)
+
+		err = storage.insertSubscription(record, match)
+		if err != errRecordConflict {
+			return err
+		}
+
+		// created concurrently, update it on the next iteration
+	}
+}
+
+func (storage *recordStorage) updateSubscriber(
+	id primitive.ObjectID,
+	sendAt time.Time,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.SendAt = sendAt
+	})
+}
+
+func (storage *recordStorage) updateSubscriberStatus(
+	userID int,
+	url string,
+	updatedAt time.Time,
+) error {
+	_, err := storage.updateSubscriptions(
+		func(subscriber Subscriber) bool {
+			return subscriber.UserID == userID && subscriber.URL == url
+		},
+		func(subscriber *Subscriber) {
+			subscriber.UpdatedAt = updatedAt
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) setSubscriberAlerted(
+	id primitive.ObjectID,
+	alerted bool,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.Alerted = alerted
+	})
+}
+
+func (storage *recordStorage) setSubscriberPaused(
+	id primitive.ObjectID,
+	paused bool,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.Paused = paused
+	})
+}
+
+func (storage *recordStorage) setSubscriberManaged(
+	id primitive.ObjectID,
+	template string,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.Managed = true
+		subscriber.Template = template
+	})
+}
+
+func (storage *recordStorage) setSubscriberFilters(
+	id primitive.ObjectID,
+	filters Filters,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.Filters = filters
+	})
+}
+
+func (storage *recordStorage) setSubscriberNotified(
+	id primitive.ObjectID,
+	values []NotifiedValue,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.Notified = values
+	})
+}
+
+func (storage *recordStorage) setSubscriberState(
+	id primitive.ObjectID,
+	state string,
+	statusCode int,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.LastState = state
+		subscriber.LastStatusCode = statusCode
+	})
+}
+
+func (storage *recordStorage) setSubscriberCertWarned(
+	id primitive.ObjectID,
+	days int,
+) error {
+	return storage.updateSubscription(id, func(subscriber *Subscriber) {
+		subscriber.CertWarned = days
+	})
+}
+
+func (storage *recordStorage) getSubscription(id primitive.ObjectID) (
+	*Subscriber,
+	error,
+) {
+	return storage.findFirstSubscription(func(subscriber Subscriber) bool {
+		return subscriber.ID == id
+	})
+}
+
+func (storage *recordStorage) findSubscriber(userID int, url string) (
+	*Subscriber,
+	error,
+) {
+	return storage.findFirstSubscription(func(subscriber Subscriber) bool {
+		return subscriber.UserID == userID && subscriber.URL == url
+	})
+}
+
+func (storage *recordStorage) findChatSubscriptions(userID int) (
+	[]Subscriber,
+	error,
+) {
+	return storage.findSubscriptions(func(subscriber Subscriber) bool {
+		return subscriber.UserID == userID
+	})
+}
+
+func (storage *recordStorage) hasOtherChatsSubscriptions(userID int) (
+	bool,
+	error,
+) {
+	subscriber, err := storage.findFirstSubscription(
+		func(subscriber Subscriber) bool {
+			return subscriber.UserID != userID && subscriber.URL != ""
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return subscriber != nil, nil
+}
+
+func (storage *recordStorage) findDueSubscriptions(now time.Time) (
+	[]Subscriber,
+	error,
+) {
+	return storage.findSubscriptions(func(subscriber Subscriber) bool {
+		return subscriber.SendAt.Before(now) &&
+			!subscriber.Disabled &&
+			!subscriber.Paused
+	})
+}
+
+func (storage *recordStorage) findActiveURLSubscriptions(url string) (
+	[]Subscriber,
+	error,
+) {
+	return storage.findSubscriptions(func(subscriber Subscriber) bool {
+		return subscriber.URL == url &&
+			!subscriber.Disabled &&
+			!subscriber.Paused
+	})
+}
+
+func (storage *recordStorage) listSubscriptions() ([]Subscriber, error) {
+	return storage.findSubscriptions(func(Subscriber) bool {
+		return true
+	})
+}
+
+func (storage *recordStorage) RemoveSubscription(id primitive.ObjectID) error {
+	return storage.removeSubscriptions(func(subscriber Subscriber) bool {
+		return subscriber.ID == id
+	})
+}
+
+func (storage *recordStorage) removeChatSubscriptions(userID int) error {
+	return storage.removeSubscriptions(func(subscriber Subscriber) bool {
+		return subscriber.UserID == userID && !subscriber.Managed
+	})
+}
+
+func (storage *recordStorage) removeEndpointSubscriptions(
+	endpoint Endpoint,
+) error {
+	return storage.removeSubscriptions(func(subscriber Subscriber) bool {
+		return subscriber.URL == endpoint.URL &&
+			subscriber.Duration == endpoint.Duration
+	})
+}
+
+func (storage *recordStorage) disableSubscriptions(
+	chatID int64,
+	reason string,
+) error {
+	_, err := storage.updateSubscriptions(
+		func(subscriber Subscriber) bool {
+			return subscriber.UserID == int(chatID)
+		},
+		func(subscriber *Subscriber) {
+			subscriber.Disabled = true
+			subscriber.DisabledReason = reason
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) enableSubscriptions(chatID int64) error {
+	_, err := storage.updateSubscriptions(
+		func(subscriber Subscriber) bool {
+			return subscriber.UserID == int(chatID) && subscriber.Disabled
+		},
+		func(subscriber *Subscriber) {
+			subscriber.Disabled = false
+			subscriber.DisabledReason = ""
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) migrateSubscriptions(from, to int64) error {
+	_, err := storage.updateSubscriptions(
+		func(subscriber Subscriber) bool {
+			return subscriber.UserID == int(from)
+		},
+		func(subscriber *Subscriber) {
+			subscriber.UserID = int(to)
+			if subscriber.Chat != nil {
+				chat := *subscriber.Chat
+				chat.ID = to
+				subscriber.Chat = &chat
+			}
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) enqueueMessage(
+	chatID int64,
+	text string,
+	now time.Time,
+) error {
+	return storage.insertOutboxMessage(OutboxMessage{
+		ID:        primitive.NewObjectID(),
+		ChatID:    chatID,
+		Text:      text,
+		SendAt:    now,
+		CreatedAt: now,
+	})
+}
+
+func (storage *recordStorage) findDueOutboxMessages(now time.Time) (
+	[]OutboxMessage,
+	error,
+) {
+	due, err := storage.findOutboxMessages(func(message OutboxMessage) bool {
+		return !message.Dead && !message.SendAt.After(now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	waiting, err := storage.findOutboxMessages(func(message OutboxMessage) bool {
+		return !message.Dead && message.SendAt.After(now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, messages := range [][]OutboxMessage{due, waiting} {
+		sort.Slice(messages, func(i, j int) bool {
+			return lessObjectID(messages[i].ID, messages[j].ID)
+		})
+	}
+
+	return holdBackOutboxMessages(due, waiting), nil
+}
+
+func (storage *recordStorage) removeOutboxMessage(id primitive.ObjectID) error {
+	return storage.removeOutboxMessages(func(message OutboxMessage) bool {
+		return message.ID == id
+	})
+}
+
+func (storage *recordStorage) retryOutboxMessage(
+	message OutboxMessage,
+	sendAt time.Time,
+	reason error,
+) error {
+	return storage.updateOutboxMessage(message.ID, func(item *OutboxMessage) {
+		item.Attempts = message.Attempts
+		item.LastError = reason.Error()
+		item.SendAt = sendAt
+	})
+}
+
+func (storage *recordStorage) buryOutboxMessage(
+	message OutboxMessage,
+	reason error,
+) error {
+	return storage.updateOutboxMessage(message.ID, func(item *OutboxMessage) {
+		item.Attempts = message.Attempts
+		item.LastError = reason.Error()
+		item.Dead = true
+	})
+}
+
+func (storage *recordStorage) buryChatOutboxMessages(
+	chatID int64,
+	reason error,
+) error {
+	_, err := storage.updateOutboxMessages(
+		func(message OutboxMessage) bool {
+			return message.ChatID == chatID && !message.Dead
+		},
+		func(message *OutboxMessage) {
+			message.LastError = reason.Error()
+			message.Dead = true
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) migrateOutboxMessages(from, to int64) error {
+	_, err := storage.updateOutboxMessages(
+		func(message OutboxMessage) bool {
+			return message.ChatID == from && !message.Dead
+		},
+		func(message *OutboxMessage) {
+			message.ChatID = to
+		},
+	)
+
+	return err
+}
+
+func (storage *recordStorage) countOutboxMessages() (int64, error) {
+	messages, err := storage.findOutboxMessages(func(message OutboxMessage) bool {
+		return !message.Dead
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(messages)), nil
+}
+
+func (storage *recordStorage) getChatSettings(chatID int64) (
+	*ChatSettings,
+	error,
+) {
+	return storage.findChatSettings(chatID)
+}
+
+func (storage *recordStorage) setChatLanguage(
+	chatID int64,
+	language string,
+) error {
+	return storage.updateChatSettings(chatID, func(settings *ChatSettings) {
+		settings.Language = language
+	})
+}
+
+func (storage *recordStorage) setChatTimezone(
+	chatID int64,
+	timezone string,
+) error {
+	return storage.updateChatSettings(chatID, func(settings *ChatSettings) {
+		settings.Timezone = timezone
+	})
+}
+
+func (storage *recordStorage) migrateChatSettings(from, to int64) error {
+	return storage.moveChatSettings(from, to)
+}
+
+func (storage *recordStorage) writeCheck(
+	endpoint Endpoint,
+	result *FetchResult,
+	checkedAt time.Time,
+) error {
+	check := Check{
+		ID:        primitive.NewObjectID(),
+		URL:       endpoint.URL,
+		Up:        isUp(result),
+		CheckedAt: checkedAt,
+	}
+
+	if result != nil {
+		check.StatusCode = result.StatusCode
+		check.Latency = result.Latency
+	}
+
+	return storage.insertCheck(check, checkedAt.Add(-checksTTL))
+}
+
+func (storage *recordStorage) countChecks(url string, since time.Time) (
+	int64,
+	int64,
+	error,
+) {
+	checks, err := storage.findChecks(url, since)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var up int64
+	for _, check := range checks {
+		if check.Up {
+			up++
+		}
+	}
+
+	return int64(len(checks)), up, nil
+}
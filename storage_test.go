@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Storage_SaveEndpointFetchKeepsConcurrentChanges(t *testing.T) {
+	database := createTestDatabase()
+	defer database.Drop()
+
+	refreshAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	endpoint := &Endpoint{
+		URL:       "http://example.com/",
+		Duration:  time.Minute,
+		RefreshAt: refreshAt,
+	}
+
+	err := database.writeEndpoint(endpoint)
+	assert.NoError(t, err)
+
+	fetched, err := database.getEndpoint(endpoint.ID)
+	assert.NoError(t, err)
+
+	// the endpoint is trusted and refreshed while its url is requested
+	err = database.trustEndpoint(endpoint.URL, endpoint.Duration)
+	assert.NoError(t, err)
+
+	_, err = database.refreshEndpoint(endpoint.ID, refreshAt.Add(time.Second))
+	assert.NoError(t, err)
+
+	fetched.Data = map[string]interface{}{"a": "b"}
+	fetched.Response = true
+	fetched.StatusCode = 200
+	fetched.RefreshAt = refreshAt.Add(time.Minute)
+
+	err = database.saveEndpointFetch(*fetched, refreshAt)
+	assert.NoError(t, err)
+
+	stored, err := database.getEndpoint(endpoint.ID)
+	assert.NoError(t, err)
+	assert.True(t, stored.Trusted)
+	assert.True(t, stored.Response)
+	assert.Equal(t, 200, stored.StatusCode)
+	assert.Equal(t, map[string]interface{}{"a": "b"}, stored.Data)
+	assert.True(t, stored.RefreshAt.Equal(refreshAt.Add(time.Second)))
+
+	// without concurrent refresh the next one is scheduled
+	fetched.RefreshAt = refreshAt.Add(2 * time.Minute)
+	err = database.saveEndpointFetch(*fetched, stored.RefreshAt)
+	assert.NoError(t, err)
+
+	stored, err = database.getEndpoint(endpoint.ID)
+	assert.NoError(t, err)
+	assert.True(t, stored.RefreshAt.Equal(refreshAt.Add(2*time.Minute)))
+}
+
+func Test_Storage_UpsertSubscriberEnablesSubscription(t *testing.T) {
+	database := createTestDatabase()
+	defer database.Drop()
+
+	subscriber := Subscriber{
+		URL:    "http://example.com/",
+		UserID: 2,
+		Keys:   []string{"a"},
+	}
+
+	err := database.upsertSubscriber(subscriber)
+	assert.NoError(t, err)
+
+	err = database.disableSubscriptions(2, "bot was blocked")
+	assert.NoError(t, err)
+
+	err = database.upsertSubscriber(subscriber)
+	assert.NoError(t, err)
+
+	stored, err := database.findSubscriber(2, subscriber.URL)
+	assert.NoError(t, err)
+	assert.False(t, stored.Disabled)
+	assert.Empty(t, stored.DisabledReason)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	karma "github.com/reconquest/karma-go"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// timezoneDefault resets the timezone of the chat to the one from config.
+const timezoneDefault = "default"
+
+// locations are loaded once, time.LoadLocation reads the tz database on
+// every call
+var locations = struct {
+	sync.Mutex
+	cache map[string]*time.Location
+}{cache: map[string]*time.Location{}}
+
+func loadLocation(name string) (*time.Location, error) {
+	locations.Lock()
+	defer locations.Unlock()
+
+	if location, ok := locations.cache[name]; ok {
+		return location, nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations.cache[name] = location
+
+	return location, nil
+}
+
+// getChatLocation returns the timezone chosen by /timezone or the one from
+// config, the config timezone is checked when it's loaded.
+func (coordinator *Coordinator) getChatLocation(
+	settings *ChatSettings,
+) *time.Location {
+	if settings != nil && settings.Timezone != "" {
+		location, err := loadLocation(settings.Timezone)
+		if err == nil {
+			return location
+		}
+	}
+
+	location, err := loadLocation(coordinator.config.Format.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
+}
+
+// timezone shows or changes the timezone dates are written in for the chat.
+func (coordinator *Coordinator) timezone(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+
+	name := arguments.Get(0)
+	if name == "" {
+		return coordinator.sendReply(
+			message,
+			locale.Sprintf(
+				"TIMEZONE - %s\nNOW - %s\n\n"+
+					"In format:  /timezone Europe/Berlin|%s",
+				locale.Location,
+				locale.FormatTime(coordinator.clock.Now()),
+				timezoneDefault,
+			),
+		)
+	}
+
+	if name == timezoneDefault {
+		name = ""
+	} else {
+		location, err := loadLocation(name)
+		// the local timezone of the server means nothing to users
+		if err != nil || location == time.Local {
+			return coordinator.sendReply(
+				message,
+				locale.Sprintf(
+					"Unknown timezone, use names like Europe/Berlin "+
+						"or America/New_York: %s",
+					name,
+				),
+			)
+		}
+	}
+
+	chatID := int64(getRecipientID(message))
+
+	err = coordinator.database.setChatTimezone(chatID, name)
+	if err != nil {
+		return karma.Format(err, "unable to set timezone of chat %d", chatID)
+	}
+
+	locale = coordinator.getLocale(message)
+
+	return coordinator.sendReply(
+		message,
+		locale.Sprintf("Timezone was changed to %s", locale.Location),
+	)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_UsesTimezoneOfChat(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = newFakeClock()
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = "Mars/Olympus"
+
+	err = coordinator.timezone(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "Unknown timezone")
+
+	message.Payload = "Europe/Berlin"
+
+	err = coordinator.timezone(message)
+	assert.NoError(t, err)
+	assert.Equal(t, "Timezone was changed to Europe/Berlin", telegramBot.lastSentMessage)
+
+	message.Payload = ""
+
+	err = coordinator.timezone(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "NOW - Jan 1, 2020 13:00 CET")
+
+	coordinator.config.Format.DetectDates = true
+
+	text := coordinator.prepareMessageForSubscriber(
+		[]string{"created"},
+		Endpoint{
+			Data:         map[string]interface{}{"created": "2020-03-01T10:00:00Z"},
+			PreviousData: map[string]interface{}{"created": "2020-02-01T10:00:00Z"},
+			UpdatedAt:    time.Now(),
+		},
+		Subscriber{UserID: 2, Chat: message.Chat},
+	)
+	assert.Contains(t, text[0], "Mar 1, 2020 11:00 CET")
+
+	message.Payload = "default"
+
+	err = coordinator.timezone(message)
+	assert.NoError(t, err)
+	assert.Equal(t, "Timezone was changed to UTC", telegramBot.lastSentMessage)
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+
+	karma "github.com/reconquest/karma-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// SubscriptionUptime is a kind of subscription which doesn't need json
+	// keys and reports only availability of the url.
+	SubscriptionUptime = "uptime"
+
+	stateUp   = "up"
+	stateDown = "down"
+
+	// checks are used only for uptime over the last 30 days
+	checksTTL = 31 * 24 * time.Hour
+)
+
+var uptimeWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// Check is a result of a single endpoint refresh.
+type Check struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	URL        string             `bson:"url"`
+	Up         bool               `bson:"up"`
+	StatusCode int                `bson:"status_code"`
+	Latency    time.Duration      `bson:"latency"`
+	CheckedAt  time.Time          `bson:"checked_at"`
+}
+
+func isUp(result *FetchResult) bool {
+	return result != nil && result.StatusCode < http.StatusBadRequest
+}
+
+func (database *Database) ensureChecksIndexes() error {
+	_, err := database.Checks.Indexes().CreateMany(
+		database.context,
+		[]mongo.IndexModel{
+			{
+				Keys: bsonx.Doc{
+					{Key: "url", Value: bsonx.Int32(1)},
+					{Key: "checked_at", Value: bsonx.Int32(1)},
+				},
+			},
+			{
+				Keys: bsonx.Doc{
+					{Key: "checked_at", Value: bsonx.Int32(1)},
+				},
+				Options: options.Index().SetExpireAfterSeconds(
+					int32(checksTTL / time.Second),
+				),
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (database *Database) writeCheck(
+	endpoint Endpoint,
+	result *FetchResult,
+	checkedAt time.Time,
+) error {
+	check := Check{
+		URL:       endpoint.URL,
+		Up:        isUp(result),
+		CheckedAt: checkedAt,
+	}
+
+	if result != nil {
+		check.StatusCode = result.StatusCode
+		check.Latency = result.Latency
+	}
+
+	_, err := database.Checks.InsertOne(database.context, check)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to insert record into %s collection",
+			database.Checks.Name(),
+		)
+	}
+
+	return nil
+}
+
+// countChecks returns total number of checks of the url since the given
+// time and number of checks when the url was up.
+func (database *Database) countChecks(url string, since time.Time) (
+	int64,
+	int64,
+	error,
+) {
+	filter := bson.M{
+		"url":        url,
+		"checked_at": bson.M{"$gte": since},
+	}
+
+	total, err := database.Checks.CountDocuments(database.context, filter)
+	if err != nil {
+		return 0, 0, karma.Format(
+			err,
+			"unable to count records in %s collection",
+			database.Checks.Name(),
+		)
+	}
+
+	filter["up"] = true
+	up, err := database.Checks.CountDocuments(database.context, filter)
+	if err != nil {
+		return 0, 0, karma.Format(
+			err,
+			"unable to count records in %s collection",
+			database.Checks.Name(),
+		)
+	}
+
+	return total, up, nil
+}
+
+func getEndpointState(endpoint Endpoint) string {
+	if endpoint.Up {
+		return stateUp
+	}
+
+	return stateDown
+}
+
+func formatState(locale i18n.Locale, state string, statusCode int) string {
+	state = locale.Translate(state)
+	if statusCode == 0 {
+		return locale.Sprintf("%s, no response", state)
+	}
+
+	return fmt.Sprintf(
+		"%s, %d %s",
+		state,
+		statusCode,
+		http.StatusText(statusCode),
+	)
+}
+
+// sendUptimeToSubscriber reports changes of url state and status code, the
+// first observed state is only remembered.
+func (coordinator *Coordinator) sendUptimeToSubscriber(
+	subscriber Subscriber,
+	endpoint Endpoint,
+) error {
+	state := getEndpointState(endpoint)
+
+	changed := state != subscriber.LastState ||
+		endpoint.StatusCode != subscriber.LastStatusCode
+
+	if changed && subscriber.LastState != "" {
+		locale := coordinator.getSubscriberLocale(subscriber)
+
+		text := locale.Sprintf(
+			"\nID - %s\nURL - %s\n\nStatus changed: %s → %s",
+			subscriber.ID.Hex(),
+			subscriber.URL,
+			formatState(
+				locale,
+				subscriber.LastState,
+				subscriber.LastStatusCode,
+			),
+			formatState(locale, state, endpoint.StatusCode),
+		)
+
+		if state == stateDown && endpoint.LastError != "" {
+			text += "\n\n" + locale.Sprintf("Reason: %s", endpoint.LastError)
+		}
+
+		err := coordinator.enqueueMessage(
+			int64(subscriber.RecipientID),
+			text,
+		)
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to enqueue message to user: %d",
+				subscriber.RecipientID,
+			)
+		}
+	}
+
+	if changed {
+		err := coordinator.database.setSubscriberState(
+			subscriber.ID,
+			state,
+			endpoint.StatusCode,
+		)
+		if err != nil {
+			return karma.Format(err, "unable to update subscriber state")
+		}
+	}
+
+	err := coordinator.updateSubscriber(subscriber)
+	if err != nil {
+		return karma.Format(err, "unable to update subscriber data in database")
+	}
+
+	return nil
+}
+
+func (coordinator *Coordinator) createFirstUptimeMessage(
+	subscriber *Subscriber,
+	locale i18n.Locale,
+) ([]string, error) {
+	result, err := coordinator.fetcher.fetchJSON(
+		coordinator.context,
+		subscriber.URL,
+		subscriber.Trusted,
+	)
+	if result == nil {
+		return nil, err
+	}
+
+	state := stateDown
+	if isUp(result) {
+		state = stateUp
+	}
+
+	return []string{locale.Sprintf(
+		"ID - %s\n\nSTATUS - %s\nLATENCY - %s",
+		subscriber.ID.Hex(),
+		formatState(locale, state, result.StatusCode),
+		result.Latency.Round(time.Millisecond),
+	)}, nil
+}
+
+func (coordinator *Coordinator) uptime(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 2)
+	if arguments == nil {
+		return err
+	}
+
+	if len(arguments.Positional) != 2 {
+		return coordinator.sendReply(
+			message,
+			coordinator.getLocale(message).Translate(
+				"Data required!\nIn format:  /uptime url duration",
+			),
+		)
+	}
+
+	return coordinator.createSubscription(
+		message,
+		arguments.Get(0),
+		arguments.Get(1),
+		"",
+		SubscriptionUptime,
+	)
+}
+
+func (coordinator *Coordinator) status(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
+
+	recipientID := getRecipientID(message)
+	locale := coordinator.getLocale(message)
+
+	subscriptionID, err := primitive.ObjectIDFromHex(arguments.Get(0))
+	if err != nil {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"Subscription ID required!\nIn format:  /status subscriptionID",
+			),
+		)
+	}
+
+	subscriber, err := coordinator.database.getSubscription(subscriptionID)
+	if err != nil {
+		return karma.Format(err, "unable to find subscription")
+	}
+
+	if subscriber == nil || subscriber.UserID != recipientID {
+		return coordinator.sendReply(
+			message,
+			locale.Translate("You don't have subscription with this id"),
+		)
+	}
+
+	endpoint, err := coordinator.database.findSubscriberEndpoint(*subscriber)
+	if err != nil {
+		return karma.Format(err, "unable to find endpoint")
+	}
+
+	text := []string{
+		"ID - " + subscriber.ID.Hex(),
+		"URL - " + subscriber.URL,
+	}
+
+	if endpoint != nil {
+		text = append(
+			text,
+			locale.Sprintf("STATUS - %s", formatState(
+				locale,
+				getEndpointState(*endpoint),
+				endpoint.StatusCode,
+			)),
+			locale.Sprintf(
+				"LATENCY - %s",
+				endpoint.Latency.Round(time.Millisecond),
+			),
+			locale.Sprintf(
+				"SIZE - %s bytes",
+				locale.FormatNumber(float64(endpoint.BodySize)),
+			),
+		)
+
+		if endpoint.CertError != "" {
+			text = append(
+				text,
+				locale.Sprintf("CERTIFICATE - %s", endpoint.CertError),
+			)
+		} else if !endpoint.CertExpiresAt.IsZero() {
+			text = append(text, locale.Sprintf(
+				"CERTIFICATE - expires %s",
+				locale.FormatTime(endpoint.CertExpiresAt),
+			))
+		}
+	}
+
+	var uptime []string
+	for _, window := range uptimeWindows {
+		total, up, err := coordinator.database.countChecks(
+			subscriber.URL,
+			coordinator.clock.Now().Add(-window.duration),
+		)
+		if err != nil {
+			return karma.Format(err, "unable to count checks")
+		}
+
+		if total == 0 {
+			uptime = append(uptime, window.name+": "+locale.Translate("n/a"))
+			continue
+		}
+
+		uptime = append(uptime, fmt.Sprintf(
+			"%s: %s%%",
+			window.name,
+			locale.FormatNumber(
+				math.Round(float64(up)*10000/float64(total))/100,
+			),
+		))
+	}
+
+	text = append(
+		text,
+		locale.Sprintf("UPTIME - %s", strings.Join(uptime, ", ")),
+	)
+
+	return coordinator.sendReply(message, strings.Join(text, "\n"))
+}
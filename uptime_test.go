@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_ReportsUptimeChangesAndStatus(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	var mutex sync.Mutex
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			writer.WriteHeader(status)
+			fmt.Fprint(writer, `{"a": 1}`)
+		},
+	))
+	defer server.Close()
+
+	setStatus := func(code int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		status = code
+	}
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	tick := func(duration time.Duration) {
+		clock.Advance(duration)
+		assert.NoError(t, coordinator.routineUpdateEndpoints())
+		assert.NoError(t, coordinator.routineSendDataToSubscribers())
+		assert.NoError(t, coordinator.routineSendOutbox())
+	}
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = server.URL + " 10s"
+	err = coordinator.uptime(message)
+	assert.NoError(t, err)
+	assert.Contains(t, telegramBot.lastSentMessage, "STATUS - up, 200 OK")
+
+	subscriber, err := coordinator.database.findSubscriber(2, server.URL)
+	assert.NoError(t, err)
+
+	id := subscriber.ID.Hex()
+
+	// the first state is only remembered
+	tick(11 * time.Second)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 1)
+
+	setStatus(http.StatusInternalServerError)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 2)
+	assert.Equal(
+		t,
+		"\nID - "+id+"\nURL - "+server.URL+"\n\n"+
+			"Status changed: up, 200 OK → down, 500 Internal Server Error",
+		telegramBot.lastSentMessage,
+	)
+
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 2)
+
+	setStatus(http.StatusOK)
+	tick(11 * time.Second)
+	assert.Len(t, telegramBot.allSentMessages, 3)
+	assert.Equal(
+		t,
+		"\nID - "+id+"\nURL - "+server.URL+"\n\n"+
+			"Status changed: down, 500 Internal Server Error → up, 200 OK",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = id
+	err = coordinator.status(message)
+	assert.NoError(t, err)
+	assert.Contains(
+		t,
+		telegramBot.lastSentMessage,
+		"ID - "+id+"\nURL - "+server.URL+"\nSTATUS - up, 200 OK\n",
+	)
+	assert.Contains(t, telegramBot.lastSentMessage, "\nSIZE - 8 bytes\n")
+	assert.Contains(
+		t,
+		telegramBot.lastSentMessage,
+		"\nUPTIME - 24h: 60%, 7d: 60%, 30d: 60%",
+	)
+
+	other := createMessage("", "", "", 3, 4)
+	other.Payload = id
+	err = coordinator.status(other)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"You don't have subscription with this id",
+		telegramBot.lastSentMessage,
+	)
+}
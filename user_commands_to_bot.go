@@ -1,18 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/reconquest/notify-telegram-bot/internal/printer"
-
+	"github.com/reconquest/notify-telegram-bot/internal/args"
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+	"github.com/reconquest/notify-telegram-bot/internal/ratelimit"
 	"github.com/reconquest/notify-telegram-bot/internal/transport"
 
 	karma "github.com/reconquest/karma-go"
 	"github.com/reconquest/pkg/log"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"gopkg.in/tucnak/telebot.v2"
 	tb "gopkg.in/tucnak/telebot.v2"
@@ -25,36 +28,71 @@ type UpdatedAndPreviousData struct {
 
 type Coordinator struct {
 	transport transport.Transport
-	database  *Database
+	database  Storage
 	config    *Config
 	cache     map[int]UpdatedAndPreviousData
 	channel   chan string
+	limiter   *ratelimit.Limiter
+	routines  []*Routine
+	poller    *transport.Poller
+	startedAt time.Time
+	server    *http.Server
+	clock     Clock
+	fetcher   *Fetcher
+	keyTrees  *keyTrees
+
+	// fetchCooldowns limits urls requested by /peek and /keys
+	fetchCooldowns *fetchCooldowns
+
+	// endpointLocks serializes pushes to webhooks
+	endpointLocks *endpointLocks
+
+	// configPath is read again when declared subscriptions are reloaded,
+	// subscriptionsDir is taken from the last loaded config and guarded by
+	// reloading
+	configPath        string
+	reloading         sync.Mutex
+	subscriptionsDir  string
+	declarationsStamp string
+
+	// context is canceled when in-flight work should be abandoned, stopping
+	// is closed when background loops should not start new iterations
+	context  context.Context
+	stopping chan struct{}
+
+	// handlers is waited for on shutdown, the telegram bot runs every
+	// handler in its own goroutine
+	handlers interface{ Wait() }
 }
 
 func NewCoordinator(
 	transport transport.Transport,
-	database *Database,
+	database Storage,
 	config *Config,
 ) *Coordinator {
 	return &Coordinator{
 		transport: transport,
 		database:  database,
 		config:    config,
+		startedAt: time.Now(),
+		clock:     systemClock{},
+		fetcher:   NewFetcher(config.Fetch, config.Quota.MaxResponseSize),
+		keyTrees:  newKeyTrees(),
+		context:   context.Background(),
+		stopping:  make(chan struct{}),
+		limiter: ratelimit.NewLimiter(
+			config.Outbox.GlobalInterval.Duration,
+			config.Outbox.PrivateInterval.Duration,
+			config.Outbox.GroupInterval.Duration,
+		),
+		endpointLocks:    newEndpointLocks(),
+		fetchCooldowns:   newFetchCooldowns(),
+		subscriptionsDir: config.SubscriptionsDir,
 	}
 }
 
 func (coordinator *Coordinator) start(message *tb.Message) error {
-	text := "Hi! I am a telegram bot and I can notify you about all changes" +
-		" in any json data fields by url, if url unavailable " +
-		"I'll let you know." +
-		"All commands in bot:\n\n/start - start bot" +
-		"\n\n/help - show commands\n\n/list - show list" +
-		" with your subscriptions.\n\n" +
-		"/subscribe url duration json-key.nested-key,second-key - " +
-		"subscribe\n\nExample: / subscribe http://time.jsontest.com/ 1h date,time\n\n" +
-		"/unsubscribe subscriptionID - unsubscribe from one selected " +
-		"subscription\n\nExample: /unsubscribe 5e7891f34940ad7f3746e2dd\n\n" +
-		"/stop - unsubscribe from all subscriptions"
+	text := coordinator.getHelpText(coordinator.getLocale(message))
 
 	var recipient telebot.Recipient
 	var recipientID int
@@ -66,7 +104,13 @@ func (coordinator *Coordinator) start(message *tb.Message) error {
 		recipientID = message.Sender.ID
 	}
 
-	err := coordinator.transport.SendMessage(recipient, text)
+	err := coordinator.database.enableSubscriptions(int64(recipientID))
+	if err != nil {
+		return karma.Format(err, "unable to enable subscriptions of user: %d",
+			recipientID)
+	}
+
+	err = coordinator.transport.SendMessage(recipient, text)
 	if err != nil {
 		return karma.Format(err, "unable to send message to user: %d ",
 			recipientID)
@@ -75,17 +119,89 @@ func (coordinator *Coordinator) start(message *tb.Message) error {
 	return nil
 }
 
+func getRecipientID(message *tb.Message) int {
+	if message.Chat != nil {
+		return int(message.Chat.ID)
+	}
+
+	return message.Sender.ID
+}
+
+// parseArgs parses arguments of the command, there can be at most max
+// positional arguments and only the given options. Invalid arguments are
+// reported to the chat and nil is returned.
+func (coordinator *Coordinator) parseArgs(
+	message *tb.Message,
+	max int,
+	options ...string,
+) (*args.Args, error) {
+	arguments, err := args.Parse(message.Payload)
+	if err == nil {
+		err = arguments.Check(max, options...)
+	}
+
+	if err != nil {
+		invalid, ok := err.(*args.Error)
+		if !ok {
+			return nil, err
+		}
+
+		return nil, coordinator.replyArgsError(message, invalid)
+	}
+
+	return &arguments, nil
+}
+
+// replyArgsError tells which argument of the command is invalid.
+func (coordinator *Coordinator) replyArgsError(
+	message *tb.Message,
+	invalid *args.Error,
+) error {
+	locale := coordinator.getLocale(message)
+
+	return coordinator.sendReply(
+		message,
+		locale.Sprintf(
+			"Invalid arguments, %s: %s",
+			locale.Translate(invalid.Reason),
+			invalid.Token,
+		),
+	)
+}
+
+func (coordinator *Coordinator) sendReply(message *tb.Message, text string) error {
+	var recipient telebot.Recipient
+	if message.Chat != nil {
+		recipient = message.Chat
+	} else {
+		recipient = message.Sender
+	}
+
+	err := coordinator.transport.SendMessage(recipient, text)
+	if err != nil {
+		return karma.Format(err, "unable to send message to user: %d ",
+			getRecipientID(message))
+	}
+
+	return nil
+}
+
 func (coordinator *Coordinator) createFirstMessageAfterSubscribe(
 	subscriber *Subscriber,
+	locale i18n.Locale,
 ) ([]string, error) {
 	url := subscriber.URL
-	keys := strings.Split(subscriber.Keys, ",")
-	data, err := getJSON(url)
-	if err != nil {
-		if err == errorResponse {
-			return nil, errorResponse
-		}
+	if subscriber.Kind == SubscriptionUptime {
+		return coordinator.createFirstUptimeMessage(subscriber, locale)
+	}
 
+	keys := subscriber.Keys
+	data, err := coordinator.fetcher.getJSON(
+		coordinator.context,
+		url,
+		subscriber.Trusted,
+	)
+	if err != nil {
 		return nil, err
 	}
 
@@ -103,7 +219,7 @@ func (coordinator *Coordinator) createFirstMessageAfterSubscribe(
 			continue
 		}
 
-		preparedMessage := printer.String(record)
+		preparedMessage := coordinator.newPrinter(locale).String(record)
 		if isAddedID == false {
 			notification = fmt.Sprintf(
 				"ID - %s\n\n%v",
@@ -125,7 +241,38 @@ func (coordinator *Coordinator) createFirstMessageAfterSubscribe(
 }
 
 func (coordinator *Coordinator) subscribe(message *tb.Message) error {
-	payload := strings.Split(message.Payload, " ")
+	arguments, err := coordinator.parseArgs(message, 3)
+	if arguments == nil {
+		return err
+	}
+
+	if len(arguments.Positional) != 3 {
+		return coordinator.sendReply(
+			message,
+			coordinator.getLocale(message).Translate(
+				"Data required!\n"+
+					"In format:  /subscribe url duration "+
+					"json-key.nested-key,second-key",
+			),
+		)
+	}
+
+	return coordinator.createSubscription(
+		message,
+		arguments.Get(0),
+		arguments.Get(1),
+		arguments.Get(2),
+		"",
+	)
+}
+
+func (coordinator *Coordinator) createSubscription(
+	message *tb.Message,
+	endpointURL string,
+	duration string,
+	keys string,
+	kind string,
+) error {
 	senderID := message.Sender.ID
 	sender := message.Sender
 	var chat *tb.Chat
@@ -145,26 +292,12 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 		recipient = message.Sender
 	}
 
-	if len(payload) != 3 {
-		text := "Data required!\n" +
-			"In format:  /subscribe url duration json-key.nested-key,second-key"
-		err := coordinator.transport.SendMessage(recipient, text)
-		if err != nil {
-			return karma.Format(err, "unable to send message to user")
-		}
-
-		return nil
-	}
+	locale := coordinator.getLocale(message)
 
-	var (
-		err         error
-		endpointURL = payload[0]
-		duration    = payload[1]
-		keys        = payload[2]
-	)
+	var err error
 
 	if !isValidURL(endpointURL) {
-		errMessage := "You wrote the wrong url"
+		errMessage := locale.Translate("You wrote the wrong url")
 		err = coordinator.transport.SendMessage(recipient, errMessage)
 		if err != nil {
 			return karma.Format(err, "unable to send message to user")
@@ -173,9 +306,20 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 		return nil
 	}
 
+	trusted := coordinator.isBotAdmin(message.Sender.ID)
+	if !trusted {
+		err = coordinator.fetcher.checkURL(coordinator.context, endpointURL)
+		if err != nil {
+			return coordinator.sendReply(
+				message,
+				locale.Sprintf("This url is not allowed: %s", err),
+			)
+		}
+	}
+
 	refreshDuration, err := time.ParseDuration(duration)
 	if err != nil {
-		errMessage := "Your write incorrect duration"
+		errMessage := locale.Translate("Your write incorrect duration")
 		err = coordinator.transport.SendMessage(recipient, errMessage)
 		if err != nil {
 			return karma.Format(err, "unable to send message to user")
@@ -183,21 +327,25 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 		return nil
 	}
 
+	if !trusted {
+		err = coordinator.checkInterval(refreshDuration)
+		if err != nil {
+			return coordinator.sendReply(
+				message,
+				locale.Sprintf("Sorry, %s", localizeError(locale, err)),
+			)
+		}
+	}
+
 	subscriber := Subscriber{
 		URL:      endpointURL,
 		UserID:   senderID,
 		Duration: refreshDuration,
 		Sender:   sender,
 		Chat:     chat,
-		Keys:     keys,
-	}
-
-	endpoint := &Endpoint{
-		URL:       endpointURL,
-		Duration:  refreshDuration,
-		RefreshAt: time.Now(),
-		Response:  true,
-		UpdatedAt: time.Now(),
+		Keys:     parseKeys(keys),
+		Kind:     kind,
+		Trusted:  trusted,
 	}
 
 	foundSubscriber, err := coordinator.database.findSubscriber(
@@ -213,22 +361,21 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 
 	switch foundSubscriber {
 	case nil:
-		err = coordinator.database.upsertSubscriber(subscriber)
+		err = coordinator.checkSubscriptionsQuota([]Subscriber{subscriber})
 		if err != nil {
-			return karma.Format(
-				err,
-				"unable to upsert subsrciber, subscriber_id: %d",
-				subscriber.UserID,
-			)
+			if _, ok := err.(validationError); ok {
+				return coordinator.sendReply(
+					message,
+					locale.Sprintf("Sorry, %s", localizeError(locale, err)),
+				)
+			}
+
+			return err
 		}
 
-		err = coordinator.database.writeEndpoint(endpoint)
+		err = coordinator.saveSubscription(subscriber)
 		if err != nil {
-			return karma.Format(
-				err,
-				"unable to upsert endpoint, endpoint_url: %s",
-				endpoint.URL,
-			)
+			return err
 		}
 
 		foundSubscriber, err := coordinator.database.findSubscriber(
@@ -243,23 +390,28 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 		}
 
 		var message []string
-		message, err = coordinator.createFirstMessageAfterSubscribe(foundSubscriber)
-		if err != nil && err != errorResponse {
-			return karma.Format(
+		message, err = coordinator.createFirstMessageAfterSubscribe(
+			foundSubscriber,
+			locale,
+		)
+		// fetch errors are shown to the user, the subscription is kept
+		// and checked again later
+		if certificateErr, ok := err.(*CertificateError); ok {
+			message = []string{"\n" + locale.Sprintf(
+				"TLS certificate is invalid!\n\n%s",
+				certificateErr,
+			)}
+		} else if err != nil {
+			message = []string{"\n" + locale.Sprintf(
+				"URL is unavailable!\n\nReason: %s",
 				err,
-				"unable to getfirst data after subscribe: %s",
-				endpoint.URL,
-			)
-		}
-
-		if err == errorResponse {
-			message = []string{"\nURL is unavailable!"}
+			)}
 		}
 
 		err = coordinator.transport.SendMessage(
 			recipient,
-			"You successfully subscribed!\n"+strings.Join(
-				message, "\n\n"),
+			locale.Translate("You successfully subscribed!")+"\n"+
+				strings.Join(message, "\n\n"),
 		)
 
 		if err != nil {
@@ -271,10 +423,22 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 		}
 
 	default:
+		if foundSubscriber.Managed {
+			return coordinator.sendReply(
+				message,
+				locale.Translate(
+					"This subscription is managed by the configuration file and "+
+						"can't be changed",
+				),
+			)
+		}
+
 		if foundSubscriber.Duration == refreshDuration {
 			err = coordinator.transport.SendMessage(
 				recipient,
-				"You have already subscribed on this URL with same duration",
+				locale.Translate(
+					"You have already subscribed on this URL with same duration",
+				),
 			)
 			if err != nil {
 				return karma.Format(
@@ -284,27 +448,14 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 				)
 			}
 		} else {
-			err = coordinator.database.upsertSubscriber(subscriber)
+			err = coordinator.saveSubscription(subscriber)
 			if err != nil {
-				return karma.Format(
-					err,
-					"unable to upsert subsrciber, subscriber_id: %d",
-					subscriber.UserID,
-				)
-			}
-
-			err = coordinator.database.writeEndpoint(endpoint)
-			if err != nil {
-				return karma.Format(
-					err,
-					"unable to upsert endpoint, endpoint_url: %s",
-					endpoint.URL,
-				)
+				return err
 			}
 
 			err = coordinator.transport.SendMessage(
 				recipient,
-				"Duration was successfully updated",
+				locale.Translate("Duration was successfully updated"),
 			)
 			if err != nil {
 				return karma.Format(
@@ -319,10 +470,138 @@ func (coordinator *Coordinator) subscribe(message *tb.Message) error {
 	return nil
 }
 
-func (coordinator *Coordinator) stop(message *tb.Message) error {
+// validationError describes why a subscription can't be saved, its text is
+// shown to the user. The format is kept to translate the text for chats.
+type validationError struct {
+	format string
+	args   []interface{}
+}
+
+func newValidationError(format string, args ...interface{}) validationError {
+	return validationError{format: format, args: args}
+}
+
+func (err validationError) Error() string {
+	return fmt.Sprintf(err.format, err.args...)
+}
+
+func (err validationError) localize(locale i18n.Locale) string {
+	return locale.Sprintf(err.format, err.args...)
+}
+
+// prepareSubscription validates the subscription given via api or import
+// and sets its duration, webhook subscriptions get a new url if it's empty.
+func (coordinator *Coordinator) prepareSubscription(
+	subscriber *Subscriber,
+	duration string,
+) error {
 	var err error
-	var resultsOfUser []Subscriber
-	var resultsDB []Subscriber
+
+	switch subscriber.Kind {
+	case "", SubscriptionUptime:
+		if !isValidURL(subscriber.URL) {
+			return newValidationError("invalid url")
+		}
+
+		if !subscriber.Trusted {
+			err := coordinator.fetcher.checkURL(
+				coordinator.context,
+				subscriber.URL,
+			)
+			if err != nil {
+				return newValidationError("%s", err)
+			}
+		}
+	case SubscriptionWebhook:
+		if subscriber.URL == "" {
+			subscriber.URL, err = newWebhookURL()
+			if err != nil {
+				return err
+			}
+		}
+
+		if !strings.HasPrefix(subscriber.URL, webhookScheme) {
+			return newValidationError("invalid webhook url")
+		}
+
+		// pushed data is checked on every iteration
+		if duration == "" {
+			duration = "0s"
+		}
+	default:
+		return newValidationError("unknown kind")
+	}
+
+	if subscriber.Kind != SubscriptionUptime && len(subscriber.Keys) == 0 {
+		return newValidationError("keys are required")
+	}
+
+	subscriber.Duration, err = time.ParseDuration(duration)
+	if err != nil {
+		return newValidationError("invalid duration")
+	}
+
+	if subscriber.Kind != SubscriptionWebhook && !subscriber.Trusted {
+		err = coordinator.checkInterval(subscriber.Duration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveSubscription writes the subscriber and creates the endpoint it needs,
+// it's used by both bot commands and the http api.
+func (coordinator *Coordinator) saveSubscription(subscriber Subscriber) error {
+	now := coordinator.clock.Now()
+
+	subscriber.SendAt = now.Add(subscriber.Duration)
+
+	err := coordinator.database.upsertSubscriber(subscriber)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to upsert subsrciber, subscriber_id: %d",
+			subscriber.UserID,
+		)
+	}
+
+	endpoint := &Endpoint{
+		URL:       subscriber.URL,
+		Duration:  subscriber.Duration,
+		RefreshAt: now,
+		Response:  true,
+		UpdatedAt: now,
+		Webhook:   subscriber.Kind == SubscriptionWebhook,
+		Trusted:   subscriber.Trusted,
+	}
+
+	err = coordinator.database.writeEndpoint(endpoint)
+	if err != nil {
+		return karma.Format(
+			err,
+			"unable to upsert endpoint, endpoint_url: %s",
+			endpoint.URL,
+		)
+	}
+
+	// the endpoint may already exist for subscriptions of other users
+	if subscriber.Trusted {
+		err = coordinator.database.trustEndpoint(endpoint.URL, endpoint.Duration)
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to trust endpoint, endpoint_url: %s",
+				endpoint.URL,
+			)
+		}
+	}
+
+	return nil
+}
+
+func (coordinator *Coordinator) stop(message *tb.Message) error {
 
 	var recipient telebot.Recipient
 	var recipientID int
@@ -336,18 +615,18 @@ func (coordinator *Coordinator) stop(message *tb.Message) error {
 
 	}
 
-	findURL := bson.M{"userid": recipientID}
-	cursorURL, _ := coordinator.database.Subscriptions.Find(
-		coordinator.database.context,
-		findURL,
-	)
-	err = cursorURL.All(coordinator.database.context, &resultsOfUser)
+	locale := coordinator.getLocale(message)
+
+	resultsOfUser, err := coordinator.database.findChatSubscriptions(recipientID)
 	if err != nil {
-		return karma.Format(err, "unable to decode data")
+		return karma.Format(err, "unable to find subscriptions")
 	}
 
 	if len(resultsOfUser) == 0 {
-		err = coordinator.transport.SendMessage(recipient, "You don't have any subscriptions")
+		err = coordinator.transport.SendMessage(
+			recipient,
+			locale.Translate("You don't have any subscriptions"),
+		)
 		if err != nil {
 			return karma.Format(err, "unable to send message to user: %d ",
 				recipientID)
@@ -356,46 +635,45 @@ func (coordinator *Coordinator) stop(message *tb.Message) error {
 		return nil
 	}
 
-	searchForMatches := bson.M{
-		"url":    bson.M{"$exists": true, "$ne": nil},
-		"userid": bson.M{"$ne": recipientID},
-	}
-
-	cursorSub, err := coordinator.database.Subscriptions.Find(
-		coordinator.database.context,
-		searchForMatches,
-	)
+	shared, err := coordinator.database.hasOtherChatsSubscriptions(recipientID)
 	if err != nil {
-		return karma.Format(err, "unable to find in database")
+		return karma.Format(err, "unable to find subscriptions of other chats")
 	}
 
-	err = cursorSub.All(coordinator.database.context, &resultsDB)
-	if err != nil {
-		return karma.Format(err, "unable to decode data")
+	managed := 0
+	for _, result := range resultsOfUser {
+		if result.Managed {
+			managed++
+		}
 	}
 
-	if len(resultsDB) == 0 {
+	if !shared {
 		for _, result := range resultsOfUser {
-			endpointsFilter := bson.M{"url": result.URL}
-			_, err = coordinator.database.Endpoints.DeleteMany(
-				coordinator.database.context,
-				endpointsFilter,
-			)
+			if result.Managed {
+				continue
+			}
+
+			err = coordinator.database.removeEndpointsByURL(result.URL)
 			if err != nil {
-				return karma.Format(err, "unable to delete data in collection")
+				return karma.Format(err, "unable to delete endpoints")
 			}
 		}
 	}
 
-	_, err = coordinator.database.Subscriptions.DeleteMany(
-		coordinator.database.context,
-		findURL,
-	)
+	err = coordinator.database.removeChatSubscriptions(recipientID)
 	if err != nil {
-		return karma.Format(err, "unable to delete data in collection")
+		return karma.Format(err, "unable to delete subscriptions")
+	}
+
+	textmessage := locale.Translate("All notifications stopped")
+	if managed > 0 {
+		textmessage = locale.Sprintf(
+			"All notifications stopped except %d managed by the "+
+				"configuration file",
+			managed,
+		)
 	}
 
-	textmessage := "All notifications stopped"
 	err = coordinator.transport.SendMessage(recipient, textmessage)
 	if err != nil {
 		return karma.Format(
@@ -426,22 +704,19 @@ func (coordinator *Coordinator) list(message *tb.Message) error {
 
 	}
 
-	filter := bson.M{"userid": recipientID}
-
-	var results []Subscriber
-	cursor, err := coordinator.database.Subscriptions.Find(coordinator.database.context, filter)
-	if err != nil {
-		return karma.Format(err, "unable to find data in Subscription collection ")
-	}
+	locale := coordinator.getLocale(message)
 
-	err = cursor.All(coordinator.database.context, &results)
+	results, err := coordinator.database.findChatSubscriptions(recipientID)
 	if err != nil {
-		return karma.Format(err, "unable to decode data")
+		return karma.Format(err, "unable to find subscriptions")
 	}
 
 	var text []string
 	if len(results) == 0 {
-		err = coordinator.transport.SendMessage(recipient, "You don't have any subscriptions")
+		err = coordinator.transport.SendMessage(
+			recipient,
+			locale.Translate("You don't have any subscriptions"),
+		)
 		if err != nil {
 			return karma.Format(
 				err,
@@ -454,17 +729,48 @@ func (coordinator *Coordinator) list(message *tb.Message) error {
 	}
 
 	for _, res := range results {
-		text = append(text, fmt.Sprintf(
+		item := locale.Sprintf(
 			"\nID - %s\nURL - %s\nDURATION - %s\nJSON KEY - %v",
 			res.ID.Hex(),
-			res.URL,
+			coordinator.getSubscriptionURL(res),
 			res.Duration.String(),
-			res.Keys,
-		))
+			strings.Join(res.Keys, ","),
+		)
+		if res.Kind != "" {
+			item += locale.Sprintf("\nKIND - %s", res.Kind)
+		}
+
+		// webhook subscriptions are checked when data is pushed
+		if res.Kind != SubscriptionWebhook && !res.Paused {
+			item += locale.Sprintf(
+				"\nNEXT CHECK - %s",
+				locale.FormatTime(res.SendAt),
+			)
+		}
+
+		if !res.UpdatedAt.IsZero() {
+			item += locale.Sprintf(
+				"\nLAST CHANGE - %s",
+				locale.FormatTime(res.UpdatedAt),
+			)
+		}
+
+		if res.Paused {
+			item += locale.Translate("\nPAUSED")
+		}
+
+		if res.Disabled {
+			item += locale.Sprintf("\nDISABLED - %s", res.DisabledReason)
+		}
+
+		text = append(text, item)
 	}
 
 	textmessage := strings.Join(text, "\n")
-	err = coordinator.transport.SendMessage(recipient, "\nMy subscriptions:\n"+textmessage)
+	err = coordinator.transport.SendMessage(
+		recipient,
+		locale.Translate("\nMy subscriptions:\n")+textmessage,
+	)
 	if err != nil {
 		return karma.Format(err, "unable to send message to user: %d ",
 			recipientID,
@@ -475,9 +781,10 @@ func (coordinator *Coordinator) list(message *tb.Message) error {
 }
 
 func (coordinator *Coordinator) unsubscribe(message *tb.Message) error {
-	var err error
-	var resultsDB []Subscriber
-	var resultsOfUser []Subscriber
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
 
 	var recipient telebot.Recipient
 	var recipientID int
@@ -491,22 +798,19 @@ func (coordinator *Coordinator) unsubscribe(message *tb.Message) error {
 
 	}
 
-	subscritptionID, _ := primitive.ObjectIDFromHex(string(message.Payload))
-	findSub := bson.M{
-		"_id":    subscritptionID,
-		"userid": recipientID,
-	}
+	locale := coordinator.getLocale(message)
+
+	subscritptionID, _ := primitive.ObjectIDFromHex(arguments.Get(0))
 
-	cursorURL, _ := coordinator.database.Subscriptions.Find(coordinator.database.context, findSub)
-	err = cursorURL.All(coordinator.database.context, &resultsOfUser)
+	subscriber, err := coordinator.database.getSubscription(subscritptionID)
 	if err != nil {
-		return karma.Format(err, "unable to decode data")
+		return karma.Format(err, "unable to find subscription")
 	}
 
-	if len(resultsOfUser) == 0 {
+	if subscriber == nil || subscriber.UserID != recipientID {
 		err = coordinator.transport.SendMessage(
 			recipient,
-			"You don't have subscription with this id",
+			locale.Translate("You don't have subscription with this id"),
 		)
 		if err != nil {
 			return karma.Format(err, "unable to send message to user: %d ",
@@ -516,41 +820,42 @@ func (coordinator *Coordinator) unsubscribe(message *tb.Message) error {
 		return karma.Format(err, "no this subscription in database")
 	}
 
-	searchForMatches := bson.M{
-		"url":    bson.M{"$exists": true, "$ne": nil},
-		"userid": bson.M{"$ne": recipientID},
+	if subscriber.Managed {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"This subscription is managed by the configuration file "+
+					"and can't be removed",
+			),
+		)
 	}
 
-	cursorSub, _ := coordinator.database.Subscriptions.Find(coordinator.database.context,
-		searchForMatches)
-	err = cursorSub.All(coordinator.database.context, &resultsDB)
+	shared, err := coordinator.database.hasOtherChatsSubscriptions(recipientID)
 	if err != nil {
-		return karma.Format(err, "unable to decode data")
+		return karma.Format(err, "unable to find subscriptions of other chats")
 	}
 
-	deletingEndpoints := bson.M{"url": resultsOfUser[0].URL}
-	if len(resultsDB) == 0 {
-		_, err = coordinator.database.Endpoints.DeleteMany(coordinator.database.context,
-			deletingEndpoints)
+	if !shared {
+		err = coordinator.database.removeEndpointsByURL(subscriber.URL)
 		if err != nil {
-			return karma.Format(err, "unable to delete data in collection")
+			return karma.Format(err, "unable to delete endpoints")
 		}
 	}
 
-	_, err = coordinator.database.Subscriptions.DeleteOne(coordinator.database.context, findSub)
+	err = coordinator.database.RemoveSubscription(subscriber.ID)
 	if err != nil {
-		return karma.Format(err, "unable to delete data in collection")
+		return karma.Format(err, "unable to delete subscription")
 	}
 
 	var messageWithData []string
 
-	notification := fmt.Sprintf(
-		"ID - %s\nURL - %s\nJSON KEY - %s\n\n",
-		message.Payload,
-		resultsOfUser[0].URL,
-		resultsOfUser[0].Keys,
+	notification := locale.Sprintf(
+		"Unsubscribed:\nID - %s\nURL - %s\nJSON KEY - %s\n\n",
+		subscriber.ID.Hex(),
+		subscriber.URL,
+		strings.Join(subscriber.Keys, ","),
 	)
-	messageWithData = append(messageWithData, "Unsubscribed:\n"+notification)
+	messageWithData = append(messageWithData, notification)
 	err = coordinator.transport.SendMessage(
 		recipient,
 		strings.Join(
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reconquest/notify-telegram-bot/internal/i18n"
+
+	karma "github.com/reconquest/karma-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// values are truncated to fit into a single message, Telegram rejects
+// messages longer than 4096 characters and headers need some room too
+const maxValuesLength = 3500
+
+// fetchCooldowns remembers when chats requested urls on demand, so /peek and
+// /keys can't request a url more often than subscriptions are allowed to.
+type fetchCooldowns struct {
+	mutex     sync.Mutex
+	requested map[string]time.Time
+}
+
+func newFetchCooldowns() *fetchCooldowns {
+	return &fetchCooldowns{
+		requested: map[string]time.Time{},
+	}
+}
+
+// wait returns how long the chat should wait before requesting the url
+// again, zero means the request is allowed and it's remembered.
+func (cooldowns *fetchCooldowns) wait(
+	chatID int,
+	url string,
+	now time.Time,
+	cooldown time.Duration,
+) time.Duration {
+	cooldowns.mutex.Lock()
+	defer cooldowns.mutex.Unlock()
+
+	for key, requestedAt := range cooldowns.requested {
+		if now.Sub(requestedAt) >= cooldown {
+			delete(cooldowns.requested, key)
+		}
+	}
+
+	key := strconv.Itoa(chatID) + " " + url
+	if requestedAt, ok := cooldowns.requested[key]; ok {
+		return cooldown - now.Sub(requestedAt)
+	}
+
+	cooldowns.requested[key] = now
+
+	return 0
+}
+
+// formatKeyValues writes values of the keys as "key: value" lines, keys
+// which are missing in data are listed after them.
+func (coordinator *Coordinator) formatKeyValues(
+	locale i18n.Locale,
+	data map[string]interface{},
+	keys []string,
+) string {
+	values := map[string]interface{}{}
+	var missing []string
+	for _, key := range keys {
+		value, err := getValueByKey(data, strings.Split(key, "."))
+		if err != nil || value == nil {
+			missing = append(missing, key)
+			continue
+		}
+
+		values[key] = value
+	}
+
+	var text []string
+	if len(values) > 0 {
+		text = append(text, coordinator.newPrinter(locale).String(values))
+	}
+
+	if len(missing) > 0 {
+		text = append(
+			text,
+			locale.Sprintf("NOT FOUND - %s", strings.Join(missing, ", ")),
+		)
+	}
+
+	return truncate(strings.Join(text, "\n\n"), maxValuesLength)
+}
+
+// get shows the latest data of the subscription's keys which was received
+// from its url.
+func (coordinator *Coordinator) get(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+
+	subscriptionID, err := primitive.ObjectIDFromHex(arguments.Get(0))
+	if err != nil {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"Subscription ID required!\nIn format:  /get subscriptionID",
+			),
+		)
+	}
+
+	subscriber, err := coordinator.database.getSubscription(subscriptionID)
+	if err != nil {
+		return karma.Format(err, "unable to find subscription")
+	}
+
+	if subscriber == nil || subscriber.UserID != getRecipientID(message) {
+		return coordinator.sendReply(
+			message,
+			locale.Translate("You don't have subscription with this id"),
+		)
+	}
+
+	if len(subscriber.Keys) == 0 {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"This subscription doesn't have json keys, use /status to "+
+					"see the state of its url",
+			),
+		)
+	}
+
+	endpoint, err := coordinator.database.findSubscriberEndpoint(*subscriber)
+	if err != nil {
+		return karma.Format(err, "unable to find endpoint")
+	}
+
+	text := []string{
+		"ID - " + subscriber.ID.Hex() + "\nURL - " + subscriber.URL,
+	}
+
+	if endpoint == nil || endpoint.Data == nil {
+		text = append(text, locale.Translate("No data was received yet"))
+	} else {
+		text = append(
+			text,
+			coordinator.formatKeyValues(locale, endpoint.Data, subscriber.Keys),
+		)
+	}
+
+	return coordinator.sendReply(message, strings.Join(text, "\n\n"))
+}
+
+// fetchChatJSON requests the url given in the chat, the url is checked by
+// the fetch policy and the chat's cooldown unless it's trusted. Invalid
+// urls and fetch errors are reported to the chat and nil is returned.
+func (coordinator *Coordinator) fetchChatJSON(
+	message *tb.Message,
+	locale i18n.Locale,
+	url string,
+	trusted bool,
+) (map[string]interface{}, error) {
+	if !isValidURL(url) {
+		return nil, coordinator.sendReply(
+			message,
+			locale.Translate("You wrote the wrong url"),
+		)
+	}
+
+	if !trusted {
+		err := coordinator.fetcher.checkURL(coordinator.context, url)
+		if err != nil {
+			return nil, coordinator.sendReply(
+				message,
+				locale.Sprintf("This url is not allowed: %s", err),
+			)
+		}
+	}
+
+	if !trusted {
+		wait := coordinator.fetchCooldowns.wait(
+			getRecipientID(message),
+			url,
+			coordinator.clock.Now(),
+			coordinator.config.Quota.MinInterval.Duration,
+		)
+		if wait > 0 {
+			return nil, coordinator.sendReply(
+				message,
+				locale.Sprintf(
+					"This url was requested recently, try again in %s",
+					time.Duration(math.Ceil(wait.Seconds()))*time.Second,
+				),
+			)
+		}
+	}
+
+	data, err := coordinator.fetcher.getJSON(coordinator.context, url, trusted)
+	if certificateErr, ok := err.(*CertificateError); ok {
+		return nil, coordinator.sendReply(
+			message,
+			locale.Sprintf("TLS certificate is invalid!\n\n%s", certificateErr),
+		)
+	} else if err != nil {
+		return nil, coordinator.sendReply(
+			message,
+			locale.Sprintf("URL is unavailable!\n\nReason: %s", err),
+		)
+	}
+
+	// json null decodes to a nil map
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	return data, nil
+}
+
+// peek requests the url once and shows values of the keys or top-level keys
+// of the response, nothing is saved.
+func (coordinator *Coordinator) peek(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 2)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+
+	url := arguments.Get(0)
+	if url == "" {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"Data required!\nIn format:  /peek url "+
+					"[json-key.nested-key,second-key]",
+			),
+		)
+	}
+
+	data, err := coordinator.fetchChatJSON(
+		message,
+		locale,
+		url,
+		coordinator.isBotAdmin(message.Sender.ID),
+	)
+	if data == nil {
+		return err
+	}
+
+	if keys := arguments.Get(1); keys != "" {
+		return coordinator.sendReply(
+			message,
+			coordinator.formatKeyValues(locale, data, parseKeys(keys)),
+		)
+	}
+
+	if len(data) == 0 {
+		return coordinator.sendReply(
+			message,
+			locale.Translate("The response is an empty json object"),
+		)
+	}
+
+	var keys []string
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return coordinator.sendReply(
+		message,
+		locale.Sprintf(
+			"KEYS:\n%s\n\nSend /peek url key to see its value, nested "+
+				"keys are separated by dots",
+			truncate(strings.Join(keys, "\n"), maxValuesLength),
+		),
+	)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Coordinator_ShowsCurrentValues(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprint(
+				writer,
+				`{"status": "ok", "build": {"version": "1.2"}, "count": 3}`,
+			)
+		},
+	))
+	defer server.Close()
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	message := createMessage(server.URL, "10s", "status,build.version,missing", 1, 2)
+
+	err = coordinator.subscribe(message)
+	assert.NoError(t, err)
+
+	subscribers, err := coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+
+	id := subscribers[0].ID.Hex()
+
+	message.Payload = id
+	err = coordinator.get(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"ID - "+id+"\nURL - "+server.URL+"\n\nNo data was received yet",
+		telegramBot.lastSentMessage,
+	)
+
+	clock.Advance(time.Second)
+	err = coordinator.routineUpdateEndpoints()
+	assert.NoError(t, err)
+
+	err = coordinator.get(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"ID - "+id+"\nURL - "+server.URL+"\n\n"+
+			"build.version: 1.2\nstatus: ok\n\nNOT FOUND - missing",
+		telegramBot.lastSentMessage,
+	)
+
+	other := createMessage("", "", "", 3, 4)
+	other.Payload = id
+	err = coordinator.get(other)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"You don't have subscription with this id",
+		telegramBot.lastSentMessage,
+	)
+
+	message.Payload = server.URL
+	err = coordinator.peek(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"KEYS:\nbuild\ncount\nstatus\n\n"+
+			"Send /peek url key to see its value, nested keys are "+
+			"separated by dots",
+		telegramBot.lastSentMessage,
+	)
+
+	// the url can't be requested again until the interval passes
+	message.Payload = server.URL + " build,count"
+	err = coordinator.peek(message)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"This url was requested recently, try again in 1s",
+		telegramBot.lastSentMessage,
+	)
+
+	clock.Advance(time.Second)
+	err = coordinator.peek(message)
+	assert.NoError(t, err)
+	assert.Equal(t, "build: version: 1.2\ncount: 3", telegramBot.lastSentMessage)
+
+	// peek doesn't create subscriptions
+	subscribers, err = coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+}
+
+func Test_Coordinator_TruncatesLongValues(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			fmt.Fprintf(
+				writer,
+				`{"log": "%s", "%s": 1}`,
+				strings.Repeat("x", 5000),
+				strings.Repeat("k", 5000),
+			)
+		},
+	))
+	defer server.Close()
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = server.URL + " log"
+	err = coordinator.peek(message)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(telegramBot.lastSentMessage, "log: xxx"))
+	assert.True(t, strings.HasSuffix(telegramBot.lastSentMessage, "x…"))
+	assert.Len(t, []rune(telegramBot.lastSentMessage), maxValuesLength+1)
+
+	clock.Advance(time.Second)
+	message.Payload = server.URL
+	err = coordinator.peek(message)
+	assert.NoError(t, err)
+	assert.True(t, len([]rune(telegramBot.lastSentMessage)) < 4096)
+}
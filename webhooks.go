@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	karma "github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// SubscriptionWebhook is a kind of subscription which receives data
+	// pushed to the bot instead of polling the url.
+	SubscriptionWebhook = "webhook"
+
+	// webhook subscriptions are stored with url in this scheme, the public
+	// address is added only when the url is shown to the user
+	webhookScheme = "webhook://"
+)
+
+// endpointLocks serializes pushes to the same webhook, every push moves
+// current data to previous and is compared with it before the next one.
+type endpointLocks struct {
+	mutex sync.Mutex
+	locks map[primitive.ObjectID]*endpointLock
+}
+
+type endpointLock struct {
+	sync.Mutex
+	waiting int
+}
+
+func newEndpointLocks() *endpointLocks {
+	return &endpointLocks{
+		locks: map[primitive.ObjectID]*endpointLock{},
+	}
+}
+
+// lock locks the endpoint and returns the function which unlocks it.
+func (locks *endpointLocks) lock(id primitive.ObjectID) func() {
+	locks.mutex.Lock()
+	lock, ok := locks.locks[id]
+	if !ok {
+		lock = &endpointLock{}
+		locks.locks[id] = lock
+	}
+
+	lock.waiting++
+	locks.mutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		locks.mutex.Lock()
+		defer locks.mutex.Unlock()
+
+		lock.waiting--
+		if lock.waiting == 0 {
+			delete(locks.locks, id)
+		}
+	}
+}
+
+func newWebhookURL() (string, error) {
+	secret := make([]byte, 24)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", karma.Format(err, "unable to generate webhook secret")
+	}
+
+	return webhookScheme + hex.EncodeToString(secret), nil
+}
+
+// getSubscriptionURL returns url of the subscription as it should be shown
+// to the user.
+func (coordinator *Coordinator) getSubscriptionURL(subscriber Subscriber) string {
+	if !strings.HasPrefix(subscriber.URL, webhookScheme) {
+		return subscriber.URL
+	}
+
+	return strings.TrimSuffix(coordinator.config.HTTP.PublicURL, "/") +
+		"/webhooks/" + strings.TrimPrefix(subscriber.URL, webhookScheme)
+}
+
+func (coordinator *Coordinator) webhook(message *tb.Message) error {
+	arguments, err := coordinator.parseArgs(message, 1)
+	if arguments == nil {
+		return err
+	}
+
+	locale := coordinator.getLocale(message)
+
+	if coordinator.config.HTTP.PublicURL == "" {
+		return coordinator.sendReply(
+			message,
+			locale.Translate("Webhooks are not configured"),
+		)
+	}
+
+	keys := arguments.Get(0)
+	if keys == "" {
+		return coordinator.sendReply(
+			message,
+			locale.Translate(
+				"Data required!\n"+
+					"In format:  /webhook json-key.nested-key,second-key",
+			),
+		)
+	}
+
+	url, err := newWebhookURL()
+	if err != nil {
+		return err
+	}
+
+	subscriber := Subscriber{
+		URL:     url,
+		UserID:  getRecipientID(message),
+		Keys:    parseKeys(keys),
+		Kind:    SubscriptionWebhook,
+		Trusted: coordinator.isBotAdmin(message.Sender.ID),
+	}
+
+	if validateIsChatID(message) != 0 {
+		subscriber.Chat = message.Chat
+	} else {
+		subscriber.Sender = message.Sender
+	}
+
+	err = coordinator.checkSubscriptionsQuota([]Subscriber{subscriber})
+	if err != nil {
+		if _, ok := err.(validationError); ok {
+			return coordinator.sendReply(
+				message,
+				locale.Sprintf("Sorry, %s", localizeError(locale, err)),
+			)
+		}
+
+		return err
+	}
+
+	err = coordinator.saveSubscription(subscriber)
+	if err != nil {
+		return err
+	}
+
+	saved, err := coordinator.database.findSubscriber(
+		subscriber.UserID,
+		subscriber.URL,
+	)
+	if err != nil {
+		return karma.Format(err, "unable to find subscriber in the database")
+	}
+
+	return coordinator.sendReply(
+		message,
+		locale.Sprintf(
+			"You successfully subscribed!\n\n"+
+				"ID - %s\n\n"+
+				"POST json data to:\n%s\n\n"+
+				"The first request is used as a baseline, "+
+				"you'll be notified about changes in the next ones.",
+			saved.ID.Hex(),
+			coordinator.getSubscriptionURL(*saved),
+		),
+	)
+}
+
+// serveWebhook accepts json pushed to /webhooks/<secret> and passes it to
+// the same pipeline as polled data.
+func (coordinator *Coordinator) serveWebhook(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	if request.Method != http.MethodPost {
+		writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	secret := strings.Trim(strings.TrimPrefix(request.URL.Path, "/webhooks/"), "/")
+	if secret == "" || strings.Contains(secret, "/") {
+		writeError(writer, http.StatusNotFound, "not found")
+		return
+	}
+
+	endpoint, err := coordinator.database.findEndpoint(webhookScheme + secret)
+	if err != nil {
+		log.Errorf(err, "unable to find webhook endpoint")
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if endpoint == nil || !endpoint.Webhook {
+		writeError(writer, http.StatusNotFound, "not found")
+		return
+	}
+
+	limit := coordinator.config.HTTP.MaxWebhookSize
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, limit+1))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "unable to read body")
+		return
+	}
+
+	if int64(len(body)) > limit {
+		writeError(writer, http.StatusRequestEntityTooLarge, "body is too large")
+		return
+	}
+
+	result := &FetchResult{
+		StatusCode: http.StatusOK,
+		BodySize:   len(body),
+	}
+
+	err = json.Unmarshal(body, &result.Data)
+	if err != nil || result.Data == nil {
+		writeError(writer, http.StatusBadRequest, "json object expected")
+		return
+	}
+
+	unlock := coordinator.endpointLocks.lock(endpoint.ID)
+	defer unlock()
+
+	// data could be changed by a push which held the lock
+	endpoint, err = coordinator.database.getEndpoint(endpoint.ID)
+	if err != nil {
+		log.Errorf(err, "unable to get webhook endpoint")
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if endpoint == nil {
+		writeError(writer, http.StatusNotFound, "not found")
+		return
+	}
+
+	err = coordinator.updateEndpointData(*endpoint, result)
+	if err != nil {
+		log.Errorf(err, "unable to update webhook endpoint: %s", endpoint.ID.Hex())
+		writeError(writer, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	// changes are sent right away, the next push would replace them before
+	// subscribers are processed by the routine
+	err = coordinator.notifyWebhookSubscribers(endpoint.URL)
+	if err != nil {
+		log.Errorf(err, "unable to notify subscribers of webhook: %s", endpoint.ID.Hex())
+	}
+
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+func (coordinator *Coordinator) notifyWebhookSubscribers(url string) error {
+	subscribers, err := coordinator.database.findActiveURLSubscriptions(url)
+	if err != nil {
+		return karma.Format(err, "unable to find subscriptions of webhook")
+	}
+
+	for _, subscriber := range subscribers {
+		err := coordinator.sendDataToSubscriber(subscriber)
+		if err != nil {
+			return karma.Format(
+				err,
+				"unable to send data to subscriber: %s",
+				subscriber.ID.Hex(),
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getSubscriptionURL_ReturnsPublicWebhookURL(t *testing.T) {
+	coordinator := &Coordinator{
+		config: &Config{HTTP: HTTPConfig{PublicURL: "https://bot.example.com/"}},
+	}
+
+	url, err := newWebhookURL()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(url, webhookScheme))
+
+	assert.Equal(
+		t,
+		"https://bot.example.com/webhooks/"+strings.TrimPrefix(url, webhookScheme),
+		coordinator.getSubscriptionURL(Subscriber{URL: url}),
+	)
+
+	assert.Equal(
+		t,
+		"http://time.jsontest.com/",
+		coordinator.getSubscriptionURL(
+			Subscriber{URL: "http://time.jsontest.com/"},
+		),
+	)
+}
+
+func Test_Coordinator_SendsChangesOfPushedData(t *testing.T) {
+	config, err := LoadConfig("./config.dev.toml")
+	assert.NoError(t, err)
+
+	config.HTTP.PublicURL = "https://bot.example.com"
+	config.HTTP.MaxWebhookSize = 64
+
+	clock := newFakeClock()
+	telegramBot := NewTestBot()
+
+	coordinator := NewCoordinator(telegramBot, NewMemoryStorage(), config)
+	coordinator.clock = clock
+
+	message := createMessage("", "", "", 1, 2)
+	message.Payload = "status"
+	err = coordinator.webhook(message)
+	assert.NoError(t, err)
+
+	subscribers, err := coordinator.database.findChatSubscriptions(2)
+	assert.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+
+	id := subscribers[0].ID.Hex()
+	path := "/webhooks/" + strings.TrimPrefix(subscribers[0].URL, webhookScheme)
+
+	push := func(body string) int {
+		recorder := httptest.NewRecorder()
+		coordinator.serveWebhook(
+			recorder,
+			httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)),
+		)
+
+		return recorder.Code
+	}
+
+	tick := func() {
+		clock.Advance(time.Second)
+		assert.NoError(t, coordinator.routineSendDataToSubscribers())
+		assert.NoError(t, coordinator.routineSendOutbox())
+	}
+
+	assert.Equal(t, http.StatusAccepted, push(`{"status": "pending"}`))
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 1)
+
+	clock.Advance(time.Second)
+	assert.Equal(t, http.StatusAccepted, push(`{"status": "done"}`))
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 2)
+	assert.Equal(t, "ID - "+id+"\n\ndone", telegramBot.lastSentMessage)
+
+	// both changes are sent when pushes come faster than subscribers are
+	// processed
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, http.StatusAccepted, push(`{"status": "failed"}`))
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, http.StatusAccepted, push(`{"status": "done"}`))
+
+	// the chat limit lets one message through per tick
+	tick()
+	tick()
+	assert.Equal(
+		t,
+		[]string{"ID - " + id + "\n\nfailed", "ID - " + id + "\n\ndone"},
+		telegramBot.allSentMessages[2:],
+	)
+
+	assert.Equal(t, http.StatusBadRequest, push(`status: done`))
+	assert.Equal(t, http.StatusBadRequest, push(`["done"]`))
+	assert.Equal(
+		t,
+		http.StatusRequestEntityTooLarge,
+		push(`{"status": "`+strings.Repeat("x", 64)+`"}`),
+	)
+
+	recorder := httptest.NewRecorder()
+	coordinator.serveWebhook(recorder, httptest.NewRequest(
+		http.MethodPost,
+		"/webhooks/unknown",
+		strings.NewReader(`{"status": "done"}`),
+	))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// rejected pushes don't change data
+	tick()
+	assert.Len(t, telegramBot.allSentMessages, 4)
+}